@@ -6,13 +6,22 @@ package apiserver
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"slices"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/omec-project/metricfunc/config"
 	"github.com/omec-project/metricfunc/controller"
+	"github.com/omec-project/metricfunc/internal/audit"
 	"github.com/omec-project/metricfunc/internal/metricdata"
+	"github.com/omec-project/metricfunc/internal/privacy"
+	"github.com/omec-project/metricfunc/internal/subtrace"
 	"github.com/omec-project/metricfunc/logger"
 	"github.com/omec-project/openapi/v2"
+	"go.uber.org/zap/zapcore"
 )
 
 func writeJSONResponse(c *gin.Context, payload any) bool {
@@ -35,18 +44,21 @@ func GetSubscriberSummary(c *gin.Context) {
 	}
 
 	if sub != nil {
-		if !writeJSONResponse(c, sub) {
+		if !writeJSONResponse(c, privacy.Subscriber(privacyChannel(c), sub)) {
 			return
 		}
 		return
 	}
 
-	logger.ApiSrvLog.Errorf("subscriber data not found, imsi [%s]", subId)
+	logger.ApiSrvLog.Errorf("subscriber data not found, imsi [%s]", privacy.Imsi(privacy.Logs, subId))
 	c.JSON(http.StatusNotFound, gin.H{})
 }
 
 func GetSubscriberAll(c *gin.Context) {
 	subs := metricdata.GetSubscriberAll()
+	for i, imsi := range subs {
+		subs[i] = privacy.Imsi(privacyChannel(c), imsi)
+	}
 	if len(subs) != 0 {
 		if !writeJSONResponse(c, subs) {
 			return
@@ -85,6 +97,23 @@ func GetNfStatusAll(c *gin.Context) {
 	c.JSON(http.StatusNotFound, gin.H{})
 }
 
+// GetIpLeaseHistory lists which subscribers held the ip address and when
+func GetIpLeaseHistory(c *gin.Context) {
+	ipAddr := c.Params.ByName("ipaddr")
+	leases := metricdata.GetIpLeaseHistory(ipAddr)
+	for i := range leases {
+		leases[i].IpAddr = privacy.IpAddr(privacyChannel(c), leases[i].IpAddr)
+		leases[i].Imsi = privacy.Imsi(privacyChannel(c), leases[i].Imsi)
+	}
+	if len(leases) != 0 {
+		writeJSONResponse(c, leases)
+		return
+	}
+
+	logger.ApiSrvLog.Errorf("ip lease history not found, ip-addr [%s]", privacy.IpAddr(privacy.Logs, ipAddr))
+	c.JSON(http.StatusNotFound, gin.H{})
+}
+
 // Gives summary stats for any service
 func GetNfServiceStatsSummary(c *gin.Context) {
 }
@@ -111,14 +140,228 @@ func PushTestIPs(c *gin.Context) {
 	requestBody, err := c.GetRawData()
 	if err != nil {
 		logger.ApiSrvLog.Errorf("get requestbody error: %+v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 	var rogueIPs controller.RogueIPs
 	err = json.Unmarshal(requestBody, &rogueIPs)
 	if err != nil {
 		logger.ApiSrvLog.Errorf("json unmarshal error: %+v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	logger.ApiSrvLog.Infoln("test RogueIPs:", privacy.IpAddrs(privacy.Logs, rogueIPs.IpAddresses))
+	rogueIPs.Source = "api:" + caller(c).Name
+	if err := controller.SubmitRogueIPs(c.Request.Context(), rogueIPs); err != nil {
+		logger.ApiSrvLog.Errorf("submit rogueIPs error: %+v", err)
+		if errors.Is(err, controller.ErrBatchTooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+			return
+		}
+		// none of the ips was queued, ask the sender to back off and retry
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
+
+// EnableSubscriber re-enables a subscriber disabled by the controller
+func EnableSubscriber(c *gin.Context) {
+	imsi := c.Params.ByName("imsi")
+	err := controller.EnableSubscriber(c.Request.Context(), imsi, "api:"+caller(c).Name)
+	if errors.Is(err, controller.ErrNotEnabled) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		logger.ApiSrvLog.Errorf("enable subscriber [%s] error: %+v", privacy.Imsi(privacy.Logs, imsi), err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetAuditRecords returns the controller audit records filtered by the
+// optional from/to (RFC 3339), imsi and limit query parameters
+func GetAuditRecords(c *gin.Context) {
+	var q audit.Query
+	var err error
+	if from := c.Query("from"); from != "" {
+		if q.From, err = time.Parse(time.RFC3339, from); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from: " + err.Error()})
+			return
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		if q.To, err = time.Parse(time.RFC3339, to); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to: " + err.Error()})
+			return
+		}
+	}
+	if limit := c.Query("limit"); limit != "" {
+		if q.Limit, err = strconv.Atoi(limit); err != nil || q.Limit < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+	}
+	q.Imsi = c.Query("imsi")
+
+	records, err := audit.Search(q)
+	if errors.Is(err, audit.ErrNotConfigured) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		logger.ApiSrvLog.Errorf("audit search error: %+v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	for i := range records {
+		records[i].IpAddr = privacy.IpAddr(privacyChannel(c), records[i].IpAddr)
+		records[i].Imsi = privacy.Imsi(privacyChannel(c), records[i].Imsi)
+	}
+	writeJSONResponse(c, records)
+}
+
+// effectiveConfig returns the configuration in effect, set by SetConfigSource
+var effectiveConfig func() *config.Config
+
+// SetConfigSource sets the source of the configuration shown by GetConfig
+func SetConfigSource(source func() *config.Config) {
+	effectiveConfig = source
+}
+
+// GetConfig returns the configuration in effect, overrides and defaults
+// included, with the secrets redacted
+func GetConfig(c *gin.Context) {
+	if effectiveConfig == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "configuration not available"})
+		return
+	}
+	cfg, err := config.Redacted(effectiveConfig())
+	if err != nil {
+		logger.ApiSrvLog.Errorf("redact configuration error: %+v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(c, cfg)
+}
+
+// LogLevels sets the log level of all categories, then the levels of the
+// given categories
+type LogLevels struct {
+	Level      string            `json:"level,omitempty"`
+	Categories map[string]string `json:"categories,omitempty"`
+}
+
+// GetLogLevels returns the log level of every category
+func GetLogLevels(c *gin.Context) {
+	writeJSONResponse(c, logger.Levels())
+}
+
+// SetLogLevels changes log levels until the next restart or change of the
+// logger configuration, nothing is changed unless all levels are valid
+func SetLogLevels(c *gin.Context) {
+	var req LogLevels
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var level zapcore.Level
+	var err error
+	if req.Level != "" {
+		if level, err = zapcore.ParseLevel(req.Level); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 	}
+	categories := make(map[string]zapcore.Level)
+	for name, value := range req.Categories {
+		if !slices.Contains(logger.Categories(), name) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown log category " + name})
+			return
+		}
+		if categories[name], err = zapcore.ParseLevel(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": name + ": " + err.Error()})
+			return
+		}
+	}
+
+	logger.ApiSrvLog.Infof("log levels changed by [%s]", caller(c).Name)
+	if req.Level != "" {
+		logger.SetLogLevel(level)
+	}
+	for name, l := range categories {
+		if err := logger.SetCategoryLevel(name, l); err != nil {
+			logger.ApiSrvLog.Errorf("set log level error: %+v", err)
+		}
+	}
+	writeJSONResponse(c, logger.Levels())
+}
+
+// TraceRequest adds a subscriber to the trace list
+type TraceRequest struct {
+	Kind     subtrace.Kind `json:"kind"`
+	Value    string        `json:"value"`
+	Duration string        `json:"duration,omitempty"` // such as 30m, 1h if unset
+}
 
-	logger.ApiSrvLog.Infoln("test RogueIPs:", rogueIPs)
-	controller.RogueChannel <- rogueIPs
+// GetTraceList returns the subscribers traced
+func GetTraceList(c *gin.Context) {
+	writeJSONResponse(c, subtrace.MaskTargets(privacyChannel(c), subtrace.List()))
+}
+
+// AddTrace traces a subscriber by imsi, ip address or guti
+func AddTrace(c *gin.Context) {
+	var req TraceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	target := subtrace.Target{Kind: req.Kind, Value: req.Value, AddedBy: "api:" + caller(c).Name}
+	if req.Duration != "" {
+		duration, err := time.ParseDuration(req.Duration)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid duration: " + err.Error()})
+			return
+		}
+		target.Expires = time.Now().Add(duration)
+	}
+	target, err := subtrace.Add(target)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, subtrace.MaskTargets(privacyChannel(c), []subtrace.Target{target})[0])
+}
+
+// RemoveTrace stops tracing a subscriber, its trace bundle is kept
+func RemoveTrace(c *gin.Context) {
+	err := subtrace.Remove(subtrace.Kind(c.Params.ByName("kind")), c.Params.ByName("value"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetTraceBundle returns the events traced of a subscriber
+func GetTraceBundle(c *gin.Context) {
+	bundle, err := subtrace.GetBundle(c.Params.ByName("imsi"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	writeJSONResponse(c, subtrace.MaskBundle(privacyChannel(c), bundle))
+}
+
+// DeleteTraceBundle drops the events traced of a subscriber
+func DeleteTraceBundle(c *gin.Context) {
+	if err := subtrace.DeleteBundle(c.Params.ByName("imsi")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
 }
@@ -10,6 +10,10 @@ import (
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/omec-project/metricfunc/config"
+	"github.com/omec-project/metricfunc/internal/apiauth"
+	"github.com/omec-project/metricfunc/logger"
+	"go.uber.org/zap/zapcore"
 )
 
 func TestWriteJSONResponseSuccess(t *testing.T) {
@@ -40,3 +44,147 @@ func TestWriteJSONResponseSetBodyFailure(t *testing.T) {
 		t.Fatalf("unexpected status: got %d want %d", recorder.Code, http.StatusInternalServerError)
 	}
 }
+
+func TestAuthorization(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("METRICFUNC_TEST_OBSERVER", "observer-token")
+	authenticator, err := apiauth.New(&config.ApiServerAuth{Tokens: []config.ApiToken{
+		{Name: "grafana", Token: &config.Secret{Env: "METRICFUNC_TEST_OBSERVER"}, Role: "observer"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	AddService(router, authenticator)
+
+	for _, tc := range []struct {
+		method, path, token string
+		status              int
+	}{
+		{http.MethodGet, "/nmetric-func/v1/", "", http.StatusUnauthorized},
+		{http.MethodGet, "/nmetric-func/v1/", "wrong", http.StatusUnauthorized},
+		{http.MethodGet, "/nmetric-func/v1/", "observer-token", http.StatusOK},
+		{http.MethodPost, "/nmetric-func/v1/testIPs", "", http.StatusUnauthorized},
+		{http.MethodPost, "/nmetric-func/v1/testIPs", "observer-token", http.StatusForbidden},
+		{http.MethodPost, "/nmetric-func/v1/subscriber/208930000000001/enable", "observer-token", http.StatusForbidden},
+		{http.MethodGet, "/nmetric-func/v1/config", "observer-token", http.StatusForbidden},
+		{http.MethodGet, "/nmetric-func/v1/loglevel", "observer-token", http.StatusOK},
+		{http.MethodPut, "/nmetric-func/v1/loglevel", "observer-token", http.StatusForbidden},
+		{http.MethodPost, "/nmetric-func/v1/trace", "observer-token", http.StatusForbidden},
+		{http.MethodGet, "/nmetric-func/v1/traceBundle/208930000000001", "observer-token", http.StatusForbidden},
+	} {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		router.ServeHTTP(recorder, req)
+		if recorder.Code != tc.status {
+			t.Errorf("%s %s with token %q: got %d want %d", tc.method, tc.path, tc.token, recorder.Code, tc.status)
+		}
+	}
+}
+
+func TestMetricsOnApiServer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("METRICFUNC_TEST_OBSERVER", "observer-token")
+	auth := &config.ApiServerAuth{Tokens: []config.ApiToken{
+		{Name: "prometheus", Token: &config.Secret{Env: "METRICFUNC_TEST_OBSERVER"}, Role: "observer"},
+	}}
+
+	for _, tc := range []struct {
+		metrics bool
+		token   string
+		status  int
+	}{
+		{false, "observer-token", http.StatusNotFound},
+		{true, "", http.StatusUnauthorized},
+		{true, "observer-token", http.StatusOK},
+	} {
+		server, err := NewApiServer(&config.ServerAddr{Port: 9301}, auth, tc.metrics)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		server.Handler.ServeHTTP(recorder, req)
+		if recorder.Code != tc.status {
+			t.Errorf("metrics %v with token %q: got %d want %d", tc.metrics, tc.token, recorder.Code, tc.status)
+		}
+	}
+}
+
+func TestGetConfigRedacted(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	SetConfigSource(func() *config.Config {
+		return &config.Config{Configuration: &config.Configuration{
+			ApiServer: config.ServerAddr{Port: 9301},
+			RocEndPoint: config.ServerAddr{Addr: "roc", Auth: &config.Auth{
+				Type: "bearer", Token: &config.Secret{File: "/etc/metricfunc/roc-token"},
+			}},
+		}}
+	})
+	t.Cleanup(func() { SetConfigSource(nil) })
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodGet, "/nmetric-func/v1/config", nil)
+	GetConfig(c)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d", recorder.Code)
+	}
+	body := recorder.Body.String()
+	if strings.Contains(body, "roc-token") || !strings.Contains(body, `"apiServer":{"port":9301}`) {
+		t.Fatalf("unexpected body %s", body)
+	}
+}
+
+func TestSetLogLevels(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Cleanup(func() { logger.SetLogLevel(zapcore.InfoLevel) })
+
+	put := func(body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Request = httptest.NewRequest(http.MethodPut, "/nmetric-func/v1/loglevel", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		SetLogLevels(c)
+		return recorder
+	}
+
+	recorder := put(`{"level":"warn","categories":{"Gin":"debug"}}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", recorder.Code, recorder.Body)
+	}
+	if levels := logger.Levels(); levels["Gin"] != "debug" || levels["App"] != "warn" {
+		t.Fatalf("unexpected levels %v", levels)
+	}
+
+	// nothing changes when one of the levels is invalid
+	for _, body := range []string{
+		`{"level":"info","categories":{"Kafka":"debug"}}`,
+		`{"level":"info","categories":{"Gin":"verbose"}}`,
+		`{"level":"verbose"}`,
+	} {
+		if recorder := put(body); recorder.Code != http.StatusBadRequest {
+			t.Errorf("%s: unexpected status %d", body, recorder.Code)
+		}
+	}
+	if levels := logger.Levels(); levels["Gin"] != "debug" || levels["App"] != "warn" {
+		t.Fatalf("levels changed by invalid requests %v", levels)
+	}
+}
+
+func TestPushTestIPsInvalidBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/nmetric-func/v1/testIPs", strings.NewReader(`{"ipaddresses":`))
+	PushTestIPs(c)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status %d: %s", recorder.Code, recorder.Body)
+	}
+}
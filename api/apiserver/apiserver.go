@@ -6,8 +6,17 @@ package apiserver
 
 import (
 	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/omec-project/metricfunc/config"
+	"github.com/omec-project/metricfunc/internal/apiauth"
+	"github.com/omec-project/metricfunc/internal/privacy"
+	"github.com/omec-project/metricfunc/internal/promclient"
+	"github.com/omec-project/metricfunc/internal/tracing"
 	"github.com/omec-project/metricfunc/logger"
 	"github.com/omec-project/util/http2_util"
 	utilLogger "github.com/omec-project/util/logger"
@@ -16,20 +25,53 @@ import (
 func init() {
 }
 
-func StartApiServer(cfg *config.ServerAddr) {
-	router := utilLogger.NewGinWithZap(logger.GinLog)
-	AddService(router)
-	HTTPAddr := fmt.Sprintf(":%d", cfg.Port)
-	logger.ApiSrvLog.Debugf("api server initialised on address [%v] port [%v] ", cfg.Addr, cfg.Port)
-	server, err := http2_util.NewServer(HTTPAddr, "", router)
+// accessLog logs requests in the format of the util gin logger
+func accessLog(c *gin.Context) {
+	c.Next()
+	logger.GinLog.Infof("| %3d | %15s | %-7s | %s | %s", c.Writer.Status(), c.ClientIP(), c.Request.Method,
+		c.FullPath(), c.Errors.ByType(gin.ErrorTypePrivate).String())
+}
+
+// requestMetrics records the latency of the requests by route
+func requestMetrics(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	promclient.ObserveApiRequest(c.Request.Method, route, c.Writer.Status(), time.Since(start))
+}
+
+// NewApiServer returns the api server, served by the caller. With metrics
+// set, it serves /metrics to observers as the prometheus server does.
+func NewApiServer(cfg *config.ServerAddr, auth *config.ApiServerAuth, metrics bool) (*http.Server, error) {
+	authenticator, err := apiauth.New(auth)
 	if err != nil {
-		logger.ApiSrvLog.Errorf("api server initialise error [%v] ", err.Error())
-		return
+		return nil, fmt.Errorf("api server authentication: %w", err)
+	}
+	if authenticator == nil {
+		logger.ApiSrvLog.Warnln("api server authentication disabled, all callers are operators")
 	}
 
-	err = server.ListenAndServe()
+	router := utilLogger.NewGinWithZap(logger.GinLog)
+	if privacy.Enabled(privacy.Logs) {
+		// the default access log prints request paths holding imsi and ip
+		// addresses, log the route pattern instead
+		router = gin.New()
+		router.Use(accessLog, gin.Recovery())
+	}
+	router.Use(tracing.Middleware, requestMetrics)
+	AddService(router, authenticator)
+	if metrics {
+		router.GET("/metrics", authenticate(authenticator), authorize(apiauth.RoleObserver),
+			gin.WrapH(promclient.Handler()))
+	}
+	HTTPAddr := fmt.Sprintf(":%d", cfg.Port)
+	logger.ApiSrvLog.Debugf("api server initialised on [%v]", net.JoinHostPort(cfg.Addr, strconv.Itoa(cfg.Port)))
+	server, err := http2_util.NewServer(HTTPAddr, "", router)
 	if err != nil {
-		logger.ApiSrvLog.Errorf("api server listen error [%v] ", err.Error())
-		return
+		return nil, fmt.Errorf("api server initialise: %w", err)
 	}
+	return server, nil
 }
@@ -0,0 +1,76 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package apiserver
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omec-project/metricfunc/internal/apiauth"
+	"github.com/omec-project/metricfunc/internal/privacy"
+	"github.com/omec-project/metricfunc/logger"
+)
+
+const identityKey = "metricfunc-identity"
+
+// anonymous is the caller of an api server without authentication
+var anonymous = apiauth.Identity{Name: "anonymous", Role: apiauth.RoleOperator}
+
+// authenticate rejects requests without valid credentials with 401
+func authenticate(authenticator *apiauth.Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if authenticator == nil {
+			c.Set(identityKey, anonymous)
+			return
+		}
+
+		identity, err := authenticator.Authenticate(c.Request)
+		switch {
+		case errors.Is(err, apiauth.ErrNoCredentials):
+			c.Header("WWW-Authenticate", `Bearer realm="metricfunc"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, apiauth.ErrInvalidCredentials):
+			logger.ApiSrvLog.Warnf("invalid credentials for [%s %s] from [%s]",
+				c.Request.Method, c.FullPath(), c.ClientIP())
+			c.Header("WWW-Authenticate", `Bearer realm="metricfunc", error="invalid_token"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			logger.ApiSrvLog.Errorf("authentication error: %+v", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.Set(identityKey, identity)
+	}
+}
+
+// authorize rejects callers below role with 403
+func authorize(role apiauth.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity := caller(c)
+		if identity.Role < role {
+			logger.ApiSrvLog.Warnf("[%s] with role [%s] denied [%s %s], requires [%s]",
+				identity.Name, identity.Role, c.Request.Method, c.FullPath(), role)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "requires role " + role.String()})
+		}
+	}
+}
+
+// privacyChannel selects how subscriber identities are shown to the caller
+func privacyChannel(c *gin.Context) privacy.Channel {
+	if caller(c).Role >= apiauth.RoleOperator {
+		return privacy.ApiOperator
+	}
+	return privacy.ApiObserver
+}
+
+// caller returns the identity set by authenticate
+func caller(c *gin.Context) apiauth.Identity {
+	value, _ := c.Get(identityKey)
+	identity, _ := value.(apiauth.Identity)
+	return identity
+}
@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/omec-project/metricfunc/internal/apiauth"
 )
 
 // Route is the information for every URI.
@@ -21,24 +22,29 @@ type Route struct {
 	Pattern string
 	// HandlerFunc is the handler function of this route.
 	HandlerFunc gin.HandlerFunc
+	// Role is the least privileged role allowed to call this Route.
+	Role apiauth.Role
 }
 
 // Routes is the list of the generated Route.
 type Routes []Route
 
-func AddService(engine *gin.Engine) *gin.RouterGroup {
+// AddService registers the routes, open to everyone when authenticator is nil
+func AddService(engine *gin.Engine, authenticator *apiauth.Authenticator) *gin.RouterGroup {
 	group := engine.Group("/nmetric-func/v1")
+	group.Use(authenticate(authenticator))
 
 	for _, route := range routes {
+		handlers := []gin.HandlerFunc{authorize(route.Role), route.HandlerFunc}
 		switch route.Method {
 		case "GET":
-			group.GET(route.Pattern, route.HandlerFunc)
+			group.GET(route.Pattern, handlers...)
 		case "POST":
-			group.POST(route.Pattern, route.HandlerFunc)
+			group.POST(route.Pattern, handlers...)
 		case "PUT":
-			group.PUT(route.Pattern, route.HandlerFunc)
+			group.PUT(route.Pattern, handlers...)
 		case "DELETE":
-			group.DELETE(route.Pattern, route.HandlerFunc)
+			group.DELETE(route.Pattern, handlers...)
 		}
 	}
 	return group
@@ -55,6 +61,7 @@ var routes = Routes{
 		"GET",
 		"/",
 		Index,
+		apiauth.RoleObserver,
 	},
 
 	{
@@ -62,6 +69,7 @@ var routes = Routes{
 		strings.ToUpper("Get"),
 		"/subscriber/:imsi",
 		GetSubscriberSummary,
+		apiauth.RoleObserver,
 	},
 
 	{
@@ -69,6 +77,15 @@ var routes = Routes{
 		strings.ToUpper("Get"),
 		"/subscriber/all",
 		GetSubscriberAll,
+		apiauth.RoleObserver,
+	},
+
+	{
+		"GetIpLeaseHistory",
+		strings.ToUpper("Get"),
+		"/iplease/:ipaddr",
+		GetIpLeaseHistory,
+		apiauth.RoleObserver,
 	},
 
 	{
@@ -76,6 +93,7 @@ var routes = Routes{
 		strings.ToUpper("Get"),
 		"/nfstatus/:type",
 		GetNfStatus,
+		apiauth.RoleObserver,
 	},
 
 	{
@@ -83,18 +101,21 @@ var routes = Routes{
 		strings.ToUpper("Get"),
 		"/nfstatus/all",
 		GetNfStatusAll,
+		apiauth.RoleObserver,
 	},
 	{
 		"GetNfServiceStatsSummary",
 		strings.ToUpper("Get"),
 		"/nfServiceStatsSummary/:type",
 		GetNfServiceStatsSummary,
+		apiauth.RoleObserver,
 	},
 	{
 		"GetNfServiceStatsDetail",
 		strings.ToUpper("Get"),
 		"/nfServiceStatsDetail/:type",
 		GetNfServiceStatsDetail,
+		apiauth.RoleObserver,
 	},
 
 	{
@@ -102,6 +123,15 @@ var routes = Routes{
 		strings.ToUpper("Get"),
 		"/nfServiceStats/all",
 		GetNfServiceStatsAll,
+		apiauth.RoleObserver,
+	},
+
+	{
+		"EnableSubscriber",
+		strings.ToUpper("Post"),
+		"/subscriber/:imsi/enable",
+		EnableSubscriber,
+		apiauth.RoleOperator,
 	},
 
 	{
@@ -109,6 +139,79 @@ var routes = Routes{
 		strings.ToUpper("Post"),
 		"/testIPs",
 		PushTestIPs,
+		apiauth.RoleOperator,
+	},
+
+	{
+		"GetAuditRecords",
+		strings.ToUpper("Get"),
+		"/audit",
+		GetAuditRecords,
+		apiauth.RoleObserver,
+	},
+
+	{
+		"GetConfig",
+		strings.ToUpper("Get"),
+		"/config",
+		GetConfig,
+		apiauth.RoleOperator,
+	},
+
+	{
+		"GetLogLevels",
+		strings.ToUpper("Get"),
+		"/loglevel",
+		GetLogLevels,
+		apiauth.RoleObserver,
+	},
+
+	{
+		"SetLogLevels",
+		strings.ToUpper("Put"),
+		"/loglevel",
+		SetLogLevels,
+		apiauth.RoleOperator,
+	},
+
+	{
+		"GetTraceList",
+		strings.ToUpper("Get"),
+		"/trace",
+		GetTraceList,
+		apiauth.RoleOperator,
+	},
+
+	{
+		"AddTrace",
+		strings.ToUpper("Post"),
+		"/trace",
+		AddTrace,
+		apiauth.RoleOperator,
+	},
+
+	{
+		"RemoveTrace",
+		strings.ToUpper("Delete"),
+		"/trace/:kind/:value",
+		RemoveTrace,
+		apiauth.RoleOperator,
+	},
+
+	{
+		"GetTraceBundle",
+		strings.ToUpper("Get"),
+		"/traceBundle/:imsi",
+		GetTraceBundle,
+		apiauth.RoleOperator,
+	},
+
+	{
+		"DeleteTraceBundle",
+		strings.ToUpper("Delete"),
+		"/traceBundle/:imsi",
+		DeleteTraceBundle,
+		apiauth.RoleOperator,
 	},
 }
 
@@ -17,19 +17,96 @@ type Info struct {
 }
 
 type Logger struct {
-	LogLevel string `yaml:"level,omitempty"`
+	LogLevel   string            `yaml:"level,omitempty"`
+	Categories map[string]string `yaml:"categories,omitempty"` // level by category, over level
+	Encoding   string            `yaml:"encoding,omitempty"`   // console or json
+	File       *LogFile          `yaml:"file,omitempty"`       // stdout if unset
+	Sampling   *LogSampling      `yaml:"sampling,omitempty"`   // all debug lines written if unset
+}
+
+// LogFile is rotated when it reaches MaxSize
+type LogFile struct {
+	Path       string `yaml:"path,omitempty"`
+	MaxSize    int    `yaml:"maxSize,omitempty"`    // megabytes, 100 if unset
+	MaxBackups int    `yaml:"maxBackups,omitempty"` // rotated files kept, all if unset
+	MaxAge     int    `yaml:"maxAge,omitempty"`     // days rotated files are kept, forever if unset
+	Compress   bool   `yaml:"compress,omitempty"`   // gzip rotated files
+}
+
+// LogSampling limits the debug lines of the same message per second
+type LogSampling struct {
+	Initial    int `yaml:"initial,omitempty"`    // lines written every second
+	Thereafter int `yaml:"thereafter,omitempty"` // then one of every thereafter lines, none if unset
 }
 
 type Configuration struct {
 	NfStreams          []NFStream       `yaml:"nfStreams,omitempty"`
 	AnalyticsStream    *AnalyticsStream `yaml:"analyticsStream,omitempty"`
 	ApiServer          ServerAddr       `yaml:"apiServer,omitempty"`
+	ApiServerAuth      *ApiServerAuth   `yaml:"apiServerAuth,omitempty"` // open api server if unset
 	PrometheusServer   ServerAddr       `yaml:"prometheusServer,omitempty"`
+	MetricsOnApiServer bool             `yaml:"metricsOnApiServer,omitempty"` // serve /metrics to observers too
 	DebugProfile       ServerAddr       `yaml:"debugProfileServer,omitempty"`
+	DebugProfileAuth   *ApiServerAuth   `yaml:"debugProfileServerAuth,omitempty"` // apiServerAuth if unset
 	UserAppApiServer   ServerAddr       `yaml:"userAppApiServer,omitempty"`
 	RocEndPoint        ServerAddr       `yaml:"rocEndPoint,omitempty"`
+	WebuiEndPoint      ServerAddr       `yaml:"webuiEndPoint,omitempty"`
+	Provisioner        string           `yaml:"provisioner,omitempty"` // roc or webui
 	MetricFuncEndPoint ServerAddr       `yaml:"metricFuncEndPoint,omitempty"`
 	ControllerFlag     bool             `yaml:"controllerFlag,omitempty"`
+	Controller         Controller       `yaml:"controller,omitempty"`
+	AuditLog           *AuditLog        `yaml:"auditLog,omitempty"`
+	Privacy            *Privacy         `yaml:"privacy,omitempty"`
+	ShutdownTimeout    int              `yaml:"shutdownTimeout,omitempty"` // seconds to stop gracefully
+	NfStatusTimeout    int              `yaml:"nfStatusTimeout,omitempty"` // seconds silent before an nf is unknown
+	Tracing            *Tracing         `yaml:"tracing,omitempty"`
+	MetricsPush        *MetricsPush     `yaml:"metricsPush,omitempty"`
+	NfProbes           *NfProbes        `yaml:"nfProbes,omitempty"`
+	NrfEndPoint        *ServerAddr      `yaml:"nrfEndPoint,omitempty"` // nf inventory polled, every 60s if unset
+	NrfNfTypes         []string         `yaml:"nrfNfTypes,omitempty"`  // of the inventory, the core nfs if unset
+}
+
+// NfProbes checks the reachability of nfs on an interval, besides the
+// status they report themselves
+type NfProbes struct {
+	Interval int       `yaml:"interval,omitempty"` // seconds between probes, 30 if unset
+	Timeout  int       `yaml:"timeout,omitempty"`  // seconds a probe may take, 5 if unset
+	Targets  []NfProbe `yaml:"targets,omitempty"`
+}
+
+// NfProbe is a probe of an nf
+type NfProbe struct {
+	NfName string `yaml:"nfName,omitempty"`
+	NfType string `yaml:"nfType,omitempty"`
+	// Type is http, an HTTP/2 GET of the SBI answered below 500, tcp or
+	// sctp, a connection, or nrf, the nf registered in the NRF at the
+	// endpoint
+	Type         string     `yaml:"type,omitempty"`
+	NfInstanceId string     `yaml:"nfInstanceId,omitempty"` // nrf, any instance of the nf type if unset
+	EndPoint     ServerAddr `yaml:"endPoint,omitempty"`
+}
+
+// MetricsPush sends the metrics to receivers, for sites which cannot be
+// scraped. Pushes are buffered while a receiver is down.
+type MetricsPush struct {
+	Interval       int               `yaml:"interval,omitempty"`       // seconds between pushes, 30 if unset
+	BatchSize      int               `yaml:"batchSize,omitempty"`      // buffered pushes sent per request, 10 if unset
+	BufferSize     int               `yaml:"bufferSize,omitempty"`     // pushes kept per receiver, 120 if unset
+	ExternalLabels map[string]string `yaml:"externalLabels,omitempty"` // added to every series, such as the site
+	// RemoteWrite is a prometheus remote-write receiver, path /api/v1/write
+	// if unset
+	RemoteWrite *ServerAddr `yaml:"remoteWrite,omitempty"`
+	// Otlp is an OTLP/HTTP metrics receiver, path /v1/metrics if unset
+	Otlp *ServerAddr `yaml:"otlp,omitempty"`
+}
+
+// Tracing exports OpenTelemetry spans, to an OTLP/HTTP collector or stdout
+type Tracing struct {
+	Enable      bool    `yaml:"enable,omitempty"`
+	Exporter    string  `yaml:"exporter,omitempty"`    // otlp or stdout, otlp if unset
+	Endpoint    string  `yaml:"endpoint,omitempty"`    // host:port of the collector, localhost:4318 if unset
+	Insecure    bool    `yaml:"insecure,omitempty"`    // plain http to the collector
+	SampleRatio float64 `yaml:"sampleRatio,omitempty"` // of the traces started here, 1 if unset
 }
 
 type ServerAddr struct {
@@ -37,6 +114,77 @@ type ServerAddr struct {
 	Port         int    `yaml:"port,omitempty"`
 	Path         string `yaml:"path,omitempty"` // IP used to run the server in the node.
 	PollInterval int    `yaml:"pollInterval,omitempty"`
+	Scheme       string `yaml:"scheme,omitempty"` // http or https, https when tls is set
+	Tls          *TLS   `yaml:"tls,omitempty"`
+	Auth         *Auth  `yaml:"auth,omitempty"` // credentials sent to the endpoint
+}
+
+// Secret is read from a file or an environment variable, never from the
+// configuration file itself
+type Secret struct {
+	File string `yaml:"file,omitempty"`
+	Env  string `yaml:"env,omitempty"`
+}
+
+type Auth struct {
+	Type string `yaml:"type,omitempty"` // bearer, oauth2, basic or apikey
+	// bearer
+	Token *Secret `yaml:"token,omitempty"`
+	// basic
+	Username string  `yaml:"username,omitempty"`
+	Password *Secret `yaml:"password,omitempty"`
+	// apikey
+	Header string  `yaml:"header,omitempty"` // X-API-Key if unset
+	ApiKey *Secret `yaml:"apiKey,omitempty"`
+	// oauth2 client credentials grant
+	TokenUrl     string   `yaml:"tokenUrl,omitempty"`
+	ClientId     string   `yaml:"clientId,omitempty"`
+	ClientSecret *Secret  `yaml:"clientSecret,omitempty"`
+	Scopes       []string `yaml:"scopes,omitempty"`
+	Tls          *TLS     `yaml:"tls,omitempty"` // of the token endpoint, the system roots if unset
+}
+
+// ApiServerAuth authenticates the callers of the api server. Observers may
+// read subscriber and nf data, operators may also push rogue ips and
+// re-enable subscribers.
+type ApiServerAuth struct {
+	Tokens      []ApiToken   `yaml:"tokens,omitempty"` // static bearer tokens
+	Jwt         *Jwt         `yaml:"jwt,omitempty"`
+	ClientCerts []ClientCert `yaml:"clientCerts,omitempty"` // mTLS client identities, needs tls on the api server
+}
+
+type ApiToken struct {
+	Name  string  `yaml:"name,omitempty"` // caller recorded in logs and the audit log
+	Token *Secret `yaml:"token,omitempty"`
+	Role  string  `yaml:"role,omitempty"` // observer or operator
+}
+
+type Jwt struct {
+	Issuer        string  `yaml:"issuer,omitempty"`
+	Audience      string  `yaml:"audience,omitempty"`
+	HmacSecret    *Secret `yaml:"hmacSecret,omitempty"`    // HS256/384/512 signed tokens
+	PublicKeyFile string  `yaml:"publicKeyFile,omitempty"` // PEM RSA, ECDSA or Ed25519 key or certificate
+	RoleClaim     string  `yaml:"roleClaim,omitempty"`     // dotted claim path, roles if unset
+	// Roles maps claim values to observer or operator, claim values are
+	// taken as roles if unset
+	Roles map[string]string `yaml:"roles,omitempty"`
+}
+
+type ClientCert struct {
+	CommonName string `yaml:"commonName,omitempty"`
+	Role       string `yaml:"role,omitempty"`
+}
+
+// TLS configures the connections to an endpoint, or the connections
+// accepted by a server. Servers reload the files when they change.
+type TLS struct {
+	CaFile             string `yaml:"caFile,omitempty"`   // CA bundle verifying the peer, system roots if unset
+	CertFile           string `yaml:"certFile,omitempty"` // own certificate, presented for mTLS
+	KeyFile            string `yaml:"keyFile,omitempty"`
+	ServerName         string `yaml:"serverName,omitempty"` // overrides the name verified in the server certificate
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify,omitempty"`
+	// ClientAuth applies to servers with a caFile, require or verifyIfGiven
+	ClientAuth string `yaml:"clientAuth,omitempty"`
 }
 
 type Urls struct {
@@ -50,7 +198,8 @@ type NFStream struct {
 }
 
 type Topic struct {
-	TopicName string `yaml:"topicName,omitempty"`
+	TopicName  string `yaml:"topicName,omitempty"`
+	TopicGroup string `yaml:"topicGroup,omitempty"` // analytics, mongodb, restapi or prometheus, unused
 }
 
 type Groups struct {
@@ -64,4 +213,48 @@ type AnalyticsStream struct {
 	Enable    bool     `yaml:"enable,omitempty"`
 	Urls      []string `yaml:"urls,omitempty"`
 	TopicName string   `yaml:"topicName,omitempty"`
+	Topic     string   `yaml:"topic,omitempty"` // deprecated, use topicName
+}
+
+type Controller struct {
+	Workers              int `yaml:"workers,omitempty"`              // concurrent rogue ip handlers
+	QueueSize            int `yaml:"queueSize,omitempty"`            // queued rogue ips before rejecting reports
+	MaxRetries           int `yaml:"maxRetries,omitempty"`           // retries of a failed enforcement
+	PendingReportTimeout int `yaml:"pendingReportTimeout,omitempty"` // seconds to wait for the subscriber of a rogue ip
+	IpLeaseRetention     int `yaml:"ipLeaseRetention,omitempty"`     // seconds to keep ended ip to imsi leases
+	// Upstream tunes the requests to ROC, webui and the user-app service
+	Upstream UpstreamPolicy `yaml:"upstream,omitempty"`
+}
+
+type UpstreamPolicy struct {
+	MaxAttempts      int     `yaml:"maxAttempts,omitempty"`
+	AttemptTimeout   int     `yaml:"attemptTimeout,omitempty"` // seconds
+	BackoffBase      int     `yaml:"backoffBase,omitempty"`    // milliseconds
+	BackoffMax       int     `yaml:"backoffMax,omitempty"`     // milliseconds
+	RetryBudgetRatio float64 `yaml:"retryBudgetRatio,omitempty"`
+	FailureThreshold int     `yaml:"failureThreshold,omitempty"` // consecutive failures opening the circuit
+	OpenTimeout      int     `yaml:"openTimeout,omitempty"`      // seconds
+}
+
+type AuditLog struct {
+	Enable     bool     `yaml:"enable,omitempty"`
+	Path       string   `yaml:"path,omitempty"`    // JSON lines file, also serves the audit API
+	MaxSize    int      `yaml:"maxSize,omitempty"` // megabytes before the file is moved to <path>.1, 100 if unset
+	KafkaUrls  []string `yaml:"kafkaUrls,omitempty"`
+	KafkaTopic string   `yaml:"kafkaTopic,omitempty"`
+}
+
+// Privacy pseudonymises imsi, guti and ip addresses per output channel.
+// Each channel is clear, hash or truncate, clear if unset.
+type Privacy struct {
+	HashKey *Secret    `yaml:"hashKey,omitempty"` // key of the hash mode, shared to correlate between instances
+	Logs    string     `yaml:"logs,omitempty"`
+	Metrics string     `yaml:"metrics,omitempty"` // prometheus labels, clear or hash
+	Api     ApiPrivacy `yaml:"api,omitempty"`
+}
+
+// ApiPrivacy sets the mode of the api responses per caller role
+type ApiPrivacy struct {
+	Observer string `yaml:"observer,omitempty"`
+	Operator string `yaml:"operator,omitempty"`
 }
@@ -0,0 +1,138 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"go.yaml.in/yaml/v4"
+)
+
+// Change is a value which differs between two configurations, empty when
+// it is unset on one side
+type Change struct {
+	Path string
+	Old  string
+	New  string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: [%s] -> [%s]", c.Path, c.Old, c.New)
+}
+
+// Under reports whether the change is at path or below it
+func (c Change) Under(path string) bool {
+	return c.Path == path || strings.HasPrefix(c.Path, path+".") || strings.HasPrefix(c.Path, path+"[")
+}
+
+// Diff returns the values which differ between old and new, by their yaml
+// path such as configuration.nfStreams[1].topic.topicName. The
+// configuration holds references to secrets, never the secrets themselves.
+func Diff(old, new *Config) ([]Change, error) {
+	oldValues, err := flatten(old)
+	if err != nil {
+		return nil, err
+	}
+	newValues, err := flatten(new)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := slices.Collect(maps.Keys(oldValues))
+	for path := range newValues {
+		if _, ok := oldValues[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	slices.Sort(paths)
+
+	var changes []Change
+	for _, path := range paths {
+		if oldValues[path] != newValues[path] {
+			changes = append(changes, Change{Path: path, Old: oldValues[path], New: newValues[path]})
+		}
+	}
+	return changes, nil
+}
+
+// Merge returns base with the values at or below the yaml paths, such as
+// configuration.controller.maxRetries, taken from from. The structs on the
+// way to the paths are copied, base and from are left unchanged.
+func Merge(base, from *Config, paths []string) (*Config, error) {
+	merged := *base
+	for _, path := range paths {
+		err := copyPath(reflect.ValueOf(&merged).Elem(), reflect.ValueOf(from).Elem(), strings.Split(path, "."))
+		if err != nil {
+			return nil, fmt.Errorf("merge [%s]: %w", path, err)
+		}
+	}
+	return &merged, nil
+}
+
+func copyPath(dst, src reflect.Value, keys []string) error {
+	for len(keys) > 0 {
+		switch dst.Kind() {
+		case reflect.Ptr:
+			if dst.IsNil() || src.IsNil() {
+				dst.Set(src)
+				return nil
+			}
+			// dst points into a configuration which must not change
+			clone := reflect.New(dst.Type().Elem())
+			clone.Elem().Set(dst.Elem())
+			dst.Set(clone)
+			dst, src = dst.Elem(), src.Elem()
+		case reflect.Struct:
+			field, n, ok := structField(dst, keys, strings.EqualFold)
+			if !ok {
+				return fmt.Errorf("unknown key [%s]", keys[0])
+			}
+			srcField, _, _ := structField(src, keys, strings.EqualFold)
+			dst, src, keys = field, srcField, keys[n:]
+		default:
+			return fmt.Errorf("unknown key [%s]", keys[0])
+		}
+	}
+	dst.Set(src)
+	return nil
+}
+
+// flatten maps the yaml paths of cfg to their scalar values
+func flatten(cfg *Config) (map[string]string, error) {
+	content, err := yaml.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var tree any
+	if err := yaml.Unmarshal(content, &tree); err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	flattenNode(values, "", tree)
+	return values, nil
+}
+
+func flattenNode(values map[string]string, path string, node any) {
+	switch node := node.(type) {
+	case map[string]any:
+		for key, child := range node {
+			if path != "" {
+				key = path + "." + key
+			}
+			flattenNode(values, key, child)
+		}
+	case []any:
+		for i, child := range node {
+			flattenNode(values, fmt.Sprintf("%s[%d]", path, i), child)
+		}
+	case nil:
+	default:
+		values[path] = fmt.Sprint(node)
+	}
+}
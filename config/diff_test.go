@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	old := &Config{Logger: &Logger{LogLevel: "info"}, Configuration: &Configuration{
+		NfStreams:   []NFStream{{Topic: Topic{TopicName: "sdcore-data-source-smf"}}},
+		RocEndPoint: ServerAddr{Addr: "roc", Port: 8080},
+	}}
+	new := &Config{Logger: &Logger{LogLevel: "debug"}, Configuration: &Configuration{
+		NfStreams: []NFStream{
+			{Topic: Topic{TopicName: "sdcore-data-source-smf"}},
+			{Topic: Topic{TopicName: "sdcore-data-source-amf"}},
+		},
+		RocEndPoint: ServerAddr{Addr: "roc", Port: 8080, Tls: &TLS{CaFile: "/ca.pem"}},
+	}}
+
+	changes, err := Diff(old, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Change{
+		{Path: "configuration.nfStreams[1].topic.topicName", New: "sdcore-data-source-amf"},
+		{Path: "configuration.rocEndPoint.tls.caFile", New: "/ca.pem"},
+		{Path: "logger.level", Old: "info", New: "debug"},
+	}
+	if !slices.Equal(changes, want) {
+		t.Fatalf("got %v want %v", changes, want)
+	}
+	if !changes[0].Under("configuration.nfStreams") || changes[0].Under("configuration.nfStream") {
+		t.Fatal("unexpected path match")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	base := &Config{Info: &Info{HttpVersion: 2}, Logger: &Logger{LogLevel: "info"}, Configuration: &Configuration{
+		ApiServer:  ServerAddr{Port: 9301},
+		Controller: Controller{MaxRetries: 3, Workers: 4},
+	}}
+	from := &Config{Info: &Info{HttpVersion: 1}, Logger: &Logger{LogLevel: "debug"}, Configuration: &Configuration{
+		ApiServer:  ServerAddr{Port: 9302},
+		Controller: Controller{MaxRetries: 5, Workers: 8},
+	}}
+
+	merged, err := Merge(base, from, []string{"logger", "info.http-version", "configuration.controller.maxRetries"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.Logger.LogLevel != "debug" || merged.Info.HttpVersion != 1 ||
+		merged.Configuration.Controller.MaxRetries != 5 {
+		t.Errorf("merged %+v %+v %+v, want the values of the paths taken", merged.Logger, merged.Info,
+			merged.Configuration.Controller)
+	}
+	if merged.Configuration.ApiServer.Port != 9301 || merged.Configuration.Controller.Workers != 4 {
+		t.Errorf("merged %+v, want the other values kept", merged.Configuration)
+	}
+	if base.Info.HttpVersion != 2 || base.Configuration.Controller.MaxRetries != 3 {
+		t.Error("base changed by the merge")
+	}
+
+	if _, err := Merge(base, from, []string{"configuration.nothing"}); err == nil {
+		t.Error("expected the unknown path to be rejected")
+	}
+}
@@ -0,0 +1,258 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix starts the environment variables overriding configuration
+// values. The rest of the name is the yaml path in upper case with _ between
+// the keys and list indexes, the configuration section left out:
+// METRICFUNC_CFG_APISERVER_PORT, METRICFUNC_CFG_NFSTREAMS_0_TOPIC_TOPICNAME,
+// METRICFUNC_CFG_LOGGER_LEVEL. Unlike METRICFUNC_, it does not collide with
+// the METRICFUNC_SERVICE_HOST and METRICFUNC_PORT_* variables kubernetes
+// sets for a service named metricfunc.
+const EnvPrefix = "METRICFUNC_CFG_"
+
+// Overrides are applied over the configuration file in order: the pod ip,
+// the environment and the command line
+type Overrides struct {
+	// PodIp sets the address of the api and prometheus servers
+	PodIp string
+	// Env holds KEY=value pairs, only the EnvPrefix ones are used
+	Env []string
+	// Sets holds path=value pairs, the path as in the configuration file
+	// such as configuration.apiServer.port or logger.level
+	Sets []string
+}
+
+// apply sets the override values in cfg, reporting every value which could
+// not be set
+func (o *Overrides) apply(cfg *Config) error {
+	var errs []error
+	if o.PodIp != "" {
+		ip := net.ParseIP(o.PodIp)
+		if ip == nil {
+			errs = append(errs, fmt.Errorf("POD_IP: [%s] is not an ip address", o.PodIp))
+		} else {
+			cfg.Configuration.ApiServer.Addr = ip.String()
+			cfg.Configuration.PrometheusServer.Addr = ip.String()
+		}
+	}
+
+	// environment variables referenced by secrets may share the prefix
+	secretEnvs := make(map[string]bool)
+	walk(reflect.ValueOf(cfg), func(s *Secret) { secretEnvs[s.Env] = true })
+	for _, kv := range o.Env {
+		name, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(name, EnvPrefix) || secretEnvs[name] {
+			continue
+		}
+		if err := setEnv(cfg, strings.TrimPrefix(name, EnvPrefix), value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	for _, kv := range o.Sets {
+		path, value, ok := strings.Cut(kv, "=")
+		if !ok {
+			errs = append(errs, fmt.Errorf("-set %s: expected path=value", kv))
+			continue
+		}
+		if err := Set(cfg, path, value); err != nil {
+			errs = append(errs, fmt.Errorf("-set %s: %w", path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Set parses value into the configuration value at the yaml path, such as
+// configuration.nfStreams[0].urls[1].port. Lists grow to the index set.
+// Lists of strings and maps are set from comma separated items, the map
+// items as key=value.
+func Set(cfg *Config, path string, value string) error {
+	var keys []string
+	for key := range strings.SplitSeq(path, ".") {
+		name, rest, _ := strings.Cut(key, "[")
+		keys = append(keys, name)
+		for rest != "" {
+			index, after, ok := strings.Cut(rest, "]")
+			if !ok {
+				return fmt.Errorf("unbalanced [ in [%s]", path)
+			}
+			keys = append(keys, index)
+			rest = strings.TrimPrefix(after, "[")
+		}
+	}
+	return setPath(reflect.ValueOf(cfg).Elem(), keys, value, strings.EqualFold)
+}
+
+// setEnv sets the value at the path of an environment variable name, where
+// the keys are matched ignoring case and dashes
+func setEnv(cfg *Config, name, value string) error {
+	keys := strings.Split(strings.ToLower(name), "_")
+	if _, _, ok := structField(reflect.ValueOf(cfg).Elem(), keys, matchEnvKey); !ok {
+		// keys of the configuration section come without the section
+		keys = append([]string{"configuration"}, keys...)
+	}
+	return setPath(reflect.ValueOf(cfg).Elem(), keys, value, matchEnvKey)
+}
+
+func matchEnvKey(key, tag string) bool {
+	return strings.EqualFold(key, strings.ReplaceAll(tag, "-", "_"))
+}
+
+// structField finds the field of v named by the first keys, tags with a
+// dash or _ in their name span several keys. It returns the field and the
+// number of keys used.
+func structField(v reflect.Value, keys []string, match func(key, tag string) bool) (reflect.Value, int, bool) {
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}, 0, false
+	}
+	for i := range v.NumField() {
+		tag, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("yaml"), ",")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		for n := 1; n <= len(keys); n++ {
+			if match(strings.Join(keys[:n], "_"), tag) {
+				return v.Field(i), n, true
+			}
+		}
+	}
+	return reflect.Value{}, 0, false
+}
+
+func setPath(v reflect.Value, keys []string, value string, match func(key, tag string) bool) error {
+	for len(keys) > 0 {
+		switch v.Kind() {
+		case reflect.Ptr:
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+			continue
+		case reflect.Struct:
+			field, n, ok := structField(v, keys, match)
+			if !ok {
+				return fmt.Errorf("unknown key [%s]", keys[0])
+			}
+			v, keys = field, keys[n:]
+		case reflect.Slice:
+			index, err := strconv.Atoi(keys[0])
+			if err != nil || index < 0 {
+				return fmt.Errorf("[%s] is not a list index", keys[0])
+			}
+			if index >= v.Len() {
+				grown := reflect.MakeSlice(v.Type(), index+1, index+1)
+				reflect.Copy(grown, v)
+				v.Set(grown)
+			}
+			v, keys = v.Index(index), keys[1:]
+		case reflect.Map:
+			if v.IsNil() {
+				v.Set(reflect.MakeMap(v.Type()))
+			}
+			item := reflect.New(v.Type().Elem()).Elem()
+			if err := setValue(item, value); err != nil {
+				return err
+			}
+			v.SetMapIndex(reflect.ValueOf(strings.Join(keys, ".")), item)
+			return nil
+		default:
+			return fmt.Errorf("unknown key [%s]", keys[0])
+		}
+	}
+	return setValue(v, value)
+}
+
+func setValue(v reflect.Value, value string) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setValue(v.Elem(), value)
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("[%s] is not a boolean", value)
+		}
+		v.SetBool(b)
+	case reflect.Int:
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("[%s] is not an integer", value)
+		}
+		v.SetInt(int64(i))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("[%s] is not a number", value)
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return errors.New("set the items of the list by index")
+		}
+		var items []string
+		if value != "" {
+			items = strings.Split(value, ",")
+		}
+		v.Set(reflect.ValueOf(items))
+	case reflect.Map:
+		items := reflect.MakeMap(v.Type())
+		for item := range strings.SplitSeq(value, ",") {
+			key, val, ok := strings.Cut(item, "=")
+			if !ok {
+				return fmt.Errorf("map item [%s] is not key=value", item)
+			}
+			items.SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(val))
+		}
+		v.Set(items)
+	default:
+		return errors.New("set the keys of the section one by one")
+	}
+	return nil
+}
+
+// walk calls fn with every T of the configuration
+func walk[T any](v reflect.Value, fn func(*T)) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return
+		}
+		if t, ok := v.Interface().(*T); ok {
+			fn(t)
+			return
+		}
+		walk(v.Elem(), fn)
+	case reflect.Struct:
+		if v.CanAddr() {
+			if t, ok := v.Addr().Interface().(*T); ok {
+				fn(t)
+				return
+			}
+		}
+		for i := range v.NumField() {
+			if v.Type().Field(i).IsExported() {
+				walk(v.Field(i), fn)
+			}
+		}
+	case reflect.Slice:
+		for i := range v.Len() {
+			walk(v.Index(i), fn)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+const overridesConfig = `
+logger:
+  level: info
+configuration:
+  apiServer:
+    addr: metricfunc
+    port: 9301
+  prometheusServer:
+    port: 9089
+  rocEndPoint:
+    addr: roc
+    port: 8080
+    auth:
+      type: bearer
+      token:
+        env: METRICFUNC_CFG_ROC_TOKEN
+`
+
+func TestOverridesPrecedence(t *testing.T) {
+	cfg, err := Load(writeConfig(t, overridesConfig), Overrides{
+		PodIp: "fd00::17",
+		Env: []string{
+			"HOME=/root",
+			"METRICFUNC_CFG_ROC_TOKEN=secret",
+			"METRICFUNC_CFG_APISERVER_PORT=9400",
+			"METRICFUNC_CFG_PROMETHEUSSERVER_PORT=9090",
+			"METRICFUNC_CFG_LOGGER_LEVEL=debug",
+			"METRICFUNC_CFG_INFO_HTTP_VERSION=2",
+			"METRICFUNC_CFG_NFSTREAMS_0_TOPIC_TOPICNAME=sdcore-data-source-amf",
+			"METRICFUNC_CFG_NFSTREAMS_0_URLS_0_URI=kafka",
+			"METRICFUNC_CFG_NFSTREAMS_0_URLS_0_PORT=9092",
+		},
+		Sets: []string{
+			"configuration.prometheusServer.port=9100",
+			"configuration.auditLog.kafkaUrls=a:9092,b:9092",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := cfg.Configuration
+	if c.ApiServer.Addr != "fd00::17" || c.PrometheusServer.Addr != "fd00::17" {
+		t.Errorf("pod ip not applied: %q", c.ApiServer.Addr)
+	}
+	if c.ApiServer.Port != 9400 || c.PrometheusServer.Port != 9100 {
+		t.Errorf("unexpected ports %d %d", c.ApiServer.Port, c.PrometheusServer.Port)
+	}
+	if cfg.Logger.LogLevel != "debug" || cfg.Info.HttpVersion != 2 {
+		t.Errorf("unexpected sections %+v %+v", cfg.Logger, cfg.Info)
+	}
+	if len(c.NfStreams) != 1 || c.NfStreams[0].Urls[0].Port != 9092 {
+		t.Errorf("unexpected streams %+v", c.NfStreams)
+	}
+	if len(c.AuditLog.KafkaUrls) != 2 {
+		t.Errorf("unexpected kafka urls %v", c.AuditLog.KafkaUrls)
+	}
+}
+
+func TestOverridesIgnoreServiceLinks(t *testing.T) {
+	// set by kubernetes in the pods of a namespace with a metricfunc service
+	cfg, err := Load(writeConfig(t, overridesConfig), Overrides{Env: []string{
+		"METRICFUNC_SERVICE_HOST=10.0.0.1",
+		"METRICFUNC_SERVICE_PORT=9301",
+		"METRICFUNC_PORT=tcp://10.0.0.1:9301",
+		"METRICFUNC_PORT_9301_TCP=tcp://10.0.0.1:9301",
+		"METRICFUNC_PORT_9301_TCP_PORT=9301",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port := cfg.Configuration.ApiServer.Port; port != 9301 {
+		t.Errorf("api server port = %d, want the one of the file", port)
+	}
+}
+
+func TestOverridesRejected(t *testing.T) {
+	_, err := Load(writeConfig(t, overridesConfig), Overrides{
+		PodIp: "not-an-ip",
+		Env:   []string{"METRICFUNC_CFG_APISERVER_PROT=9400", "METRICFUNC_CFG_APISERVER_PORT=high"},
+		Sets:  []string{"configuration.nfStreams[x].topic.topicName=a", "logger"},
+	})
+	if err == nil {
+		t.Fatal("expected the overrides to be rejected")
+	}
+	for _, want := range []string{
+		"POD_IP: [not-an-ip]",
+		"METRICFUNC_CFG_APISERVER_PROT: unknown key [prot]",
+		"METRICFUNC_CFG_APISERVER_PORT: [high] is not an integer",
+		"[x] is not a list index",
+		"-set logger: expected path=value",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing problem %q in:\n%v", want, err)
+		}
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg, err := Load(writeConfig(t, overridesConfig), Overrides{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := Redacted(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]string)
+	flattenNode(values, "", tree)
+	if values["configuration.rocEndPoint.auth.token.env"] != redacted {
+		t.Fatalf("secret not redacted: %v", values)
+	}
+	if values["configuration.rocEndPoint.addr"] != "roc" {
+		t.Fatalf("unexpected value %q", values["configuration.rocEndPoint.addr"])
+	}
+	if cfg.Configuration.RocEndPoint.Auth.Token.Env != "METRICFUNC_CFG_ROC_TOKEN" {
+		t.Fatal("configuration modified by the redaction")
+	}
+}
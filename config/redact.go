@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"reflect"
+
+	"go.yaml.in/yaml/v4"
+)
+
+const redacted = "<redacted>"
+
+// Redacted returns the configuration as a tree of yaml keys, such as for
+// the api. The files and environment variables holding secrets and the user
+// names are redacted.
+func Redacted(cfg *Config) (any, error) {
+	content, err := yaml.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	clone := &Config{}
+	if err := yaml.Unmarshal(content, clone); err != nil {
+		return nil, err
+	}
+
+	walk(reflect.ValueOf(clone), func(s *Secret) {
+		s.File = redact(s.File)
+		s.Env = redact(s.Env)
+	})
+	walk(reflect.ValueOf(clone), func(a *Auth) {
+		a.Username = redact(a.Username)
+	})
+
+	if content, err = yaml.Marshal(clone); err != nil {
+		return nil, err
+	}
+	var tree any
+	if err := yaml.Unmarshal(content, &tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+func redact(value string) string {
+	if value == "" {
+		return ""
+	}
+	return redacted
+}
@@ -0,0 +1,473 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+
+	"go.uber.org/zap/zapcore"
+	"go.yaml.in/yaml/v4"
+)
+
+// DefaultShutdownTimeout stays below the default termination grace period
+// of kubernetes, in seconds
+const DefaultShutdownTimeout = 20
+
+// values accepted by the consumers of the configuration, kept here as the
+// consumers import this package
+var (
+	topicNames    = []string{"sdcore-data-source-smf", "sdcore-data-source-amf"}
+	provisioners  = []string{"roc", "webui"}
+	schemes       = []string{"", "http", "https"}
+	authTypes     = []string{"bearer", "oauth2", "basic", "apikey"}
+	roles         = []string{"observer", "operator"}
+	privacyModes  = []string{"", "clear", "hash", "truncate"}
+	clientAuths   = []string{"", "require", "verifyIfGiven"}
+	httpVersions  = []int{0, 1, 2}
+	logCategories = []string{"ApiServer", "App", "Cache", "Controller", "Gin", "Prometheus", "Trace"}
+	logEncodings  = []string{"", "console", "json"}
+	exporters     = []string{"", "otlp", "stdout"}
+	nfProbeTypes  = []string{"http", "tcp", "sctp", "nrf"}
+	// labelName is a prometheus label name
+	labelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// metricsPrivacyModes leave truncate out, truncated identities of distinct
+// subscribers would share a series
+var metricsPrivacyModes = []string{"", "clear", "hash"}
+
+const (
+	maxPort        = 65535
+	maxBudgetRatio = 1.0
+)
+
+// Load reads the configuration file, rejecting unknown keys, applies the
+// overrides and the defaults and validates the result. All problems are
+// reported at once.
+func Load(path string, overrides Overrides) (*Config, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	var errs []error
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			// syntax errors leave nothing to validate
+			return nil, err
+		}
+		// unknown keys and type mismatches, decoding went on with the rest
+		for _, msg := range typeErr.Errors {
+			errs = append(errs, errors.New(msg))
+		}
+	}
+
+	cfg.addSections()
+	if err := overrides.apply(cfg); err != nil {
+		errs = append(errs, err)
+	}
+	cfg.SetDefaults()
+	if err := cfg.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return cfg, nil
+}
+
+// addSections adds the sections missing from the configuration file
+func (c *Config) addSections() {
+	if c.Info == nil {
+		c.Info = &Info{}
+	}
+	if c.Logger == nil {
+		c.Logger = &Logger{}
+	}
+	if c.Configuration == nil {
+		c.Configuration = &Configuration{}
+	}
+}
+
+// SetDefaults fills the missing sections and the values whose zero value is
+// not usable
+func (c *Config) SetDefaults() {
+	c.addSections()
+	if c.Logger.LogLevel == "" {
+		c.Logger.LogLevel = "info"
+	}
+
+	cfg := c.Configuration
+	if cfg.ShutdownTimeout == 0 {
+		cfg.ShutdownTimeout = DefaultShutdownTimeout
+	}
+	if cfg.Provisioner == "" {
+		cfg.Provisioner = "roc"
+	}
+	if cfg.AnalyticsStream != nil && cfg.AnalyticsStream.TopicName == "" {
+		cfg.AnalyticsStream.TopicName = cfg.AnalyticsStream.Topic
+	}
+}
+
+// problems collects the validation errors with the path of the offending
+// key
+type problems []error
+
+func (p *problems) add(path, format string, args ...any) {
+	*p = append(*p, fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...)))
+}
+
+func (p *problems) oneOf(path string, value any, allowed any) {
+	p.add(path, "[%v] is not one of %v", value, allowed)
+}
+
+func (p *problems) port(path string, port int, required bool) {
+	switch {
+	case port == 0 && required:
+		p.add(path, "required")
+	case port < 0 || port > maxPort:
+		p.add(path, "[%d] is not a port between 1 and %d", port, maxPort)
+	}
+}
+
+func (p *problems) notNegative(path string, value int) {
+	if value < 0 {
+		p.add(path, "[%d] must not be negative", value)
+	}
+}
+
+func (p *problems) secret(path string, s *Secret) {
+	switch {
+	case s == nil:
+		p.add(path, "required")
+	case s.File == "" && s.Env == "":
+		p.add(path, "set file or env")
+	case s.File != "" && s.Env != "":
+		p.add(path, "set only one of file or env")
+	}
+}
+
+func (p *problems) tls(path string, t *TLS, server bool) {
+	if t == nil {
+		return
+	}
+	switch {
+	case server && (t.CertFile == "" || t.KeyFile == ""):
+		p.add(path, "certFile and keyFile are required to serve tls")
+	case (t.CertFile == "") != (t.KeyFile == ""):
+		p.add(path, "certFile and keyFile go together")
+	}
+	if !slices.Contains(clientAuths, t.ClientAuth) {
+		p.oneOf(path+".clientAuth", t.ClientAuth, clientAuths[1:])
+	}
+	if t.ClientAuth != "" && t.CaFile == "" {
+		p.add(path+".clientAuth", "requires a caFile to verify the client certificates")
+	}
+}
+
+// server checks a server of metricfunc
+func (p *problems) server(path string, s *ServerAddr, required bool) {
+	p.port(path+".port", s.Port, required)
+	p.tls(path+".tls", s.Tls, true)
+}
+
+// endPoint checks an upstream of metricfunc
+func (p *problems) endPoint(path string, e *ServerAddr) {
+	if e.Addr == "" {
+		p.add(path+".addr", "required")
+	}
+	p.port(path+".port", e.Port, true)
+	p.notNegative(path+".pollInterval", e.PollInterval)
+	if !slices.Contains(schemes, e.Scheme) {
+		p.oneOf(path+".scheme", e.Scheme, schemes[1:])
+	}
+	p.tls(path+".tls", e.Tls, false)
+	p.auth(path+".auth", e.Auth)
+}
+
+func (p *problems) auth(path string, a *Auth) {
+	if a == nil {
+		return
+	}
+	switch a.Type {
+	case "bearer":
+		p.secret(path+".token", a.Token)
+	case "basic":
+		if a.Username == "" {
+			p.add(path+".username", "required")
+		}
+		p.secret(path+".password", a.Password)
+	case "apikey":
+		p.secret(path+".apiKey", a.ApiKey)
+	case "oauth2":
+		if a.TokenUrl == "" {
+			p.add(path+".tokenUrl", "required")
+		}
+		if a.ClientId == "" {
+			p.add(path+".clientId", "required")
+		}
+		p.secret(path+".clientSecret", a.ClientSecret)
+		p.tls(path+".tls", a.Tls, false)
+	default:
+		p.oneOf(path+".type", a.Type, authTypes)
+	}
+}
+
+func (p *problems) role(path, role string) {
+	if !slices.Contains(roles, role) {
+		p.oneOf(path, role, roles)
+	}
+}
+
+func (p *problems) apiServerAuth(path string, a *ApiServerAuth, apiServer *ServerAddr) {
+	if a == nil {
+		return
+	}
+	for i, token := range a.Tokens {
+		tokenPath := fmt.Sprintf("%s.tokens[%d]", path, i)
+		if token.Name == "" {
+			p.add(tokenPath+".name", "required")
+		}
+		p.secret(tokenPath+".token", token.Token)
+		p.role(tokenPath+".role", token.Role)
+	}
+	if a.Jwt != nil {
+		if (a.Jwt.HmacSecret == nil) == (a.Jwt.PublicKeyFile == "") {
+			p.add(path+".jwt", "set one of hmacSecret or publicKeyFile")
+		}
+		if a.Jwt.HmacSecret != nil {
+			p.secret(path+".jwt.hmacSecret", a.Jwt.HmacSecret)
+		}
+		for _, value := range slices.Sorted(maps.Keys(a.Jwt.Roles)) {
+			p.role(fmt.Sprintf("%s.jwt.roles[%s]", path, value), a.Jwt.Roles[value])
+		}
+	}
+	for i, cert := range a.ClientCerts {
+		certPath := fmt.Sprintf("%s.clientCerts[%d]", path, i)
+		if cert.CommonName == "" {
+			p.add(certPath+".commonName", "required")
+		}
+		p.role(certPath+".role", cert.Role)
+	}
+	if len(a.ClientCerts) > 0 && (apiServer.Tls == nil || apiServer.Tls.CaFile == "") {
+		p.add(path+".clientCerts", "requires apiServer.tls with a caFile")
+	}
+}
+
+func (p *problems) privacy(path string, priv *Privacy) {
+	if priv == nil {
+		return
+	}
+	hash := false
+	for _, channel := range []struct {
+		name, mode string
+		allowed    []string
+	}{
+		{"logs", priv.Logs, privacyModes},
+		{"metrics", priv.Metrics, metricsPrivacyModes},
+		{"api.observer", priv.Api.Observer, privacyModes},
+		{"api.operator", priv.Api.Operator, privacyModes},
+	} {
+		if !slices.Contains(channel.allowed, channel.mode) {
+			p.oneOf(path+"."+channel.name, channel.mode, channel.allowed[1:])
+		}
+		hash = hash || channel.mode == "hash"
+	}
+	if hash || priv.HashKey != nil {
+		p.secret(path+".hashKey", priv.HashKey)
+	}
+}
+
+func (p *problems) controller(path string, c *Controller) {
+	p.notNegative(path+".workers", c.Workers)
+	p.notNegative(path+".queueSize", c.QueueSize)
+	p.notNegative(path+".maxRetries", c.MaxRetries)
+	p.notNegative(path+".pendingReportTimeout", c.PendingReportTimeout)
+	p.notNegative(path+".ipLeaseRetention", c.IpLeaseRetention)
+
+	u := &c.Upstream
+	p.notNegative(path+".upstream.maxAttempts", u.MaxAttempts)
+	p.notNegative(path+".upstream.attemptTimeout", u.AttemptTimeout)
+	p.notNegative(path+".upstream.backoffBase", u.BackoffBase)
+	p.notNegative(path+".upstream.backoffMax", u.BackoffMax)
+	p.notNegative(path+".upstream.failureThreshold", u.FailureThreshold)
+	p.notNegative(path+".upstream.openTimeout", u.OpenTimeout)
+	if u.BackoffMax > 0 && u.BackoffBase > u.BackoffMax {
+		p.add(path+".upstream.backoffBase", "[%d] exceeds backoffMax [%d]", u.BackoffBase, u.BackoffMax)
+	}
+	if u.RetryBudgetRatio < 0 || u.RetryBudgetRatio > maxBudgetRatio {
+		p.add(path+".upstream.retryBudgetRatio", "[%v] is not between 0 and %v", u.RetryBudgetRatio, maxBudgetRatio)
+	}
+}
+
+func (p *problems) auditLog(path string, a *AuditLog) {
+	if a == nil || !a.Enable {
+		return
+	}
+	if a.Path == "" && len(a.KafkaUrls) == 0 {
+		p.add(path, "enabled without a path or kafkaUrls")
+	}
+	p.notNegative(path+".maxSize", a.MaxSize)
+	if len(a.KafkaUrls) > 0 && a.KafkaTopic == "" {
+		p.add(path+".kafkaTopic", "required with kafkaUrls")
+	}
+}
+
+func (p *problems) logger(path string, l *Logger) {
+	if _, err := zapcore.ParseLevel(l.LogLevel); err != nil {
+		p.add(path+".level", "%v", err)
+	}
+	for _, category := range slices.Sorted(maps.Keys(l.Categories)) {
+		if !slices.Contains(logCategories, category) {
+			p.oneOf(path+".categories", category, logCategories)
+		} else if _, err := zapcore.ParseLevel(l.Categories[category]); err != nil {
+			p.add(path+".categories."+category, "%v", err)
+		}
+	}
+	if !slices.Contains(logEncodings, l.Encoding) {
+		p.oneOf(path+".encoding", l.Encoding, logEncodings[1:])
+	}
+	if l.File != nil {
+		if l.File.Path == "" {
+			p.add(path+".file.path", "required")
+		}
+		p.notNegative(path+".file.maxSize", l.File.MaxSize)
+		p.notNegative(path+".file.maxBackups", l.File.MaxBackups)
+		p.notNegative(path+".file.maxAge", l.File.MaxAge)
+	}
+	if s := l.Sampling; s != nil {
+		p.notNegative(path+".sampling.initial", s.Initial)
+		p.notNegative(path+".sampling.thereafter", s.Thereafter)
+		if s.Initial == 0 && s.Thereafter == 0 {
+			p.add(path+".sampling", "initial or thereafter required, no debug line would be written")
+		}
+	}
+}
+
+func (p *problems) tracing(path string, t *Tracing) {
+	if t == nil || !t.Enable {
+		return
+	}
+	if !slices.Contains(exporters, t.Exporter) {
+		p.oneOf(path+".exporter", t.Exporter, exporters[1:])
+	}
+	if t.SampleRatio < 0 || t.SampleRatio > 1 {
+		p.add(path+".sampleRatio", "[%v] is not between 0 and 1", t.SampleRatio)
+	}
+}
+
+func (p *problems) metricsPush(path string, m *MetricsPush) {
+	if m == nil {
+		return
+	}
+	if m.RemoteWrite == nil && m.Otlp == nil {
+		p.add(path, "remoteWrite or otlp required")
+	}
+	p.notNegative(path+".interval", m.Interval)
+	p.notNegative(path+".batchSize", m.BatchSize)
+	p.notNegative(path+".bufferSize", m.BufferSize)
+	for _, name := range slices.Sorted(maps.Keys(m.ExternalLabels)) {
+		if !labelName.MatchString(name) {
+			p.add(path+".externalLabels", "[%s] is not a label name", name)
+		}
+	}
+	if m.RemoteWrite != nil {
+		p.endPoint(path+".remoteWrite", m.RemoteWrite)
+	}
+	if m.Otlp != nil {
+		p.endPoint(path+".otlp", m.Otlp)
+	}
+}
+
+func (p *problems) nfProbes(path string, n *NfProbes) {
+	if n == nil {
+		return
+	}
+	p.notNegative(path+".interval", n.Interval)
+	p.notNegative(path+".timeout", n.Timeout)
+	for i, target := range n.Targets {
+		targetPath := fmt.Sprintf("%s.targets[%d]", path, i)
+		if target.NfName == "" {
+			p.add(targetPath+".nfName", "required")
+		}
+		if !slices.Contains(nfProbeTypes, target.Type) {
+			p.oneOf(targetPath+".type", target.Type, nfProbeTypes)
+		}
+		if target.Type == "nrf" && target.NfType == "" {
+			p.add(targetPath+".nfType", "required to look the nf up in the NRF")
+		}
+		p.endPoint(targetPath+".endPoint", &target.EndPoint)
+	}
+}
+
+// Validate reports all problems of the configuration at once, SetDefaults
+// has to be called first
+func (c *Config) Validate() error {
+	var p problems
+	if !slices.Contains(httpVersions, c.Info.HttpVersion) {
+		p.oneOf("info.http-version", c.Info.HttpVersion, httpVersions[1:])
+	}
+	p.logger("logger", c.Logger)
+
+	cfg := c.Configuration
+	for i, stream := range cfg.NfStreams {
+		path := fmt.Sprintf("configuration.nfStreams[%d]", i)
+		if !slices.Contains(topicNames, stream.Topic.TopicName) {
+			p.oneOf(path+".topic.topicName", stream.Topic.TopicName, topicNames)
+		}
+		if len(stream.Urls) == 0 {
+			p.add(path+".urls", "at least one broker required")
+		}
+		for j, url := range stream.Urls {
+			if url.Uri == "" {
+				p.add(fmt.Sprintf("%s.urls[%d].uri", path, j), "required")
+			}
+			p.port(fmt.Sprintf("%s.urls[%d].port", path, j), url.Port, true)
+		}
+	}
+
+	p.server("configuration.apiServer", &cfg.ApiServer, true)
+	p.apiServerAuth("configuration.apiServerAuth", cfg.ApiServerAuth, &cfg.ApiServer)
+	p.server("configuration.prometheusServer", &cfg.PrometheusServer, true)
+	p.server("configuration.debugProfileServer", &cfg.DebugProfile, false)
+	p.apiServerAuth("configuration.debugProfileServerAuth", cfg.DebugProfileAuth, &cfg.DebugProfile)
+	if !slices.Contains(provisioners, cfg.Provisioner) {
+		p.oneOf("configuration.provisioner", cfg.Provisioner, provisioners)
+	}
+	if cfg.ControllerFlag {
+		p.endPoint("configuration.userAppApiServer", &cfg.UserAppApiServer)
+		if cfg.Provisioner == "webui" {
+			p.endPoint("configuration.webuiEndPoint", &cfg.WebuiEndPoint)
+		} else {
+			p.endPoint("configuration.rocEndPoint", &cfg.RocEndPoint)
+		}
+		p.controller("configuration.controller", &cfg.Controller)
+		p.auditLog("configuration.auditLog", cfg.AuditLog)
+	}
+	p.privacy("configuration.privacy", cfg.Privacy)
+	p.notNegative("configuration.shutdownTimeout", cfg.ShutdownTimeout)
+	p.notNegative("configuration.nfStatusTimeout", cfg.NfStatusTimeout)
+	p.tracing("configuration.tracing", cfg.Tracing)
+	p.metricsPush("configuration.metricsPush", cfg.MetricsPush)
+	p.nfProbes("configuration.nfProbes", cfg.NfProbes)
+	if cfg.NrfEndPoint != nil {
+		p.endPoint("configuration.nrfEndPoint", cfg.NrfEndPoint)
+	} else if len(cfg.NrfNfTypes) != 0 {
+		p.add("configuration.nrfNfTypes", "requires the nrfEndPoint")
+	}
+
+	return errors.Join(p...)
+}
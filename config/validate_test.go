@@ -0,0 +1,152 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadSample(t *testing.T) {
+	cfg, err := Load("config.yaml", Overrides{})
+	if err != nil {
+		t.Fatalf("sample configuration rejected: %v", err)
+	}
+	if cfg.Configuration.ShutdownTimeout != 20 || cfg.Configuration.Provisioner != "roc" {
+		t.Fatalf("unexpected configuration %+v", cfg.Configuration)
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load(writeConfig(t, `
+configuration:
+  apiServer:
+    port: 9301
+  prometheusServer:
+    port: 9089
+`), Overrides{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Info == nil || cfg.Logger.LogLevel != "info" ||
+		cfg.Configuration.ShutdownTimeout != DefaultShutdownTimeout {
+		t.Fatalf("defaults not applied: %+v %+v", cfg.Logger, cfg.Configuration)
+	}
+}
+
+func TestLoadReportsAllProblems(t *testing.T) {
+	_, err := Load(writeConfig(t, `
+logger:
+  level: loud
+  categories:
+    Kafka: debug
+  encoding: xml
+  sampling: {}
+configuration:
+  controllerFlag: true
+  unknownKey: 1
+  apiServer:
+    port: 70000
+  prometheusServer:
+    port: 9089
+    tls:
+      certFile: /tls.crt
+  debugProfileServer:
+    port: 5001
+  debugProfileServerAuth:
+    tokens:
+      - name: admin
+        role: admin
+  rocEndPoint:
+    addr: roc
+    port: 8080
+    auth:
+      type: bearer
+  privacy:
+    logs: hash
+    metrics: truncate
+  metricsPush:
+    externalLabels:
+      site-name: edge1
+  nrfNfTypes: [AMF]
+  nfProbes:
+    targets:
+      - nfName: amf1
+        type: icmp
+        endPoint:
+          addr: amf
+          port: 29518
+      - nfName: smf1
+        type: nrf
+        endPoint:
+          addr: nrf
+  tracing:
+    enable: true
+    exporter: jaeger
+    sampleRatio: 2
+`), Overrides{})
+	if err == nil {
+		t.Fatal("expected the configuration to be rejected")
+	}
+	for _, want := range []string{
+		"field unknownKey not found",
+		"logger.level",
+		"logger.categories: [Kafka]",
+		"logger.encoding: [xml]",
+		"logger.sampling: initial or thereafter required",
+		"configuration.apiServer.port: [70000]",
+		"configuration.prometheusServer.tls: certFile and keyFile are required",
+		"configuration.debugProfileServerAuth.tokens[0].token: required",
+		"configuration.debugProfileServerAuth.tokens[0].role: [admin]",
+		"configuration.userAppApiServer.addr: required",
+		"configuration.rocEndPoint.auth.token: required",
+		"configuration.privacy.metrics: [truncate] is not one of [clear hash]",
+		"configuration.privacy.hashKey: required",
+		"configuration.metricsPush: remoteWrite or otlp required",
+		"configuration.metricsPush.externalLabels: [site-name] is not a label name",
+		"configuration.nfProbes.targets[0].type: [icmp] is not one of",
+		"configuration.nfProbes.targets[1].nfType: required",
+		"configuration.nfProbes.targets[1].endPoint.port: required",
+		"configuration.nrfNfTypes: requires the nrfEndPoint",
+		"configuration.tracing.exporter: [jaeger]",
+		"configuration.tracing.sampleRatio: [2]",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing problem %q in:\n%v", want, err)
+		}
+	}
+}
+
+func TestValidateControllerProvisioner(t *testing.T) {
+	cfg := &Config{Configuration: &Configuration{
+		ApiServer:        ServerAddr{Port: 9301},
+		PrometheusServer: ServerAddr{Port: 9089},
+		ControllerFlag:   true,
+		UserAppApiServer: ServerAddr{Addr: "user-app", Port: 9301},
+		Provisioner:      "webui",
+		RocEndPoint:      ServerAddr{Addr: "roc", Port: 8080},
+	}}
+	cfg.SetDefaults()
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "configuration.webuiEndPoint.addr: required") {
+		t.Fatalf("expected the webui endpoint to be required, got %v", err)
+	}
+
+	cfg.Configuration.Provisioner = "roc"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
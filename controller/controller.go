@@ -5,379 +5,463 @@
 package controller
 
 import (
-	"bytes"
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net"
 	"net/http"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/omec-project/metricfunc/config"
+	"github.com/omec-project/metricfunc/internal/audit"
+	"github.com/omec-project/metricfunc/internal/credentials"
 	"github.com/omec-project/metricfunc/internal/metricdata"
+	"github.com/omec-project/metricfunc/internal/privacy"
 	"github.com/omec-project/metricfunc/internal/promclient"
+	"github.com/omec-project/metricfunc/internal/subtrace"
+	"github.com/omec-project/metricfunc/internal/tlsconfig"
+	"github.com/omec-project/metricfunc/internal/tracing"
 	"github.com/omec-project/metricfunc/logger"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/net/http2"
 )
 
+const provisionRequestTimeout = 10 * time.Second
+
+// ErrNotEnabled is returned for requests to a controller which is not running
+var ErrNotEnabled = errors.New("controller not enabled")
+
 var (
 	ControllerConfig config.Config
-	client           *http.Client
+	pending          *pendingReports
+	queue            *workQueue
+	// background is the context of the provisioner refresh and pending
+	// report expiry, stopBackground ends it
+	background     context.Context
+	stopBackground context.CancelFunc
+	backgroundWg   sync.WaitGroup
 )
 
-// creating for testing
-var RogueChannel chan RogueIPs
-
-type Targets struct {
-	EnterpriseId string `yaml:"name,omitempty" json:"name,omitempty"`
-}
 type RogueIPs struct {
 	IpAddresses []string `yaml:"ipaddresses,omitempty" json:"ipaddresses,omitempty"`
+	// Timestamp is when the rogue traffic was observed, the time of receipt if unset
+	Timestamp time.Time `yaml:"timestamp,omitempty" json:"timestamp,omitzero"`
+	// Source is the origin of the report, recorded in the audit log
+	Source string `yaml:"-" json:"-"`
 }
-type UserAppService struct {
-	UserAppServiceUrl string   `yaml:"userAppServiceUrl,omitempty" json:"userAppServiceUrl,omitempty"`
-	PollInterval      int      `yaml:"pollInterval,omitempty" json:"pollInterval,omitempty"`
-	RogueIPs          RogueIPs `yaml:"rogueips,omitempty" json:"rogueips,omitempty"`
-}
 
-type RocService struct {
-	RocServiceUrl string     `yaml:"rocServiceUrl,omitempty" json:"rocServiceUrl,omitempty"`
-	SiteInfo      []SiteInfo `yaml:"site-info,omitempty" json:"site-info,omitempty"`
+// newUpstreamHttpClient returns an http client for the endpoint, using TLS
+// when the endpoint scheme is https and sending the configured credentials.
+// It has no timeout of its own, the deadline of each attempt is set by the
+// httpclient wrapping it
+func newUpstreamHttpClient(endPoint *config.ServerAddr, httpVersion int) (*http.Client, error) {
+	tlsCfg, err := tlsconfig.Client(endPoint.Tls)
+	if err != nil {
+		return nil, err
+	}
+	secure := tlsconfig.Scheme(endPoint) == "https"
+
+	var transport http.RoundTripper
+	if httpVersion == 2 {
+		h2 := &http2.Transport{TLSClientConfig: tlsCfg}
+		if !secure {
+			// h2c, prior knowledge HTTP/2 over cleartext
+			h2.AllowHTTP = true
+			h2.DialTLSContext = func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			}
+		}
+		transport = h2
+	} else {
+		h1 := http.DefaultTransport.(*http.Transport).Clone()
+		h1.TLSClientConfig = tlsCfg
+		transport = h1
+	}
+
+	tokenClient, err := credentials.TokenClient(endPoint.Auth)
+	if err != nil {
+		return nil, err
+	}
+	tokenClient.Transport = tracing.Transport(tokenClient.Transport)
+	provider, err := credentials.New(endPoint.Auth, tokenClient)
+	if err != nil {
+		return nil, fmt.Errorf("auth: %w", err)
+	}
+
+	return &http.Client{
+		Transport: tracing.Transport(audit.Transport(credentials.Transport(transport, provider))),
+	}, nil
 }
 
-type SimCard struct {
-	SimId       string `yaml:"sim-id,omitempty" json:"sim-id,omitempty"`
-	Imsi        string `yaml:"imsi,omitempty" json:"imsi,omitempty"`
-	DisplayName string `yaml:"display-name,omitempty" json:"display-name,omitempty"`
-	Enable      *bool  `yaml:"enable,omitempty" json:"enable,omitempty"`
+// setDefaults fills the controller settings left unset
+func setDefaults(cfg *config.Configuration) {
+	if cfg.UserAppApiServer.PollInterval == 0 {
+		cfg.UserAppApiServer.PollInterval = 30
+	}
+	cfg.UserAppApiServer.Addr = strings.TrimSpace(cfg.UserAppApiServer.Addr)
+	cfg.RocEndPoint.Addr = strings.TrimSpace(cfg.RocEndPoint.Addr)
+	if cfg.RocEndPoint.PollInterval == 0 {
+		cfg.RocEndPoint.PollInterval = 60
+	}
+	cfg.WebuiEndPoint.Addr = strings.TrimSpace(cfg.WebuiEndPoint.Addr)
+
+	controllerCfg := &cfg.Controller
+	if controllerCfg.PendingReportTimeout == 0 {
+		controllerCfg.PendingReportTimeout = 600
+	}
+	if controllerCfg.Workers == 0 {
+		controllerCfg.Workers = 4
+	}
+	if controllerCfg.QueueSize == 0 {
+		controllerCfg.QueueSize = 100
+	}
+	if controllerCfg.MaxRetries == 0 {
+		controllerCfg.MaxRetries = 3
+	}
 }
-type SiteInfo struct {
-	SiteId         string    `yaml:"site-id,omitempty" json:"site-id,omitempty"`
-	SimCardDetails []SimCard `yaml:"sim-card,omitempty" json:"sim-card,omitempty"`
+
+func logEndPoints(cfg *config.Configuration) {
+	logger.ControllerLog.Infof("api server endpoint: %v:%v, pollInterval [%v]s",
+		cfg.UserAppApiServer.Addr, cfg.UserAppApiServer.Port, cfg.UserAppApiServer.PollInterval)
+	logger.ControllerLog.Infof("roc endpoint: %v:%v, simcard cache refresh interval [%v]s",
+		cfg.RocEndPoint.Addr, cfg.RocEndPoint.Port, cfg.RocEndPoint.PollInterval)
+	logger.ControllerLog.Infof("subscriber provisioner: %v", cfg.Provisioner)
 }
 
 func InitControllerConfig(CConfig *config.Config) error {
 	ControllerConfig = *CConfig
+	// the defaults stay out of the configuration of the caller
+	configuration := *CConfig.Configuration
+	ControllerConfig.Configuration = &configuration
 	// Read provided config
 	logger.ControllerLog.Infoln("controller configuration")
 
-	// set http client
-	if ControllerConfig.Info.HttpVersion == 2 {
-		client = &http.Client{
-			Transport: &http2.Transport{
-				AllowHTTP: true,
-				DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
-					return net.Dial(network, addr)
-				},
-			},
-			Timeout: 5 * time.Second,
-		}
-	} else {
-		client = &http.Client{
-			Timeout: 5 * time.Second,
-		}
-	}
-
-	if ControllerConfig.Configuration.UserAppApiServer.PollInterval == 0 {
-		ControllerConfig.Configuration.UserAppApiServer.PollInterval = 30
+	if err := audit.Init(ControllerConfig.Configuration.AuditLog); err != nil {
+		return err
 	}
 
-	addr := ControllerConfig.Configuration.UserAppApiServer.Addr
-	ControllerConfig.Configuration.UserAppApiServer.Addr = strings.TrimSpace(addr)
-	logger.ControllerLog.Infof(
-		"api server endpoint: %v:%v",
-		ControllerConfig.Configuration.UserAppApiServer.Addr,
-		ControllerConfig.Configuration.UserAppApiServer.Port,
-	)
-	logger.ControllerLog.Infoln("pollInterval", ControllerConfig.Configuration.UserAppApiServer.PollInterval)
+	setDefaults(ControllerConfig.Configuration)
+	logEndPoints(ControllerConfig.Configuration)
 
-	ControllerConfig.Configuration.RocEndPoint.Addr = strings.TrimSpace(ControllerConfig.Configuration.RocEndPoint.Addr)
-	logger.ControllerLog.Infof(
-		"roc endpoint: %v:%v",
-		ControllerConfig.Configuration.RocEndPoint.Addr,
-		ControllerConfig.Configuration.RocEndPoint.Port,
-	)
+	controllerCfg := &ControllerConfig.Configuration.Controller
+	queue = newWorkQueue(controllerCfg.QueueSize, controllerCfg.Workers, controllerCfg.MaxRetries)
+	pending = newPendingReports(time.Duration(controllerCfg.PendingReportTimeout) * time.Second)
+	metricdata.SetIpLeaseRetention(time.Duration(controllerCfg.IpLeaseRetention) * time.Second)
+	logger.ControllerLog.Infof("pending report timeout [%v]s, ip lease retention [%v]s",
+		controllerCfg.PendingReportTimeout, controllerCfg.IpLeaseRetention)
 
+	u, err := newUpstreams(ControllerConfig.Configuration, ControllerConfig.Info.HttpVersion)
+	if err != nil {
+		return err
+	}
+	active.Store(u)
 	return nil
 }
 
-func getNextBackoffInterval(retry, interval uint) uint {
-	mFactor := 1.5
-	nextInterval := float64(retry*interval) * mFactor
-
-	if nextInterval > 10 {
-		return 10
+func validateIPs(ips RogueIPs) (validIps RogueIPs) {
+	validIps.Timestamp = ips.Timestamp
+	validIps.Source = ips.Source
+	for _, ip := range ips.IpAddresses {
+		if net.ParseIP(ip) == nil {
+			logger.ControllerLog.Errorf("userAppApp response received with IP Address: %s - Invalid",
+				privacy.IpAddr(privacy.Logs, ip))
+			continue
+		}
+		validIps.IpAddresses = append(validIps.IpAddresses, ip)
 	}
-
-	return uint(nextInterval)
+	logger.ControllerLog.Debugf("rogueIPs [%v] received from userAppApp",
+		privacy.IpAddrs(privacy.Logs, validIps.IpAddresses))
+	return validIps
 }
 
-func sendHttpReqMsgWithoutRetry(req *http.Request) (*http.Response, error) {
-	rsp, err := client.Do(req)
+func fetchRogueIPs(ctx context.Context, u *upstreams) (RogueIPs, error) {
+	var rogueIPs RogueIPs
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.userAppUrl, nil)
 	if err != nil {
-		logger.ControllerLog.Errorf("http req send error [%+v]", err)
-		return nil, err
+		return rogueIPs, err
 	}
-
-	if rsp.StatusCode == http.StatusAccepted ||
-		rsp.StatusCode == http.StatusOK || rsp.StatusCode == http.StatusNoContent ||
-		rsp.StatusCode == http.StatusCreated {
-		logger.ControllerLog.Infoln("successful response from peer:", http.StatusText(rsp.StatusCode))
-		return rsp, nil
-	} else {
-		logger.ControllerLog.Errorf("http rsp error [%v]", http.StatusText(rsp.StatusCode))
-		err := rsp.Body.Close()
-		if err != nil {
+	rsp, err := u.userApp.Do(req)
+	if err != nil {
+		return rogueIPs, err
+	}
+	defer func() {
+		if err := rsp.Body.Close(); err != nil {
 			logger.ControllerLog.Warnf("body close error: %v", err)
 		}
+	}()
 
-		return nil, fmt.Errorf("error response: %v", http.StatusText(rsp.StatusCode))
+	if rsp.StatusCode < http.StatusOK || rsp.StatusCode >= http.StatusMultipleChoices {
+		return rogueIPs, fmt.Errorf("http rsp error [%v]", http.StatusText(rsp.StatusCode))
 	}
+	if err := json.NewDecoder(rsp.Body).Decode(&rogueIPs); err != nil {
+		return rogueIPs, fmt.Errorf("userAppApp response body decode failed: %w", err)
+	}
+	return rogueIPs, nil
 }
 
-func sendHttpReqMsg(req *http.Request) (*http.Response, error) {
-	// Keep sending request to http server until response is success
-	var retries uint = 0
-	var body []byte
-	var err error
-	if req.Body != nil {
-		body, err = io.ReadAll(req.Body)
-		if err != nil {
-			logger.ControllerLog.Warnf("error reading body: %v", err)
-		}
-	}
+// GetRogueIPs polls the user-app service until ctx is done, following the
+// url and poll interval of the configuration reloads
+func GetRogueIPs(ctx context.Context) error {
+	logger.ControllerLog.Infoln("userAppApp Url:", active.Load().userAppUrl)
 	for {
-		cloneReq := req.Clone(context.Background())
-		req.Body = io.NopCloser(bytes.NewReader(body))
-		cloneReq.Body = io.NopCloser(bytes.NewReader(body))
-		rsp, err := client.Do(cloneReq)
-		retries += 1
+		// a poll, retries included, never overruns the poll interval
+		u := active.Load()
+		spanCtx, span := tracing.Tracer().Start(ctx, "controller poll user-app")
+		pollCtx, cancel := context.WithTimeout(spanCtx, u.pollInterval)
+		rogueIPs, err := fetchRogueIPs(pollCtx, u)
+		cancel()
 		if err != nil {
-			nextInterval := getNextBackoffInterval(retries, 2)
-			logger.ControllerLog.Warnf("http req send error [%+v], retrying after %v sec...", err, nextInterval)
-			time.Sleep(time.Second * time.Duration(nextInterval))
-			continue
-		}
-
-		if rsp.StatusCode == http.StatusAccepted ||
-			rsp.StatusCode == http.StatusOK || rsp.StatusCode == http.StatusNoContent ||
-			rsp.StatusCode == http.StatusCreated {
-			logger.ControllerLog.Infoln("get config from peer success")
-			err := req.Body.Close()
-			if err != nil {
-				logger.ControllerLog.Warnf("body close error: %v", err)
-			}
-
-			return rsp, nil
+			logger.ControllerLog.Errorf("get message [%v] returned error [%+v]", u.userAppUrl, err)
 		} else {
-			nextInterval := getNextBackoffInterval(retries, 2)
-			logger.ControllerLog.Warnf(
-				"http rsp error [%v], retrying after [%v] sec...",
-				http.StatusText(rsp.StatusCode),
-				nextInterval,
-			)
-			err := rsp.Body.Close()
-			if err != nil {
-				logger.ControllerLog.Warnf("body close error: %v", err)
+			logger.ControllerLog.Infoln("received rogueIPs from userAppApp:",
+				privacy.IpAddrs(privacy.Logs, rogueIPs.IpAddresses))
+			rogueIPs.Source = "user-app"
+			ips := validateIPs(rogueIPs)
+			// wait for room in the queue, which holds off the next poll
+			for _, t := range newReportTasks(spanCtx, ips) {
+				if err := queue.push(ctx, t); err != nil {
+					logger.ControllerLog.Errorf("queue rogueIP [%v] failed: %v", privacy.IpAddr(privacy.Logs, t.ipAddr), err)
+				}
 			}
+		}
+		tracing.End(span, err)
 
-			time.Sleep(time.Second * time.Duration(nextInterval))
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(u.pollInterval):
 		}
 	}
 }
 
-func validateIPs(ips RogueIPs) (validIps RogueIPs) {
-	for _, ip := range ips.IpAddresses {
-		if net.ParseIP(ip) == nil {
-			logger.ControllerLog.Errorf("userAppApp response received with IP Address: %s - Invalid", ip)
-			continue
+// disableSubscriber disables the imsi through the configured provisioner
+func disableSubscriber(ctx context.Context, provisioner SubscriberProvisioner, reportId, imsi string) error {
+	ctx, cancel := context.WithTimeout(ctx, provisionRequestTimeout)
+	defer cancel()
+	return provisioner.DisableSubscriber(audit.WithReport(ctx, reportId, imsi), imsi)
+}
+
+// resolveImsi returns the imsi which held the ip address when the rogue
+// traffic was observed. If nobody held it then, the last holder is used
+// provided the address has not been handed out since and was released
+// within the pending report timeout.
+func resolveImsi(ipaddr string, observed time.Time) (string, error) {
+	// get IP to imsi mapping from metricfunc
+	if subscriberInfo, err := metricdata.GetSubscriberImsiFromIpAddr(ipaddr); err == nil {
+		return subscriberInfo.Imsi, nil
+	}
+	imsi, err := metricdata.GetImsiFromIpAddrAt(ipaddr, observed)
+	if err == nil {
+		return imsi, nil
+	}
+	history := metricdata.GetIpLeaseHistory(ipaddr)
+	if n := len(history); n != 0 {
+		last := history[n-1]
+		if !last.End.IsZero() && last.End.Before(observed) && observed.Sub(last.End) <= pending.timeout {
+			return last.Imsi, nil
 		}
-		validIps.IpAddresses = append(validIps.IpAddresses, ip)
 	}
-	logger.ControllerLog.Debugf("rogueIPs [%v] received from userAppApp", validIps.IpAddresses)
-	return validIps
+	return "", err
 }
 
-func (userAppClient *UserAppService) GetRogueIPs(rogueIPChannel chan RogueIPs) {
-	userAppServerApi := userAppClient.UserAppServiceUrl
-	logger.ControllerLog.Infoln("userAppApp Url:", userAppServerApi)
-	req, err := http.NewRequest(http.MethodGet, userAppServerApi, nil)
+// handleRogueIP attributes the report to a subscriber, parking it in the
+// pending reports when that is not possible yet. It returns whether the
+// report is ready for enforcement.
+func handleRogueIP(t *task) bool {
+	audit.Add(audit.Record{Type: audit.EventRogueIpReport, ReportId: t.reportId, Source: t.source, IpAddr: t.ipAddr})
+
+	imsi, err := resolveImsi(t.ipAddr, t.observed)
 	if err != nil {
-		logger.ControllerLog.Errorln("an error occurred", err)
-		return
+		logger.ControllerLog.Warnf("subscriber of ip-addr [%v] not known yet, report [%v] pending: %v",
+			privacy.IpAddr(privacy.Logs, t.ipAddr), t.reportId, err)
+		audit.Add(audit.Record{
+			Type: audit.EventImsiResolution, ReportId: t.reportId, IpAddr: t.ipAddr, Error: err.Error(),
+		})
+		pending.add(pendingReport{
+			reportId: t.reportId, source: t.source, ipAddr: t.ipAddr, reported: t.observed, span: t.span,
+		})
+		subtrace.Record("controller", subtrace.Ids{IpAddr: t.ipAddr},
+			"rogue ip report from ["+t.source+"] pending, subscriber not known yet", traceDetails(t))
+		recordOutcome(t, "pending", nil)
+		return false
 	}
+	logger.ControllerLog.Infof("subscriber Imsi [%v] of the IP: [%v]",
+		privacy.Imsi(privacy.Logs, imsi), privacy.IpAddr(privacy.Logs, t.ipAddr))
+	audit.Add(audit.Record{Type: audit.EventImsiResolution, ReportId: t.reportId, IpAddr: t.ipAddr, Imsi: imsi})
+	t.imsi = imsi
+	subtrace.Record("controller", subtrace.Ids{Imsi: imsi, IpAddr: t.ipAddr},
+		"rogue ip report from ["+t.source+"] attributed to the subscriber", traceDetails(t))
+	return true
+}
 
-	for {
-		rsp, httpErr := sendHttpReqMsg(req)
-		if httpErr != nil {
-			logger.ControllerLog.Errorf("get message [%v] returned error [%+v]", userAppServerApi, err)
-			time.Sleep(10 * time.Second)
-			continue
-		}
-
-		var rogueIPs RogueIPs
-		if rsp != nil {
-			if rsp.Body != nil {
-				err := json.NewDecoder(rsp.Body).Decode(&rogueIPs)
-				if err != nil {
-					logger.ControllerLog.Errorln("userAppApp response body decode failed:", err)
-				} else {
-					logger.ControllerLog.Infoln("received rogueIPs from userAppApp:", rogueIPs)
-					ips := validateIPs(rogueIPs)
-					if len(ips.IpAddresses) > 0 {
-						// writing rogueIPs into channel
-						rogueIPChannel <- ips
-					}
-				}
-			} else {
-				logger.ControllerLog.Infoln("http response body from userAppApp is empty")
-			}
-		}
+func traceDetails(t *task) map[string]string {
+	return map[string]string{"report-id": t.reportId, "observed": t.observed.Format(time.RFC3339)}
+}
 
-		time.Sleep(time.Duration(userAppClient.PollInterval) * time.Second)
+func enforce(ctx context.Context, t *task) error {
+	provisioner := active.Load().provisioner
+	decision := "disable-subscriber via " + provisioner.Name()
+	audit.Add(audit.Record{
+		Type: audit.EventPolicyDecision, ReportId: t.reportId, IpAddr: t.ipAddr, Imsi: t.imsi, Decision: decision,
+	})
+
+	if err := disableSubscriber(ctx, provisioner, t.reportId, t.imsi); err != nil {
+		promclient.PushViolSubData(t.imsi, t.ipAddr, "Active")
+		logger.ControllerLog.Errorf("disable subscriber [%v] through [%v] failed: %v",
+			privacy.Imsi(privacy.Logs, t.imsi), provisioner.Name(), err)
+		// the error may carry the upstream url or body, kept out of the
+		// message like the other details
+		details := traceDetails(t)
+		details["error"] = err.Error()
+		subtrace.Record("controller", subtrace.Ids{Imsi: t.imsi, IpAddr: t.ipAddr},
+			"disable subscriber through ["+provisioner.Name()+"] failed", details)
+		return err
 	}
+	promclient.PushViolSubData(t.imsi, t.ipAddr, "Resolved")
+	subtrace.Record("controller", subtrace.Ids{Imsi: t.imsi, IpAddr: t.ipAddr},
+		"subscriber disabled through ["+provisioner.Name()+"]", traceDetails(t))
+	return nil
 }
 
-func (rocClient *RocService) GetTargets() (names []Targets) {
-	rocTargetsApi := rocClient.RocServiceUrl + "/aether-roc-api/targets"
-	req, err := http.NewRequest(http.MethodGet, rocTargetsApi, nil)
+func recordOutcome(t *task, outcome string, err error) {
+	promclient.IncrementControllerOutcome(outcome)
+	r := audit.Record{Type: audit.EventOutcome, ReportId: t.reportId, IpAddr: t.ipAddr, Imsi: t.imsi, Outcome: outcome}
 	if err != nil {
-		logger.ControllerLog.Errorf("get targets request error occurred %v", err)
-		return
-	}
-	rsp, httpErr := sendHttpReqMsgWithoutRetry(req)
-	if httpErr != nil {
-		logger.ControllerLog.Errorf("get message [%v] returned error [%v]", rocTargetsApi, httpErr.Error())
-		return
-	}
-
-	if rsp != nil {
-		if rsp.Body != nil {
-			err := json.NewDecoder(rsp.Body).Decode(&names)
-			if err != nil {
-				logger.ControllerLog.Errorln("unable to decode Targets:", err)
-			} else {
-				logger.ControllerLog.Infoln("get targets received from RoC:", names)
-			}
-		} else {
-			logger.ControllerLog.Errorln("get targets http response body is empty")
-		}
-	} else {
-		logger.ControllerLog.Errorln("get targets http response is empty")
+		r.Error = err.Error()
 	}
-	return
+	audit.Add(r)
 }
 
-func (rocClient *RocService) DisableSimcard(targets []Targets, imsi string) {
-	for _, target := range targets {
-		rocSiteApi := rocClient.RocServiceUrl + "/aether-roc-api/aether/v2.1.x/" + target.EnterpriseId + "/site"
-		req, err := http.NewRequest(http.MethodGet, rocSiteApi, nil)
-		if err != nil {
-			logger.ControllerLog.Errorf("GetSiteInfo request error occurred %v", err)
-			return
+// onIpLease resolves the pending reports of an ip address as soon as the
+// subscriber session which held that address at the time of the report is seen
+func onIpLease(lease metricdata.IpLease) {
+	for _, r := range pending.take(lease.IpAddr, lease.Start) {
+		logger.ControllerLog.Infof("pending report [%v] of ip-addr [%v] resolved to imsi [%v]",
+			r.reportId, privacy.IpAddr(privacy.Logs, r.ipAddr), privacy.Imsi(privacy.Logs, lease.Imsi))
+		audit.Add(audit.Record{
+			Type: audit.EventImsiResolution, ReportId: r.reportId, IpAddr: r.ipAddr, Imsi: lease.Imsi,
+		})
+		t := &task{
+			kind:     taskEnforce,
+			reportId: r.reportId,
+			source:   r.source,
+			ipAddr:   r.ipAddr,
+			imsi:     lease.Imsi,
+			observed: r.reported,
+			span:     r.span,
 		}
-		rsp, httpErr := sendHttpReqMsgWithoutRetry(req)
-		if httpErr != nil {
-			logger.ControllerLog.Errorf("GetSiteInfo message [%v] returned error [%v]", rocSiteApi, httpErr.Error())
-			continue
+		// called from the kafka reader, so never wait for room in the queue
+		if err := queue.tryPush(t); err != nil {
+			recordOutcome(t, "failed", err)
 		}
-		var siteInfo []SiteInfo
-		if rsp != nil {
-			if rsp.Body != nil {
-				err := json.NewDecoder(rsp.Body).Decode(&siteInfo)
-				if err != nil {
-					logger.ControllerLog.Errorln("unable to decode SiteInfo:", err)
-				} else {
-					logger.ControllerLog.Infoln("GetSiteInfo received from RoC:", siteInfo)
-				}
-
-				b, err := io.ReadAll(rsp.Body)
-				if err != nil {
-					logger.ControllerLog.Warnf("error reading body: %v", err)
-				}
+	}
+}
 
-				logger.ControllerLog.Infof("SimDetails received from RoC: %s", string(b))
-			} else {
-				logger.ControllerLog.Errorln("GetSiteInfo http response body is empty")
-				continue
+func expirePendingReports(ctx context.Context) {
+	ticker := time.NewTicker(pending.timeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, r := range pending.expire(now) {
+				logger.ControllerLog.Warnf("report [%v] of ip-addr [%v] expired without a subscriber",
+					r.reportId, privacy.IpAddr(privacy.Logs, r.ipAddr))
+				recordOutcome(&task{reportId: r.reportId, ipAddr: r.ipAddr}, "unresolved", nil)
 			}
-		} else {
-			logger.ControllerLog.Errorln("GetSiteInfo http response is empty")
-			continue
 		}
+	}
+}
 
-		var rocDisableSimCard *SimCard
-		for _, siteInfo := range siteInfo {
-			for _, simCard := range siteInfo.SimCardDetails {
-				imsi = strings.TrimPrefix(imsi, "imsi-")
-				if simCard.Imsi == imsi {
-					logger.ControllerLog.Infof("SimCard %v details found in site [%v]", imsi, siteInfo.SiteId)
-					rocDisableSimCard = &simCard
-					break
-				}
-			}
-			if rocDisableSimCard != nil {
-				rocDisableImsiApi := rocSiteApi + "/" + siteInfo.SiteId + "/sim-card/" + rocDisableSimCard.SimId
-				var val bool
-				rocDisableSimCard.Enable = &val
-				b, err := json.Marshal(&rocDisableSimCard)
-				if err != nil {
-					logger.ControllerLog.Warnf("error marshalling imsi %v: %v", rocDisableSimCard.Imsi, err)
-				}
-
-				reqMsgBody := bytes.NewBuffer(b)
-				logger.ControllerLog.Debugln("rest API to disable imsi:", rocDisableImsiApi)
-				logger.ControllerLog.Debugln("post msg body:", reqMsgBody)
+// newReportTasks returns the tasks of the reported ips, traced as part of
+// the trace of ctx
+func newReportTasks(ctx context.Context, rogueIPs RogueIPs) []*task {
+	observed := rogueIPs.Timestamp
+	if observed.IsZero() {
+		observed = time.Now()
+	}
+	tasks := make([]*task, 0, len(rogueIPs.IpAddresses))
+	for _, ipaddr := range rogueIPs.IpAddresses {
+		tasks = append(tasks, &task{
+			kind:     taskReport,
+			reportId: audit.NewReportId(),
+			source:   rogueIPs.Source,
+			ipAddr:   ipaddr,
+			observed: observed,
+			span:     trace.SpanContextFromContext(ctx),
+		})
+	}
+	return tasks
+}
 
-				req, err := http.NewRequest(http.MethodPost, rocDisableImsiApi, reqMsgBody)
-				if err != nil {
-					logger.ControllerLog.Warnf("error with new request: %v", err)
-				}
+// SubmitRogueIPs queues the reported ips without waiting. When the queue
+// has no room for all of them none is queued, failing with ErrQueueFull, so
+// that the sender can report them again.
+func SubmitRogueIPs(ctx context.Context, rogueIPs RogueIPs) error {
+	if queue == nil {
+		return ErrNotEnabled
+	}
+	rogueIPs = validateIPs(rogueIPs)
+	return queue.tryPushAll(newReportTasks(ctx, rogueIPs))
+}
 
-				req.Header.Set("Content-Type", "application/json; charset=utf-8")
-				_, httpErr := sendHttpReqMsgWithoutRetry(req)
-				if httpErr != nil {
-					logger.ControllerLog.Errorf("post message [%v] returned error [%v]", rocDisableImsiApi, httpErr.Error())
-				}
-				return
-			}
-		}
+// EnableSubscriber re-enables a subscriber disabled by the controller, on
+// behalf of source. The webui provisioner knows the device groups to add
+// the subscriber back to only for the subscribers it disabled since
+// metricfunc started, others are enabled in the webui itself.
+func EnableSubscriber(ctx context.Context, imsi, source string) error {
+	u := active.Load()
+	if u == nil {
+		return ErrNotEnabled
+	}
+	provisioner := u.provisioner
+	t := &task{reportId: audit.NewReportId(), source: source, imsi: imsi}
+	audit.Add(audit.Record{
+		Type: audit.EventPolicyDecision, ReportId: t.reportId, Source: source, Imsi: imsi,
+		Decision: "enable-subscriber via " + provisioner.Name(),
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, provisionRequestTimeout)
+	defer cancel()
+	if err := provisioner.EnableSubscriber(audit.WithReport(ctx, t.reportId, imsi), imsi); err != nil {
+		logger.ControllerLog.Errorf("enable subscriber [%v] through [%v] failed: %v",
+			privacy.Imsi(privacy.Logs, imsi), provisioner.Name(), err)
+		recordOutcome(t, "failed", err)
+		return err
 	}
+	logger.ControllerLog.Infof("subscriber [%v] enabled by [%v]", privacy.Imsi(privacy.Logs, imsi), source)
+	recordOutcome(t, "enabled", nil)
+	return nil
+}
 
-	logger.ControllerLog.Warnf("imsi details not found in Targets and SiteInfo: [%v]", imsi)
+// RogueIPHandler starts the controller workers
+func RogueIPHandler() {
+	background, stopBackground = context.WithCancel(context.Background())
+	activate(active.Load())
+	backgroundWg.Go(func() { expirePendingReports(background) })
+	metricdata.AddIpLeaseObserver(onIpLease)
+	queue.start()
 }
 
-func RogueIPHandler(rogueIPChannel chan RogueIPs) {
-	addr := ControllerConfig.Configuration.RocEndPoint.Addr
-	port := ControllerConfig.Configuration.RocEndPoint.Port
-	rocClient := RocService{
-		RocServiceUrl: "http://" + addr + ":" + strconv.Itoa(port),
+// Shutdown stops accepting rogue ips, finishes the queued ones and flushes
+// the audit log, giving up when ctx is done
+func Shutdown(ctx context.Context) error {
+	if queue == nil {
+		return nil
 	}
-
-	for rogueIPs := range rogueIPChannel {
-		for _, ipaddr := range rogueIPs.IpAddresses {
-			// get IP to imsi mapping from metricfunc
-			subscriberInfo, err := metricdata.GetSubscriberImsiFromIpAddr(ipaddr)
-			if err != nil {
-				logger.ControllerLog.Errorln("subscriber details doesn't exist with imsi", err)
-				continue
-			}
-			logger.ControllerLog.Infof("subscriber Imsi [%v] of the IP: [%v]", subscriberInfo.Imsi, ipaddr)
-			// get enterprises or targets from ROC
-			targets := rocClient.GetTargets()
-
-			if len(targets) == 0 {
-				promclient.PushViolSubData(subscriberInfo.Imsi, ipaddr, "Active")
-				logger.ControllerLog.Errorln("get targets returns nil")
-			} else {
-				// get siteinfo from ROC
-				promclient.PushViolSubData(subscriberInfo.Imsi, ipaddr, "Resolved")
-				rocClient.DisableSimcard(targets, subscriberInfo.Imsi)
-			}
-		}
+	err := queue.stop(ctx)
+	if stopBackground != nil {
+		stopBackground()
+		backgroundWg.Wait()
+	}
+	if auditErr := audit.Close(); auditErr != nil {
+		err = errors.Join(err, fmt.Errorf("close audit log: %w", auditErr))
 	}
+	return err
 }
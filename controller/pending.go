@@ -0,0 +1,98 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// pendingReport is a rogue ip report which could not be attributed to a
+// subscriber yet
+type pendingReport struct {
+	reportId string
+	source   string
+	ipAddr   string
+	reported time.Time
+	span     trace.SpanContext
+}
+
+// leaseGrace is how long after a report a lease may start and still be
+// attributed to it, allowing for clock skew between the reporter and the nf
+const leaseGrace = 5 * time.Second
+
+// pendingReports holds unresolved reports until a subscriber session with
+// the reported ip address shows up or the timeout expires
+type pendingReports struct {
+	lock    sync.Mutex
+	timeout time.Duration
+	reports map[string][]pendingReport // ip-addr is key
+}
+
+func newPendingReports(timeout time.Duration) *pendingReports {
+	return &pendingReports{
+		timeout: timeout,
+		reports: make(map[string][]pendingReport),
+	}
+}
+
+func (p *pendingReports) add(r pendingReport) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.reports[r.ipAddr] = append(p.reports[r.ipAddr], r)
+}
+
+// take removes and returns the reports of the ip address made while a lease
+// started at start was held. Reports made before the lease started belong to
+// an earlier holder or to no one, so they are left to expire unresolved
+func (p *pendingReports) take(ipAddr string, start time.Time) []pendingReport {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	reports, ok := p.reports[ipAddr]
+	if !ok {
+		return nil
+	}
+
+	var taken []pendingReport
+	kept := reports[:0]
+	for _, r := range reports {
+		if !start.After(r.reported.Add(leaseGrace)) {
+			taken = append(taken, r)
+		} else {
+			kept = append(kept, r)
+		}
+	}
+	if len(kept) == 0 {
+		delete(p.reports, ipAddr)
+	} else {
+		p.reports[ipAddr] = kept
+	}
+	return taken
+}
+
+// expire removes and returns the reports older than the timeout
+func (p *pendingReports) expire(now time.Time) []pendingReport {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	var expired []pendingReport
+	for ipAddr, reports := range p.reports {
+		kept := reports[:0]
+		for _, r := range reports {
+			if now.Sub(r.reported) > p.timeout {
+				expired = append(expired, r)
+			} else {
+				kept = append(kept, r)
+			}
+		}
+		if len(kept) == 0 {
+			delete(p.reports, ipAddr)
+		} else {
+			p.reports[ipAddr] = kept
+		}
+	}
+	return expired
+}
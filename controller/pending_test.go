@@ -0,0 +1,34 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package controller
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPendingReportsTakeLeaseHolder(t *testing.T) {
+	reported := time.Now()
+	p := newPendingReports(time.Minute)
+	p.add(pendingReport{reportId: "r1", ipAddr: "10.0.0.1", reported: reported})
+
+	// a lease started after the report belongs to a later holder
+	if taken := p.take("10.0.0.1", reported.Add(leaseGrace+time.Second)); len(taken) != 0 {
+		t.Fatalf("report taken by a lease started after it: %+v", taken)
+	}
+	if expired := p.expire(reported.Add(2 * time.Minute)); len(expired) != 1 || expired[0].reportId != "r1" {
+		t.Fatalf("expired %+v, want the report left unresolved", expired)
+	}
+
+	p.add(pendingReport{reportId: "r2", ipAddr: "10.0.0.1", reported: reported})
+	p.add(pendingReport{reportId: "r3", ipAddr: "10.0.0.1", reported: reported.Add(-time.Hour)})
+	taken := p.take("10.0.0.1", reported.Add(-time.Minute))
+	if len(taken) != 1 || taken[0].reportId != "r2" {
+		t.Fatalf("taken %+v, want the report made while the lease was held", taken)
+	}
+	if taken := p.take("10.0.0.1", reported.Add(time.Second)); len(taken) != 0 {
+		t.Fatalf("report taken twice: %+v", taken)
+	}
+}
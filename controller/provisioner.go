@@ -0,0 +1,331 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omec-project/metricfunc/config"
+	"github.com/omec-project/metricfunc/internal/httpclient"
+	"github.com/omec-project/metricfunc/internal/privacy"
+	"github.com/omec-project/metricfunc/internal/roc"
+	"github.com/omec-project/metricfunc/internal/tlsconfig"
+	"github.com/omec-project/metricfunc/internal/webui"
+	"github.com/omec-project/metricfunc/logger"
+)
+
+const (
+	ProvisionerRoc   = "roc"
+	ProvisionerWebui = "webui"
+)
+
+// SubscriberProvisioner enforces controller decisions in the system which
+// owns the subscriber configuration
+type SubscriberProvisioner interface {
+	// Name returns the provisioner type
+	Name() string
+	// Start runs background work such as cache refreshes until ctx is done
+	Start(ctx context.Context)
+	// DisableSubscriber stops the imsi from attaching to the network
+	DisableSubscriber(ctx context.Context, imsi string) error
+	// EnableSubscriber reverts a previous DisableSubscriber
+	EnableSubscriber(ctx context.Context, imsi string) error
+}
+
+// stateCarrier is a provisioner which takes over the state of the
+// provisioner it replaces on a configuration reload
+type stateCarrier interface {
+	carryOver(previous SubscriberProvisioner)
+}
+
+// newProvisioner returns the provisioner selected in the configuration and
+// its health checks
+func newProvisioner(cfg *config.Configuration, httpVersion int) (SubscriberProvisioner, []upstreamCheck, error) {
+	client, err := newProvisionerClient(cfg, httpVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+	p, checks := provisionerWith(cfg, client)
+	return p, checks, nil
+}
+
+// selectedEndPoint returns the endpoint of the provisioner selected
+func selectedEndPoint(cfg *config.Configuration) config.ServerAddr {
+	if cfg.Provisioner == ProvisionerWebui {
+		return cfg.WebuiEndPoint
+	}
+	return cfg.RocEndPoint
+}
+
+// newProvisionerClient returns the client of the endpoint of the provisioner
+// selected
+func newProvisionerClient(cfg *config.Configuration, httpVersion int) (*httpclient.Client, error) {
+	name := cfg.Provisioner
+	switch name {
+	case "":
+		name = ProvisionerRoc
+	case ProvisionerRoc, ProvisionerWebui:
+	default:
+		return nil, fmt.Errorf("unknown provisioner [%s]", cfg.Provisioner)
+	}
+
+	endPoint := selectedEndPoint(cfg)
+	httpClient, err := newUpstreamHttpClient(&endPoint, httpVersion)
+	if err != nil {
+		return nil, fmt.Errorf("provisioner client: %w", err)
+	}
+	return httpclient.New(name, httpClient, upstreamOptions(&cfg.Controller.Upstream)), nil
+}
+
+// provisionerWith returns the provisioner selected, calling its endpoint
+// through client, and its health checks
+func provisionerWith(cfg *config.Configuration, client *httpclient.Client) (SubscriberProvisioner, []upstreamCheck) {
+	if cfg.Provisioner == ProvisionerWebui {
+		checks := []upstreamCheck{{name: "upstream " + ProvisionerWebui, check: client.Check}}
+		return newWebuiProvisioner(cfg.WebuiEndPoint, client), checks
+	}
+	p := newRocProvisioner(cfg.RocEndPoint, client)
+	checks := []upstreamCheck{
+		{name: "upstream " + ProvisionerRoc, check: client.Check},
+		{name: "roc sim card cache", check: p.checkSimCards},
+	}
+	return p, checks
+}
+
+func upstreamOptions(policy *config.UpstreamPolicy) httpclient.Options {
+	return httpclient.Options{
+		MaxAttempts:      policy.MaxAttempts,
+		AttemptTimeout:   time.Duration(policy.AttemptTimeout) * time.Second,
+		BackoffBase:      time.Duration(policy.BackoffBase) * time.Millisecond,
+		BackoffMax:       time.Duration(policy.BackoffMax) * time.Millisecond,
+		RetryBudgetRatio: policy.RetryBudgetRatio,
+		FailureThreshold: policy.FailureThreshold,
+		OpenTimeout:      time.Duration(policy.OpenTimeout) * time.Second,
+	}
+}
+
+// EndPointUrl returns the base url of the endpoint
+func EndPointUrl(endPoint config.ServerAddr) string {
+	host := net.JoinHostPort(endPoint.Addr, strconv.Itoa(endPoint.Port))
+	return tlsconfig.Scheme(&endPoint) + "://" + host + endPoint.Path
+}
+
+func normaliseImsi(imsi string) string {
+	return strings.TrimPrefix(imsi, "imsi-")
+}
+
+// rocProvisioner toggles the enable flag of the sim card in Aether ROC
+type rocProvisioner struct {
+	client   *roc.Client
+	simCards *roc.SimCardCache
+}
+
+func newRocProvisioner(endPoint config.ServerAddr, httpClient roc.Doer) *rocProvisioner {
+	client := roc.NewClient(EndPointUrl(endPoint), httpClient)
+	return &rocProvisioner{
+		client:   client,
+		simCards: roc.NewSimCardCache(client, time.Duration(endPoint.PollInterval)*time.Second),
+	}
+}
+
+func (p *rocProvisioner) Name() string {
+	return ProvisionerRoc
+}
+
+// checkSimCards reports the sim card cache down until it is loaded, later
+// refresh failures only age the cache. It is not critical: while ROC is out
+// of reach the rest of metricfunc serves on, only the enforcements fail.
+func (p *rocProvisioner) checkSimCards(context.Context) (string, error) {
+	updated := p.simCards.Updated()
+	if updated.IsZero() {
+		return "", errors.New("not loaded yet")
+	}
+	return fmt.Sprintf("%d sim cards, refreshed %s ago", p.simCards.Len(),
+		time.Since(updated).Round(time.Second)), nil
+}
+
+func (p *rocProvisioner) Start(ctx context.Context) {
+	p.simCards.Run(ctx)
+}
+
+// carryOver starts from the sim cards of the previous provisioner, keeping
+// metricfunc ready while the new cache loads
+func (p *rocProvisioner) carryOver(previous SubscriberProvisioner) {
+	if prev, ok := previous.(*rocProvisioner); ok {
+		p.simCards.Seed(prev.simCards)
+	}
+}
+
+func (p *rocProvisioner) setSimCardEnable(ctx context.Context, imsi string, enable bool) error {
+	loc, err := p.simCards.Lookup(ctx, imsi)
+	if err != nil {
+		return err
+	}
+	logger.ControllerLog.Infof("simcard [%v] of imsi [%v] found in enterprise [%v] site [%v]",
+		loc.SimId, privacy.Imsi(privacy.Logs, imsi), loc.Enterprise, loc.SiteId)
+
+	if err := p.client.SetSimCardEnable(ctx, loc, enable); err != nil {
+		var statusErr *roc.StatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+			// the sim card moved or was removed since the last refresh
+			p.simCards.Invalidate(imsi)
+		}
+		return err
+	}
+	return nil
+}
+
+func (p *rocProvisioner) DisableSubscriber(ctx context.Context, imsi string) error {
+	return p.setSimCardEnable(ctx, imsi, false)
+}
+
+func (p *rocProvisioner) EnableSubscriber(ctx context.Context, imsi string) error {
+	return p.setSimCardEnable(ctx, imsi, true)
+}
+
+// webuiProvisioner removes the imsi from its device group in the SD-Core
+// webui, which withdraws the subscriber from the network slice. The device
+// groups are remembered in memory, a restart forgets them.
+type webuiProvisioner struct {
+	client  *webui.Client
+	removed *removedGroups
+}
+
+// removedGroups are the device groups the disabled imsis were removed from,
+// imsi is key. They are shared with the provisioners replacing this one on
+// a reload, tasks in flight included.
+type removedGroups struct {
+	lock   sync.Mutex
+	groups map[string][]string
+	// update serialises the read-modify-write of the device groups, which
+	// hold the imsis of many subscribers
+	update sync.Mutex
+}
+
+func newWebuiProvisioner(endPoint config.ServerAddr, httpClient webui.Doer) *webuiProvisioner {
+	return &webuiProvisioner{
+		client:  webui.NewClient(EndPointUrl(endPoint), httpClient),
+		removed: &removedGroups{groups: make(map[string][]string)},
+	}
+}
+
+func (p *webuiProvisioner) Name() string {
+	return ProvisionerWebui
+}
+
+func (p *webuiProvisioner) Start(ctx context.Context) {
+}
+
+// carryOver keeps the device groups the previous provisioner removed the
+// disabled imsis from
+func (p *webuiProvisioner) carryOver(previous SubscriberProvisioner) {
+	if prev, ok := previous.(*webuiProvisioner); ok {
+		p.removed = prev.removed
+	}
+}
+
+// putDeviceGroup writes the device group back and reads it again to confirm
+// whether the imsi is a member of it
+func (p *webuiProvisioner) putDeviceGroup(ctx context.Context, deviceGroup *webui.DeviceGroup, imsi string,
+	member bool,
+) error {
+	name := deviceGroup.DeviceGroupName
+	if err := p.client.UpdateDeviceGroup(ctx, deviceGroup); err != nil {
+		return fmt.Errorf("update device group [%s]: %w", name, err)
+	}
+	updated, err := p.client.GetDeviceGroup(ctx, name)
+	if err != nil {
+		return fmt.Errorf("get updated device group [%s]: %w", name, err)
+	}
+	if hasImsi(updated.Imsis, imsi) != member {
+		return fmt.Errorf("device group [%s] not updated for imsi [%s]", name, privacy.Imsi(privacy.Logs, imsi))
+	}
+	return nil
+}
+
+func hasImsi(imsis []string, imsi string) bool {
+	return slices.ContainsFunc(imsis, func(s string) bool { return normaliseImsi(s) == imsi })
+}
+
+func (p *webuiProvisioner) DisableSubscriber(ctx context.Context, imsi string) error {
+	imsi = normaliseImsi(imsi)
+	p.removed.update.Lock()
+	defer p.removed.update.Unlock()
+	names, err := p.client.GetDeviceGroupNames(ctx)
+	if err != nil {
+		return fmt.Errorf("get device groups: %w", err)
+	}
+
+	var groups []string
+	for _, name := range names {
+		deviceGroup, err := p.client.GetDeviceGroup(ctx, name)
+		if err != nil {
+			return fmt.Errorf("get device group [%s]: %w", name, err)
+		}
+		imsis := slices.DeleteFunc(slices.Clone(deviceGroup.Imsis), func(s string) bool {
+			return normaliseImsi(s) == imsi
+		})
+		if len(imsis) == len(deviceGroup.Imsis) {
+			continue
+		}
+
+		deviceGroup.Imsis = imsis
+		if err := p.putDeviceGroup(ctx, deviceGroup, imsi, false); err != nil {
+			return err
+		}
+		logger.ControllerLog.Infof("imsi [%v] removed from device group [%v]", privacy.Imsi(privacy.Logs, imsi), name)
+		groups = append(groups, name)
+	}
+
+	if len(groups) == 0 {
+		return fmt.Errorf("imsi [%s] not found in any device group", privacy.Imsi(privacy.Logs, imsi))
+	}
+
+	p.removed.lock.Lock()
+	p.removed.groups[imsi] = append(p.removed.groups[imsi], groups...)
+	p.removed.lock.Unlock()
+	return nil
+}
+
+func (p *webuiProvisioner) EnableSubscriber(ctx context.Context, imsi string) error {
+	imsi = normaliseImsi(imsi)
+	p.removed.update.Lock()
+	defer p.removed.update.Unlock()
+	p.removed.lock.Lock()
+	groups := p.removed.groups[imsi]
+	p.removed.lock.Unlock()
+	if len(groups) == 0 {
+		return fmt.Errorf("imsi [%s] was not disabled by metricfunc since it started", privacy.Imsi(privacy.Logs, imsi))
+	}
+
+	for _, name := range groups {
+		deviceGroup, err := p.client.GetDeviceGroup(ctx, name)
+		if err != nil {
+			return fmt.Errorf("get device group [%s]: %w", name, err)
+		}
+		if hasImsi(deviceGroup.Imsis, imsi) {
+			continue
+		}
+		deviceGroup.Imsis = append(deviceGroup.Imsis, imsi)
+		if err := p.putDeviceGroup(ctx, deviceGroup, imsi, true); err != nil {
+			return err
+		}
+		logger.ControllerLog.Infof("imsi [%v] added back to device group [%v]", privacy.Imsi(privacy.Logs, imsi), name)
+	}
+
+	p.removed.lock.Lock()
+	delete(p.removed.groups, imsi)
+	p.removed.lock.Unlock()
+	return nil
+}
@@ -0,0 +1,128 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/omec-project/metricfunc/config"
+	"github.com/omec-project/metricfunc/internal/webui"
+)
+
+func newWebuiStub(t *testing.T) (config.ServerAddr, map[string]*webui.DeviceGroup) {
+	t.Helper()
+	var lock sync.Mutex
+	groups := map[string]*webui.DeviceGroup{
+		"iot": {DeviceGroupName: "iot", Imsis: []string{"208930000000001", "208930000000002"}},
+		"cam": {DeviceGroupName: "cam", Imsis: []string{"208930000000003"}},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /config/v1/device-group", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]string{"iot", "cam"})
+	})
+	mux.HandleFunc("GET /config/v1/device-group/{name}", func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		_ = json.NewEncoder(w).Encode(groups[r.PathValue("name")])
+	})
+	mux.HandleFunc("PUT /config/v1/device-group/{name}", func(w http.ResponseWriter, r *http.Request) {
+		var deviceGroup webui.DeviceGroup
+		if err := json.NewDecoder(r.Body).Decode(&deviceGroup); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		groups[r.PathValue("name")] = &deviceGroup
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config.ServerAddr{Addr: u.Hostname(), Port: port}, groups
+}
+
+func TestWebuiProvisionerDisableEnable(t *testing.T) {
+	endPoint, groups := newWebuiStub(t)
+	p, checks, err := newProvisioner(&config.Configuration{
+		Provisioner:   ProvisionerWebui,
+		WebuiEndPoint: endPoint,
+	}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checks) != 1 || checks[0].name != "upstream "+ProvisionerWebui {
+		t.Fatalf("unexpected health checks %+v", checks)
+	}
+
+	if err := p.DisableSubscriber(context.Background(), "imsi-208930000000001"); err != nil {
+		t.Fatalf("disable failed: %v", err)
+	}
+	if slices.Contains(groups["iot"].Imsis, "208930000000001") {
+		t.Fatalf("imsi still in device group: %v", groups["iot"].Imsis)
+	}
+
+	if err := p.EnableSubscriber(context.Background(), "imsi-208930000000001"); err != nil {
+		t.Fatalf("enable failed: %v", err)
+	}
+	if !slices.Contains(groups["iot"].Imsis, "208930000000001") {
+		t.Fatalf("imsi not restored to device group: %v", groups["iot"].Imsis)
+	}
+	if len(groups["cam"].Imsis) != 1 {
+		t.Fatalf("unrelated device group modified: %v", groups["cam"].Imsis)
+	}
+
+	if err := p.DisableSubscriber(context.Background(), "208930000000009"); err == nil {
+		t.Fatal("expected disable of unknown imsi to fail")
+	}
+}
+
+func TestWebuiProvisionerConcurrentDisable(t *testing.T) {
+	endPoint, groups := newWebuiStub(t)
+	p := newWebuiProvisioner(endPoint, http.DefaultClient)
+
+	// both imsis share a device group, neither update may undo the other
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	for _, imsi := range []string{"208930000000001", "208930000000002"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- p.DisableSubscriber(context.Background(), imsi)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("disable failed: %v", err)
+		}
+	}
+	if imsis := groups["iot"].Imsis; len(imsis) != 0 {
+		t.Fatalf("imsis %v left in the device group", imsis)
+	}
+}
+
+func TestNewProvisionerUnknown(t *testing.T) {
+	if _, _, err := newProvisioner(&config.Configuration{Provisioner: "hss"}, 1); err == nil {
+		t.Fatal("expected unknown provisioner to be rejected")
+	}
+}
@@ -0,0 +1,200 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/omec-project/metricfunc/config"
+	"github.com/omec-project/metricfunc/internal/health"
+	"github.com/omec-project/metricfunc/internal/httpclient"
+	"github.com/omec-project/metricfunc/internal/metricdata"
+	"github.com/omec-project/metricfunc/logger"
+)
+
+// ReloadPaths are the settings applied by Reload, the other controller
+// settings take effect after a restart
+var ReloadPaths = []string{
+	"info.http-version",
+	"configuration.provisioner",
+	"configuration.rocEndPoint",
+	"configuration.webuiEndPoint",
+	"configuration.userAppApiServer",
+	"configuration.controller.maxRetries",
+	"configuration.controller.ipLeaseRetention",
+	"configuration.controller.upstream",
+}
+
+type upstreamCheck struct {
+	name     string
+	critical bool
+	check    health.Check
+}
+
+// upstreams are the services the controller talks to. A configuration
+// reload replaces them, keeping the clients whose settings did not change,
+// tasks in flight complete with the upstreams they started with.
+type upstreams struct {
+	provisioner       SubscriberProvisioner
+	provisionerClient *httpclient.Client
+	provisionerChecks []upstreamCheck
+	userApp           *httpclient.Client
+	userAppUrl        string
+	pollInterval      time.Duration
+	// stop ends the background work of the provisioner
+	stop context.CancelFunc
+}
+
+var active atomic.Pointer[upstreams]
+
+func newUpstreams(cfg *config.Configuration, httpVersion int) (*upstreams, error) {
+	provisionerClient, err := newProvisionerClient(cfg, httpVersion)
+	if err != nil {
+		return nil, err
+	}
+	userApp, err := newUserAppClient(cfg, httpVersion)
+	if err != nil {
+		return nil, err
+	}
+	provisioner, checks := provisionerWith(cfg, provisionerClient)
+	return &upstreams{
+		provisioner:       provisioner,
+		provisionerClient: provisionerClient,
+		provisionerChecks: checks,
+		userApp:           userApp,
+		userAppUrl:        EndPointUrl(cfg.UserAppApiServer),
+		pollInterval:      time.Duration(cfg.UserAppApiServer.PollInterval) * time.Second,
+	}, nil
+}
+
+func newUserAppClient(cfg *config.Configuration, httpVersion int) (*httpclient.Client, error) {
+	userAppClient, err := newUpstreamHttpClient(&cfg.UserAppApiServer, httpVersion)
+	if err != nil {
+		return nil, fmt.Errorf("user-app client: %w", err)
+	}
+	return httpclient.New("user-app", userAppClient, upstreamOptions(&cfg.Controller.Upstream)), nil
+}
+
+func (u *upstreams) checks() []upstreamCheck {
+	return append(slices.Clone(u.provisionerChecks),
+		upstreamCheck{name: "upstream user-app", check: u.userApp.Check})
+}
+
+// activate makes u replace the active upstreams, starting the background
+// work of its provisioner unless u keeps the previous one
+func activate(u *upstreams) {
+	previous := active.Swap(u)
+	if previous != nil && previous != u && previous.provisioner == u.provisioner {
+		u.stop = previous.stop
+	} else {
+		var ctx context.Context
+		ctx, u.stop = context.WithCancel(background)
+		backgroundWg.Go(func() { u.provisioner.Start(ctx) })
+		if previous != nil && previous != u {
+			previous.stop()
+		}
+	}
+
+	if previous != nil && previous != u {
+		for _, c := range previous.checks() {
+			health.Remove(c.name)
+		}
+	}
+	for _, c := range u.checks() {
+		health.AddCheck(c.name, c.critical, c.check)
+	}
+}
+
+// upstreamsChanged reports whether the settings of the upstreams differ
+// between the configurations
+func upstreamsChanged(old, new *config.Config) bool {
+	o, n := old.Configuration, new.Configuration
+	return old.Info.HttpVersion != new.Info.HttpVersion ||
+		o.Provisioner != n.Provisioner ||
+		!reflect.DeepEqual(selectedEndPoint(o), selectedEndPoint(n)) ||
+		!reflect.DeepEqual(o.UserAppApiServer, n.UserAppApiServer) ||
+		!reflect.DeepEqual(o.Controller.Upstream, n.Controller.Upstream)
+}
+
+// clientChanged reports whether the endpoints differ in more than their
+// poll interval, which needs no new client
+func clientChanged(old, new config.ServerAddr) bool {
+	old.PollInterval, new.PollInterval = 0, 0
+	return !reflect.DeepEqual(old, new)
+}
+
+// reloadUpstreams returns the upstreams of cfg, the new configuration with
+// the defaults set. The clients of current whose settings did not change
+// are kept, a provisioner of the same type replacing the current one takes
+// over its state.
+func reloadUpstreams(current *upstreams, old, new *config.Config, cfg *config.Configuration) (*upstreams, error) {
+	if current == nil {
+		return newUpstreams(cfg, new.Info.HttpVersion)
+	}
+	o, n := old.Configuration, new.Configuration
+	policyChanged := old.Info.HttpVersion != new.Info.HttpVersion ||
+		!reflect.DeepEqual(o.Controller.Upstream, n.Controller.Upstream)
+
+	u := *current
+	u.stop = nil
+	oldEndPoint, newEndPoint := selectedEndPoint(o), selectedEndPoint(n)
+	provisionerClientChanged := policyChanged || o.Provisioner != n.Provisioner ||
+		clientChanged(oldEndPoint, newEndPoint)
+	if provisionerClientChanged {
+		client, err := newProvisionerClient(cfg, new.Info.HttpVersion)
+		if err != nil {
+			return nil, err
+		}
+		u.provisionerClient = client
+	}
+	if provisionerClientChanged || !reflect.DeepEqual(oldEndPoint, newEndPoint) {
+		u.provisioner, u.provisionerChecks = provisionerWith(cfg, u.provisionerClient)
+		if p, ok := u.provisioner.(stateCarrier); ok {
+			p.carryOver(current.provisioner)
+		}
+	}
+
+	if policyChanged || clientChanged(o.UserAppApiServer, n.UserAppApiServer) {
+		userApp, err := newUserAppClient(cfg, new.Info.HttpVersion)
+		if err != nil {
+			return nil, err
+		}
+		u.userApp = userApp
+	}
+	u.userAppUrl = EndPointUrl(cfg.UserAppApiServer)
+	u.pollInterval = time.Duration(cfg.UserAppApiServer.PollInterval) * time.Second
+	return &u, nil
+}
+
+// Reload prepares the ReloadPaths settings of the new configuration. The
+// returned function applies them, nothing is applied when building the new
+// upstream clients fails.
+func Reload(old, new *config.Config) (func(), error) {
+	cfg := *new.Configuration
+	setDefaults(&cfg)
+
+	var u *upstreams
+	if upstreamsChanged(old, new) {
+		var err error
+		if u, err = reloadUpstreams(active.Load(), old, new, &cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	return func() {
+		queue.setMaxRetries(cfg.Controller.MaxRetries)
+		metricdata.SetIpLeaseRetention(time.Duration(cfg.Controller.IpLeaseRetention) * time.Second)
+		if u != nil {
+			logEndPoints(&cfg)
+			activate(u)
+			logger.ControllerLog.Infoln("controller upstreams replaced")
+		}
+	}, nil
+}
@@ -0,0 +1,95 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package controller
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/omec-project/metricfunc/config"
+)
+
+func TestReloadReplacesUpstreams(t *testing.T) {
+	first, firstGroups := newWebuiStub(t)
+	second, secondGroups := newWebuiStub(t)
+	old := &config.Config{Info: &config.Info{}, Configuration: &config.Configuration{
+		Provisioner:   ProvisionerWebui,
+		WebuiEndPoint: first,
+	}}
+	if err := InitControllerConfig(old); err != nil {
+		t.Fatal(err)
+	}
+	RogueIPHandler()
+	t.Cleanup(func() {
+		_ = Shutdown(context.Background())
+		active.Store(nil)
+		queue = nil
+	})
+
+	// settings which keep the upstreams leave them in place
+	retries := *old.Configuration
+	retries.Controller.MaxRetries = 5
+	apply, err := Reload(old, &config.Config{Info: old.Info, Configuration: &retries})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := active.Load()
+	apply()
+	if active.Load() != previous || queue.maxRetries.Load() != 5 {
+		t.Fatal("unexpected reload of the upstreams")
+	}
+
+	// a poll interval takes no new client
+	polled := retries
+	polled.UserAppApiServer.PollInterval = 5
+	apply, err = Reload(&config.Config{Info: old.Info, Configuration: &retries},
+		&config.Config{Info: old.Info, Configuration: &polled})
+	if err != nil {
+		t.Fatal(err)
+	}
+	apply()
+	if u := active.Load(); u.provisioner != previous.provisioner || u.userApp != previous.userApp ||
+		u.pollInterval != 5*time.Second {
+		t.Fatal("unexpected rebuild of the upstream clients")
+	}
+
+	ctx := context.Background()
+	if err := disableSubscriber(ctx, active.Load().provisioner, "report", "208930000000001"); err != nil {
+		t.Fatal(err)
+	}
+	moved := polled
+	moved.WebuiEndPoint = second
+	apply, err = Reload(&config.Config{Info: old.Info, Configuration: &polled},
+		&config.Config{Info: old.Info, Configuration: &moved})
+	if err != nil {
+		t.Fatal(err)
+	}
+	apply()
+	if active.Load().userApp != previous.userApp {
+		t.Fatal("unexpected rebuild of the user-app client")
+	}
+	if err := disableSubscriber(ctx, active.Load().provisioner, "report", "208930000000002"); err != nil {
+		t.Fatal(err)
+	}
+	if slices.Contains(secondGroups["iot"].Imsis, "208930000000002") ||
+		!slices.Contains(firstGroups["iot"].Imsis, "208930000000002") {
+		t.Fatal("subscriber not disabled through the new endpoint")
+	}
+	// the subscriber disabled through the previous endpoint can be enabled
+	if err := active.Load().provisioner.EnableSubscriber(ctx, "208930000000001"); err != nil {
+		t.Fatalf("provisioner state lost on reload: %v", err)
+	}
+}
+
+func TestReloadRejectsBrokenUpstream(t *testing.T) {
+	old := &config.Config{Info: &config.Info{}, Configuration: &config.Configuration{Provisioner: ProvisionerWebui}}
+	broken := *old.Configuration
+	broken.WebuiEndPoint.Tls = &config.TLS{CaFile: "/nonexistent/ca.pem"}
+	if _, err := Reload(old, &config.Config{Info: old.Info, Configuration: &broken}); err == nil {
+		t.Fatal("expected the missing CA file to reject the reload")
+	}
+}
@@ -0,0 +1,303 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/omec-project/metricfunc/internal/promclient"
+	"github.com/omec-project/metricfunc/internal/tracing"
+	"github.com/omec-project/metricfunc/logger"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const retryMaxDelay = time.Minute
+
+// retryBaseDelay is the delay of the first retry, doubled for the next ones
+var retryBaseDelay = 2 * time.Second
+
+var (
+	// ErrQueueFull is returned when a report is rejected because the
+	// controller queue is at capacity
+	ErrQueueFull = errors.New("controller queue full")
+	// ErrBatchTooLarge is returned for reports of more ips than the
+	// controller queue holds
+	ErrBatchTooLarge = errors.New("more ips reported than the controller queue holds")
+	// ErrQueueStopped is returned for reports arriving during the shutdown
+	ErrQueueStopped = errors.New("controller queue stopped")
+)
+
+type taskKind string
+
+const (
+	// taskReport resolves the subscriber of a rogue ip and enforces the policy
+	taskReport taskKind = "report"
+	// taskEnforce enforces the policy on an already resolved subscriber
+	taskEnforce taskKind = "enforce"
+)
+
+type task struct {
+	kind     taskKind
+	reportId string
+	source   string
+	ipAddr   string
+	imsi     string
+	observed time.Time
+	attempt  int
+	enqueued time.Time
+	// span is the context of the span reporting the ip, the parent of the
+	// spans of the task
+	span trace.SpanContext
+}
+
+// workQueue is a bounded queue of controller tasks served by a pool of
+// workers. Tasks of the same imsi are never enforced concurrently.
+type workQueue struct {
+	tasks chan *task
+	// slots holds a token per queued task, taken before the task is sent
+	// and given back once it is dequeued, so that sending never blocks and
+	// batches are queued whole
+	slots      chan struct{}
+	batchLock  sync.Mutex
+	workers    int
+	maxRetries atomic.Int64
+	imsiLocks  keyedMutex
+	wg         sync.WaitGroup
+	stopping   chan struct{}
+	stopOnce   sync.Once
+}
+
+func newWorkQueue(size, workers, maxRetries int) *workQueue {
+	q := &workQueue{
+		tasks:     make(chan *task, size),
+		slots:     make(chan struct{}, size),
+		workers:   workers,
+		imsiLocks: keyedMutex{locks: make(map[string]*keyedLock)},
+		stopping:  make(chan struct{}),
+	}
+	q.setMaxRetries(maxRetries)
+	return q
+}
+
+// setMaxRetries applies to the enforcements failing from now on
+func (q *workQueue) setMaxRetries(maxRetries int) {
+	q.maxRetries.Store(int64(maxRetries))
+}
+
+func (q *workQueue) stopped() bool {
+	select {
+	case <-q.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// tryPush adds the task without waiting, failing with ErrQueueFull
+func (q *workQueue) tryPush(t *task) error {
+	return q.tryPushAll([]*task{t})
+}
+
+// tryPushAll adds all the tasks without waiting or, failing with
+// ErrQueueFull, none of them
+func (q *workQueue) tryPushAll(tasks []*task) error {
+	if q.stopped() {
+		return ErrQueueStopped
+	}
+	if len(tasks) > cap(q.slots) {
+		return ErrBatchTooLarge
+	}
+	q.batchLock.Lock()
+	for i := range tasks {
+		select {
+		case q.slots <- struct{}{}:
+		default:
+			for range i {
+				<-q.slots
+			}
+			q.batchLock.Unlock()
+			for range tasks {
+				promclient.IncrementControllerQueueRejected()
+			}
+			return ErrQueueFull
+		}
+	}
+	q.batchLock.Unlock()
+
+	now := time.Now()
+	for _, t := range tasks {
+		t.enqueued = now
+		q.tasks <- t
+	}
+	promclient.SetControllerQueueDepth(len(q.tasks))
+	return nil
+}
+
+// push adds the task, waiting for room until the context is done
+func (q *workQueue) push(ctx context.Context, t *task) error {
+	if q.stopped() {
+		return ErrQueueStopped
+	}
+	select {
+	case q.slots <- struct{}{}:
+		t.enqueued = time.Now()
+		q.tasks <- t
+		promclient.SetControllerQueueDepth(len(q.tasks))
+		return nil
+	case <-q.stopping:
+		return ErrQueueStopped
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (q *workQueue) start() {
+	logger.ControllerLog.Infof("starting [%d] controller workers, queue size [%d]", q.workers, cap(q.tasks))
+	for range q.workers {
+		q.wg.Add(1)
+		go q.worker()
+	}
+}
+
+// stop rejects new tasks and waits until the workers have handled the queued
+// ones, or ctx is done
+func (q *workQueue) stop(ctx context.Context) error {
+	q.stopOnce.Do(func() { close(q.stopping) })
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d tasks left in the queue: %w", len(q.tasks), ctx.Err())
+	}
+}
+
+func (q *workQueue) worker() {
+	defer q.wg.Done()
+	for {
+		select {
+		case t := <-q.tasks:
+			q.run(t)
+		case <-q.stopping:
+			// drain what is left, tasks can no longer be added
+			for {
+				select {
+				case t := <-q.tasks:
+					q.run(t)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (q *workQueue) run(t *task) {
+	<-q.slots
+	promclient.SetControllerQueueDepth(len(q.tasks))
+	promclient.ObserveControllerQueueWait(time.Since(t.enqueued))
+	start := time.Now()
+	// the span covers the wait in the queue and joins the trace of the report
+	ctx, span := tracing.Tracer().Start(trace.ContextWithSpanContext(context.Background(), t.span),
+		"controller "+string(t.kind), trace.WithTimestamp(t.enqueued), trace.WithAttributes(
+			attribute.String("metricfunc.report.id", t.reportId),
+			attribute.String("metricfunc.report.source", t.source),
+			attribute.Int("metricfunc.attempt", t.attempt)))
+	span.AddEvent("dequeued")
+	tracing.End(span, q.process(ctx, t))
+	promclient.ObserveControllerTaskDuration(string(t.kind), time.Since(start))
+}
+
+// process returns the error of the enforcement, if any
+func (q *workQueue) process(ctx context.Context, t *task) error {
+	if t.kind == taskReport {
+		if !handleRogueIP(t) {
+			return nil
+		}
+	}
+
+	release := q.imsiLocks.acquire(t.imsi)
+	err := enforce(ctx, t)
+	release()
+	if err == nil {
+		recordOutcome(t, "disabled", nil)
+		return nil
+	}
+
+	maxRetries := int(q.maxRetries.Load())
+	if t.attempt >= maxRetries {
+		recordOutcome(t, "failed", err)
+		return err
+	}
+	delay := retryDelay(t.attempt)
+	logger.ControllerLog.Warnf("enforcement of report [%v] failed, retry [%d/%d] in [%v]: %v",
+		t.reportId, t.attempt+1, maxRetries, delay, err)
+	recordOutcome(t, "retrying", err)
+
+	retry := *t
+	retry.kind = taskEnforce
+	retry.attempt++
+	time.AfterFunc(delay, func() {
+		if err := q.tryPush(&retry); err != nil {
+			recordOutcome(&retry, "failed", err)
+		}
+	})
+	return err
+}
+
+// retryDelay doubles the delay with every attempt up to retryMaxDelay
+func retryDelay(attempt int) time.Duration {
+	delay := retryBaseDelay
+	for range attempt {
+		delay *= 2
+		if delay >= retryMaxDelay {
+			return retryMaxDelay
+		}
+	}
+	return delay
+}
+
+type keyedLock struct {
+	sync.Mutex
+	refs int
+}
+
+// keyedMutex hands out one mutex per key, dropping it once unused
+type keyedMutex struct {
+	lock  sync.Mutex
+	locks map[string]*keyedLock
+}
+
+func (k *keyedMutex) acquire(key string) (release func()) {
+	k.lock.Lock()
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyedLock{}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.lock.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		k.lock.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.lock.Unlock()
+	}
+}
@@ -0,0 +1,221 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkQueueTryPushFull(t *testing.T) {
+	q := newWorkQueue(1, 1, 0)
+	if err := q.tryPush(&task{kind: taskReport}); err != nil {
+		t.Fatalf("first push failed: %v", err)
+	}
+	if err := q.tryPush(&task{kind: taskReport}); err != ErrQueueFull {
+		t.Fatalf("unexpected error: got %v want %v", err, ErrQueueFull)
+	}
+}
+
+func TestWorkQueueTryPushAll(t *testing.T) {
+	q := newWorkQueue(2, 1, 0)
+	if err := q.tryPush(&task{kind: taskReport}); err != nil {
+		t.Fatal(err)
+	}
+	// a batch is queued whole or not at all
+	if err := q.tryPushAll([]*task{{kind: taskReport}, {kind: taskReport}}); err != ErrQueueFull {
+		t.Fatalf("unexpected error: got %v want %v", err, ErrQueueFull)
+	}
+	if len(q.tasks) != 1 || len(q.slots) != 1 {
+		t.Fatalf("rejected batch left %d tasks and %d slots taken, want 1", len(q.tasks), len(q.slots))
+	}
+	if err := q.tryPushAll([]*task{{kind: taskReport}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.tryPushAll(make([]*task, 3)); err != ErrBatchTooLarge {
+		t.Fatalf("unexpected error: got %v want %v", err, ErrBatchTooLarge)
+	}
+}
+
+// stubProvisioner fails the first disables and records how many run at once
+type stubProvisioner struct {
+	failures  atomic.Int32
+	calls     atomic.Int32
+	delay     time.Duration
+	lock      sync.Mutex
+	running   int
+	maxActive int
+}
+
+func (p *stubProvisioner) Name() string {
+	return "stub"
+}
+
+func (p *stubProvisioner) Start(context.Context) {
+}
+
+func (p *stubProvisioner) DisableSubscriber(context.Context, string) error {
+	p.calls.Add(1)
+	p.lock.Lock()
+	p.running++
+	p.maxActive = max(p.maxActive, p.running)
+	p.lock.Unlock()
+	time.Sleep(p.delay)
+	p.lock.Lock()
+	p.running--
+	p.lock.Unlock()
+	if p.failures.Add(-1) >= 0 {
+		return errors.New("upstream down")
+	}
+	return nil
+}
+
+func (p *stubProvisioner) EnableSubscriber(context.Context, string) error {
+	return nil
+}
+
+func useProvisioner(t *testing.T, p SubscriberProvisioner) {
+	t.Helper()
+	active.Store(&upstreams{provisioner: p})
+	t.Cleanup(func() { active.Store(nil) })
+}
+
+func stopQueue(t *testing.T, q *workQueue) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := q.stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWorkQueueRetries(t *testing.T) {
+	previous := retryBaseDelay
+	retryBaseDelay = time.Millisecond
+	t.Cleanup(func() { retryBaseDelay = previous })
+	p := &stubProvisioner{}
+	p.failures.Store(5)
+	useProvisioner(t, p)
+
+	q := newWorkQueue(4, 2, 2)
+	q.start()
+	if err := q.tryPush(&task{kind: taskEnforce, reportId: "r1", imsi: "208930000000001"}); err != nil {
+		t.Fatal(err)
+	}
+	// the first attempt and maxRetries retries, nothing after
+	deadline := time.Now().Add(5 * time.Second)
+	for p.calls.Load() < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	stopQueue(t, q)
+	if n := p.calls.Load(); n != 3 {
+		t.Fatalf("disable attempted %d times, want 3", n)
+	}
+
+	// a retry which succeeds ends the retries
+	p = &stubProvisioner{}
+	p.failures.Store(1)
+	useProvisioner(t, p)
+	q = newWorkQueue(4, 2, 5)
+	q.start()
+	if err := q.tryPush(&task{kind: taskEnforce, reportId: "r2", imsi: "208930000000001"}); err != nil {
+		t.Fatal(err)
+	}
+	for p.calls.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	stopQueue(t, q)
+	if n := p.calls.Load(); n != 2 {
+		t.Fatalf("disable attempted %d times, want 2", n)
+	}
+}
+
+func TestWorkQueueSerialisesImsi(t *testing.T) {
+	p := &stubProvisioner{delay: 5 * time.Millisecond}
+	useProvisioner(t, p)
+
+	q := newWorkQueue(8, 4, 0)
+	for i := range 4 {
+		if err := q.tryPush(&task{kind: taskEnforce, reportId: fmt.Sprint(i), imsi: "208930000000001"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	q.start()
+	stopQueue(t, q)
+	if p.calls.Load() != 4 || p.maxActive != 1 {
+		t.Fatalf("%d disables, %d at once, want 4 one at a time", p.calls.Load(), p.maxActive)
+	}
+}
+
+func TestWorkQueueStopDrains(t *testing.T) {
+	pending = newPendingReports(time.Minute)
+	t.Cleanup(func() { pending = nil })
+
+	q := newWorkQueue(4, 2, 0)
+	for _, ipAddr := range []string{"10.250.0.1", "10.250.0.2", "10.250.0.3"} {
+		if err := q.tryPush(&task{kind: taskReport, ipAddr: ipAddr, observed: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	q.start()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := q.stop(ctx); err != nil {
+		t.Fatalf("stop failed: %v", err)
+	}
+
+	// the unknown ips of the queued reports wait for their subscriber
+	if n := len(pending.expire(time.Now().Add(time.Hour))); n != 3 {
+		t.Fatalf("queued reports handled: got %d want 3", n)
+	}
+	if err := q.tryPush(&task{kind: taskReport}); err != ErrQueueStopped {
+		t.Fatalf("unexpected error after stop: got %v want %v", err, ErrQueueStopped)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	for attempt, want := range []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second} {
+		if got := retryDelay(attempt); got != want {
+			t.Errorf("attempt %d: got %v want %v", attempt, got, want)
+		}
+	}
+	if got := retryDelay(20); got != retryMaxDelay {
+		t.Errorf("expected delay capped at %v, got %v", retryMaxDelay, got)
+	}
+}
+
+func TestKeyedMutexSerialisesKey(t *testing.T) {
+	k := keyedMutex{locks: make(map[string]*keyedLock)}
+	var active, maxActive atomic.Int32
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release := k.acquire("imsi-1")
+			if n := active.Add(1); n > maxActive.Load() {
+				maxActive.Store(n)
+			}
+			time.Sleep(time.Millisecond)
+			active.Add(-1)
+			release()
+		}()
+	}
+	wg.Wait()
+
+	if maxActive.Load() != 1 {
+		t.Fatalf("key held concurrently by %d goroutines", maxActive.Load())
+	}
+	if len(k.locks) != 0 {
+		t.Fatalf("unused locks not released: %d", len(k.locks))
+	}
+}
@@ -0,0 +1,163 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package apiauth authenticates api server callers by bearer token, JWT or
+// mTLS client certificate and assigns them a role
+package apiauth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/omec-project/metricfunc/config"
+	"github.com/omec-project/metricfunc/internal/credentials"
+)
+
+// Role orders what a caller may do, each role includes the lower ones
+type Role int
+
+const (
+	RoleNone Role = iota
+	RoleObserver
+	RoleOperator
+)
+
+var (
+	// ErrNoCredentials is returned for requests without any credentials
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials is returned for unknown tokens and tokens
+	// failing verification
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleObserver:
+		return "observer"
+	case RoleOperator:
+		return "operator"
+	default:
+		return "none"
+	}
+}
+
+// ParseRole returns the role called name
+func ParseRole(name string) (Role, error) {
+	switch strings.ToLower(name) {
+	case "observer":
+		return RoleObserver, nil
+	case "operator":
+		return RoleOperator, nil
+	default:
+		return RoleNone, fmt.Errorf("unknown role [%s]", name)
+	}
+}
+
+// Identity is an authenticated caller
+type Identity struct {
+	Name string
+	Role Role
+}
+
+type token struct {
+	name  string
+	token *credentials.Secret
+	role  Role
+}
+
+// Authenticator identifies the callers of the api server
+type Authenticator struct {
+	tokens      []token
+	jwt         *jwtVerifier
+	clientCerts map[string]Role
+}
+
+// New returns the authenticator configured by cfg, or nil when cfg is nil
+// and the api server is open to everyone
+func New(cfg *config.ApiServerAuth) (*Authenticator, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	a := &Authenticator{clientCerts: make(map[string]Role)}
+	for i, t := range cfg.Tokens {
+		name := t.Name
+		if name == "" {
+			name = fmt.Sprintf("token-%d", i)
+		}
+		role, err := ParseRole(t.Role)
+		if err != nil {
+			return nil, fmt.Errorf("token [%s]: %w", name, err)
+		}
+		secret, err := credentials.NewSecret(t.Token, "token "+name)
+		if err != nil {
+			return nil, err
+		}
+		a.tokens = append(a.tokens, token{name: name, token: secret, role: role})
+	}
+	if cfg.Jwt != nil {
+		verifier, err := newJwtVerifier(cfg.Jwt)
+		if err != nil {
+			return nil, fmt.Errorf("jwt: %w", err)
+		}
+		a.jwt = verifier
+	}
+	for _, c := range cfg.ClientCerts {
+		role, err := ParseRole(c.Role)
+		if err != nil {
+			return nil, fmt.Errorf("client certificate [%s]: %w", c.CommonName, err)
+		}
+		a.clientCerts[c.CommonName] = role
+	}
+	if len(a.tokens) == 0 && a.jwt == nil && len(a.clientCerts) == 0 {
+		return nil, errors.New("no tokens, jwt or client certificates configured")
+	}
+	return a, nil
+}
+
+// Authenticate identifies the caller of req. A bearer token takes precedence
+// over the client certificate, so that a shared client certificate does not
+// hide the caller behind it.
+func (a *Authenticator) Authenticate(req *http.Request) (Identity, error) {
+	if authorization := req.Header.Get("Authorization"); authorization != "" {
+		scheme, bearer, ok := strings.Cut(authorization, " ")
+		if !ok || !strings.EqualFold(scheme, "bearer") {
+			return Identity{}, ErrInvalidCredentials
+		}
+		return a.authenticateBearer(strings.TrimSpace(bearer))
+	}
+
+	// only certificates verified against the client CA of the server count
+	if req.TLS != nil && len(req.TLS.VerifiedChains) != 0 {
+		cn := req.TLS.VerifiedChains[0][0].Subject.CommonName
+		role, ok := a.clientCerts[cn]
+		if !ok {
+			// authenticated, but not authorised for anything
+			return Identity{Name: "cert:" + cn}, nil
+		}
+		return Identity{Name: "cert:" + cn, Role: role}, nil
+	}
+	return Identity{}, ErrNoCredentials
+}
+
+func (a *Authenticator) authenticateBearer(bearer string) (Identity, error) {
+	if bearer == "" {
+		return Identity{}, ErrInvalidCredentials
+	}
+	for _, t := range a.tokens {
+		value, err := t.token.Get()
+		if err != nil {
+			return Identity{}, fmt.Errorf("token [%s]: %w", t.name, err)
+		}
+		if subtle.ConstantTimeCompare([]byte(value), []byte(bearer)) == 1 {
+			return Identity{Name: "token:" + t.name, Role: t.role}, nil
+		}
+	}
+	if a.jwt != nil && strings.Count(bearer, ".") == 2 {
+		return a.jwt.verify(bearer)
+	}
+	return Identity{}, ErrInvalidCredentials
+}
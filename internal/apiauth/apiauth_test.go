@@ -0,0 +1,133 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package apiauth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/omec-project/metricfunc/config"
+)
+
+func bearerRequest(token string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/nmetric-func/v1/subscriber/all", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+func TestStaticTokens(t *testing.T) {
+	t.Setenv("METRICFUNC_TEST_OBSERVER", "observer-token")
+	a, err := New(&config.ApiServerAuth{Tokens: []config.ApiToken{
+		{Name: "grafana", Token: &config.Secret{Env: "METRICFUNC_TEST_OBSERVER"}, Role: "observer"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	identity, err := a.Authenticate(bearerRequest("observer-token"))
+	if err != nil || identity.Role != RoleObserver || identity.Name != "token:grafana" {
+		t.Fatalf("unexpected identity %+v, err %v", identity, err)
+	}
+	if _, err := a.Authenticate(bearerRequest("guess")); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("unexpected error for unknown token: %v", err)
+	}
+	if _, err := a.Authenticate(bearerRequest("")); !errors.Is(err, ErrNoCredentials) {
+		t.Fatalf("unexpected error without token: %v", err)
+	}
+	// a non breaking space survives the header parsing but not the trimming
+	if _, err := a.Authenticate(bearerRequest("\u00a0")); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("unexpected error for a blank token: %v", err)
+	}
+}
+
+func TestJwt(t *testing.T) {
+	t.Setenv("METRICFUNC_TEST_HMAC", "hmac-secret")
+	a, err := New(&config.ApiServerAuth{Jwt: &config.Jwt{
+		Issuer:     "https://keycloak/realms/aether",
+		HmacSecret: &config.Secret{Env: "METRICFUNC_TEST_HMAC"},
+		RoleClaim:  "realm_access.roles",
+		Roles:      map[string]string{"aether-admin": "operator", "aether-viewer": "observer"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(claims jwt.MapClaims, key string) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	claims := func(roles ...any) jwt.MapClaims {
+		return jwt.MapClaims{
+			"sub":          "alice",
+			"iss":          "https://keycloak/realms/aether",
+			"exp":          time.Now().Add(time.Hour).Unix(),
+			"realm_access": map[string]any{"roles": roles},
+		}
+	}
+
+	identity, err := a.Authenticate(bearerRequest(sign(claims("aether-viewer", "aether-admin"), "hmac-secret")))
+	if err != nil || identity.Role != RoleOperator || identity.Name != "jwt:alice" {
+		t.Fatalf("unexpected identity %+v, err %v", identity, err)
+	}
+	identity, err = a.Authenticate(bearerRequest(sign(claims("offline_access"), "hmac-secret")))
+	if err != nil || identity.Role != RoleNone {
+		t.Fatalf("unmapped role: unexpected identity %+v, err %v", identity, err)
+	}
+
+	expired := claims("aether-admin")
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	foreign := claims("aether-admin")
+	foreign["iss"] = "https://elsewhere"
+	for name, token := range map[string]string{
+		"bad signature": sign(claims("aether-admin"), "other-secret"),
+		"expired":       sign(expired, "hmac-secret"),
+		"wrong issuer":  sign(foreign, "hmac-secret"),
+	} {
+		if _, err := a.Authenticate(bearerRequest(token)); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("%s: unexpected error %v", name, err)
+		}
+	}
+}
+
+func TestClientCertificate(t *testing.T) {
+	a, err := New(&config.ApiServerAuth{ClientCerts: []config.ClientCert{{CommonName: "roc-gui", Role: "operator"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	withCert := func(cn string) *http.Request {
+		req := bearerRequest("")
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: cn}}
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		return req
+	}
+
+	identity, err := a.Authenticate(withCert("roc-gui"))
+	if err != nil || identity.Role != RoleOperator {
+		t.Fatalf("unexpected identity %+v, err %v", identity, err)
+	}
+	identity, err = a.Authenticate(withCert("someone"))
+	if err != nil || identity.Role != RoleNone {
+		t.Fatalf("unknown certificate: unexpected identity %+v, err %v", identity, err)
+	}
+}
+
+func TestNewRejectsUnknownRole(t *testing.T) {
+	cfg := &config.ApiServerAuth{ClientCerts: []config.ClientCert{{CommonName: "roc-gui", Role: "admin"}}}
+	if _, err := New(cfg); err == nil {
+		t.Fatal("expected unknown role to be rejected")
+	}
+}
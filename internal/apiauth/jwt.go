@@ -0,0 +1,188 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package apiauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/omec-project/metricfunc/config"
+	"github.com/omec-project/metricfunc/internal/credentials"
+	"github.com/omec-project/metricfunc/logger"
+)
+
+const (
+	defaultRoleClaim = "roles"
+	// jwtLeeway tolerates clock skew between the issuer and metricfunc
+	jwtLeeway = 30 * time.Second
+)
+
+// jwtVerifier checks the signature and claims of JWT bearer tokens and maps
+// the role claim to a Role
+type jwtVerifier struct {
+	hmacSecret *credentials.Secret
+	publicKey  any
+	roleClaim  []string
+	roles      map[string]Role
+	options    []jwt.ParserOption
+}
+
+func newJwtVerifier(cfg *config.Jwt) (*jwtVerifier, error) {
+	v := &jwtVerifier{roleClaim: strings.Split(defaultRoleClaim, ".")}
+	if cfg.RoleClaim != "" {
+		v.roleClaim = strings.Split(cfg.RoleClaim, ".")
+	}
+
+	var methods []string
+	switch {
+	case cfg.HmacSecret != nil && cfg.PublicKeyFile != "":
+		return nil, errors.New("hmacSecret and publicKeyFile are mutually exclusive")
+	case cfg.HmacSecret != nil:
+		secret, err := credentials.NewSecret(cfg.HmacSecret, "hmacSecret")
+		if err != nil {
+			return nil, err
+		}
+		v.hmacSecret = secret
+		methods = []string{"HS256", "HS384", "HS512"}
+	case cfg.PublicKeyFile != "":
+		key, err := loadPublicKey(cfg.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		v.publicKey = key
+		switch key.(type) {
+		case *rsa.PublicKey:
+			methods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512"}
+		case *ecdsa.PublicKey:
+			methods = []string{"ES256", "ES384", "ES512"}
+		case ed25519.PublicKey:
+			methods = []string{"EdDSA"}
+		default:
+			return nil, fmt.Errorf("unsupported public key type %T", key)
+		}
+	default:
+		return nil, errors.New("hmacSecret or publicKeyFile required")
+	}
+
+	v.options = []jwt.ParserOption{
+		jwt.WithValidMethods(methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(jwtLeeway),
+	}
+	if cfg.Issuer != "" {
+		v.options = append(v.options, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		v.options = append(v.options, jwt.WithAudience(cfg.Audience))
+	}
+
+	if len(cfg.Roles) != 0 {
+		v.roles = make(map[string]Role, len(cfg.Roles))
+		for claim, name := range cfg.Roles {
+			role, err := ParseRole(name)
+			if err != nil {
+				return nil, fmt.Errorf("role mapping of [%s]: %w", claim, err)
+			}
+			v.roles[claim] = role
+		}
+	}
+	return v, nil
+}
+
+// loadPublicKey reads a PEM encoded public key or certificate
+func loadPublicKey(file string) (any, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read public key: %w", err)
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in [%s]", file)
+	}
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+}
+
+func (v *jwtVerifier) key(*jwt.Token) (any, error) {
+	if v.hmacSecret == nil {
+		return v.publicKey, nil
+	}
+	// read on every token so that a rotated secret applies immediately
+	secret, err := v.hmacSecret.Get()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(secret), nil
+}
+
+func (v *jwtVerifier) verify(bearer string) (Identity, error) {
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(bearer, claims, v.key, v.options...); err != nil {
+		logger.ApiSrvLog.Debugf("jwt rejected: %v", err)
+		return Identity{}, ErrInvalidCredentials
+	}
+
+	subject, _ := claims.GetSubject()
+	identity := Identity{Name: "jwt:" + subject}
+	for _, value := range claimValues(claims, v.roleClaim) {
+		identity.Role = max(identity.Role, v.role(value))
+	}
+	return identity, nil
+}
+
+func (v *jwtVerifier) role(claim string) Role {
+	if v.roles != nil {
+		return v.roles[claim]
+	}
+	role, _ := ParseRole(claim)
+	return role
+}
+
+// claimValues returns the strings found at the claim path, which holds a
+// single string, a space separated list or an array of strings
+func claimValues(claims map[string]any, path []string) []string {
+	var value any = claims
+	for _, name := range path {
+		m, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = m[name]
+	}
+
+	switch value := value.(type) {
+	case string:
+		return strings.Fields(value)
+	case []any:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
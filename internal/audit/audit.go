@@ -0,0 +1,304 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package audit keeps an append-only record of the controller decisions and
+// of the outbound requests made on their behalf
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/omec-project/metricfunc/config"
+	"github.com/omec-project/metricfunc/logger"
+	"github.com/segmentio/kafka-go"
+)
+
+type EventType string
+
+const (
+	EventRogueIpReport  EventType = "rogue-ip-report"
+	EventImsiResolution EventType = "imsi-resolution"
+	EventPolicyDecision EventType = "policy-decision"
+	EventUpstreamCall   EventType = "upstream-call"
+	EventOutcome        EventType = "outcome"
+)
+
+// Record is a single audit log entry. Records belonging to the handling of
+// the same rogue ip report share the ReportId.
+type Record struct {
+	Time       time.Time `json:"time"`
+	Type       EventType `json:"type"`
+	ReportId   string    `json:"report-id,omitempty"`
+	Source     string    `json:"source,omitempty"`
+	IpAddr     string    `json:"ip-addr,omitempty"`
+	Imsi       string    `json:"imsi,omitempty"`
+	Decision   string    `json:"decision,omitempty"`
+	Method     string    `json:"method,omitempty"`
+	Url        string    `json:"url,omitempty"`
+	StatusCode int       `json:"status-code,omitempty"`
+	Outcome    string    `json:"outcome,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Query selects records for the audit API. Zero values match everything.
+type Query struct {
+	From  time.Time
+	To    time.Time
+	Imsi  string
+	Limit int
+}
+
+type auditLog struct {
+	lock    sync.Mutex
+	path    string
+	file    *os.File
+	size    int64
+	maxSize int64
+	writer  *kafka.Writer
+}
+
+const (
+	defaultMaxSize = 100 // megabytes
+	// rotatedSuffix names the previous audit log file, searched with the
+	// current one
+	rotatedSuffix = ".1"
+)
+
+// ErrNotConfigured is returned by Search when no audit log file is configured
+var ErrNotConfigured = errors.New("audit log file not configured")
+
+var (
+	auditor  atomic.Pointer[auditLog]
+	reportId atomic.Uint64
+)
+
+// Init opens the audit log sinks. Recording is a no-op until Init succeeds.
+func Init(cfg *config.AuditLog) error {
+	if cfg == nil || !cfg.Enable {
+		return nil
+	}
+
+	a := &auditLog{path: cfg.Path, maxSize: int64(cfg.MaxSize) << 20}
+	if a.maxSize == 0 {
+		a.maxSize = defaultMaxSize << 20
+	}
+	if cfg.Path != "" {
+		if err := a.openLocked(); err != nil {
+			return fmt.Errorf("open audit log: %w", err)
+		}
+	}
+	if len(cfg.KafkaUrls) != 0 && cfg.KafkaTopic != "" {
+		a.writer = &kafka.Writer{
+			Addr:     kafka.TCP(cfg.KafkaUrls...),
+			Topic:    cfg.KafkaTopic,
+			Balancer: &kafka.Hash{},
+			Async:    true,
+			Completion: func(messages []kafka.Message, err error) {
+				if err != nil {
+					logger.ControllerLog.Warnf("audit log kafka write of [%d] records failed: %v",
+						len(messages), err)
+				}
+			},
+		}
+	}
+
+	auditor.Store(a)
+	logger.ControllerLog.Infof("audit log enabled, file [%v] kafka topic [%v]", cfg.Path, cfg.KafkaTopic)
+	return nil
+}
+
+// openLocked opens the audit log file for appending
+func (a *auditLog) openLocked() error {
+	file, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return errors.Join(err, file.Close())
+	}
+	a.file, a.size = file, info.Size()
+	return nil
+}
+
+// rotateLocked moves the audit log file to its rotated name, replacing the
+// previous one, and starts a new file. This bounds the disk used and the
+// records scanned by Search to twice the maximum size.
+func (a *auditLog) rotateLocked() {
+	if err := a.file.Close(); err != nil {
+		logger.ControllerLog.Warnf("audit log close error: %v", err)
+	}
+	a.file = nil
+	if err := os.Rename(a.path, a.path+rotatedSuffix); err != nil {
+		logger.ControllerLog.Errorf("audit log rotate error: %v", err)
+	}
+	if err := a.openLocked(); err != nil {
+		logger.ControllerLog.Errorf("audit log open error, records are no longer written to the file: %v", err)
+	}
+}
+
+// Close flushes and closes the audit log sinks
+func Close() error {
+	a := auditor.Swap(nil)
+	if a == nil {
+		return nil
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	var errs []error
+	if a.file != nil {
+		errs = append(errs, a.file.Close())
+		a.file = nil
+	}
+	if a.writer != nil {
+		errs = append(errs, a.writer.Close())
+		a.writer = nil
+	}
+	return errors.Join(errs...)
+}
+
+// NewReportId returns an id correlating the records of one rogue ip report
+func NewReportId() string {
+	return strconv.FormatInt(time.Now().Unix(), 36) + "-" + strconv.FormatUint(reportId.Add(1), 36)
+}
+
+// Add appends the record to the audit log
+func Add(r Record) {
+	a := auditor.Load()
+	if a == nil {
+		return
+	}
+	if r.Time.IsZero() {
+		r.Time = time.Now().UTC()
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		logger.ControllerLog.Errorf("audit record marshal error: %v", err)
+		return
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.file != nil && a.size > 0 && a.size+int64(len(b))+1 > a.maxSize {
+		a.rotateLocked()
+	}
+	if a.file != nil {
+		n, err := a.file.Write(append(b, '\n'))
+		if err != nil {
+			logger.ControllerLog.Errorf("audit log write error: %v", err)
+		}
+		a.size += int64(n)
+	}
+	if a.writer != nil {
+		msg := kafka.Message{Key: []byte(r.Imsi), Value: b}
+		if err := a.writer.WriteMessages(context.Background(), msg); err != nil {
+			logger.ControllerLog.Warnf("audit log kafka write error: %v", err)
+		}
+	}
+}
+
+func (q *Query) matchImsi(r *Record) bool {
+	return q.Imsi == "" || normaliseImsi(r.Imsi) == normaliseImsi(q.Imsi)
+}
+
+// match also selects the records of the reports of the imsi, which do not
+// carry it themselves, by their report id
+func (q *Query) match(r *Record, reportIds map[string]bool) bool {
+	if !q.From.IsZero() && r.Time.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && r.Time.After(q.To) {
+		return false
+	}
+	return q.matchImsi(r) || (r.ReportId != "" && reportIds[r.ReportId])
+}
+
+// normaliseImsi drops the imsi- prefix, which some sources send and others
+// do not
+func normaliseImsi(imsi string) string {
+	return strings.TrimPrefix(imsi, "imsi-")
+}
+
+// Search returns the records of the audit log files matching the query,
+// oldest first. When a limit is set the most recent records are kept.
+func Search(q Query) ([]Record, error) {
+	a := auditor.Load()
+	if a == nil || a.path == "" {
+		return nil, ErrNotConfigured
+	}
+	paths := []string{a.path + rotatedSuffix, a.path}
+
+	var reportIds map[string]bool
+	if q.Imsi != "" {
+		reportIds = make(map[string]bool)
+		err := scan(paths, func(r *Record) {
+			if r.ReportId != "" && q.matchImsi(r) {
+				reportIds[r.ReportId] = true
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	records := []Record{}
+	err := scan(paths, func(r *Record) {
+		if !q.match(r, reportIds) {
+			return
+		}
+		records = append(records, *r)
+		if q.Limit > 0 && len(records) > q.Limit {
+			records = records[1:]
+		}
+	})
+	return records, err
+}
+
+// scan calls fn for each record of the files in order, skipping the files
+// which do not exist
+func scan(paths []string, fn func(r *Record)) error {
+	for _, path := range paths {
+		if err := scanFile(path, fn); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func scanFile(path string, fn func(r *Record)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			logger.ControllerLog.Warnf("audit log close error: %v", err)
+		}
+	}()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			logger.ControllerLog.Warnf("skipping malformed audit record: %v", err)
+			continue
+		}
+		fn(&r)
+	}
+	return scanner.Err()
+}
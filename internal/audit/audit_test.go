@@ -0,0 +1,132 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/omec-project/metricfunc/config"
+)
+
+func TestSearch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	if err := Init(&config.AuditLog{Enable: true, Path: path}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, imsi := range []string{"imsi-1", "imsi-2", "1", "imsi-1"} {
+		Add(Record{Time: start.Add(time.Duration(i) * time.Minute), Type: EventOutcome, Imsi: imsi})
+	}
+
+	records, err := Search(Query{Imsi: "imsi-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("unexpected record count: got %d want 3", len(records))
+	}
+	// with or without the imsi- prefix
+	if records, err := Search(Query{Imsi: "1"}); err != nil || len(records) != 3 {
+		t.Fatalf("unexpected records without the prefix: %+v, %v", records, err)
+	}
+
+	records, err = Search(Query{From: start.Add(time.Minute), To: start.Add(2 * time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Imsi != "imsi-2" {
+		t.Fatalf("unexpected time range result: %+v", records)
+	}
+
+	records, err = Search(Query{Imsi: "imsi-1", Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || !records[0].Time.Equal(start.Add(3*time.Minute)) {
+		t.Fatalf("expected only the latest record: %+v", records)
+	}
+}
+
+func TestSearchJoinsReports(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	if err := Init(&config.AuditLog{Enable: true, Path: path}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// the report and its expiry are recorded before the imsi is known
+	Add(Record{Type: EventRogueIpReport, ReportId: "r1", IpAddr: "10.0.0.1"})
+	Add(Record{Type: EventImsiResolution, ReportId: "r1", IpAddr: "10.0.0.1", Imsi: "imsi-1"})
+	Add(Record{Type: EventOutcome, ReportId: "r1", Outcome: "disabled"})
+	Add(Record{Type: EventRogueIpReport, ReportId: "r2", IpAddr: "10.0.0.2"})
+
+	records, err := Search(Query{Imsi: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[0].Type != EventRogueIpReport || records[2].Outcome != "disabled" {
+		t.Fatalf("unexpected records of the imsi: %+v", records)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	if err := Init(&config.AuditLog{Enable: true, Path: path}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	auditor.Load().maxSize = 200
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 10 {
+		Add(Record{Time: start.Add(time.Duration(i) * time.Minute), Type: EventOutcome, Imsi: "imsi-1"})
+	}
+	for _, p := range []string{path, path + rotatedSuffix} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > 200 {
+			t.Errorf("%s grew to %d bytes", p, info.Size())
+		}
+	}
+
+	// the records of both files are searched, oldest first
+	records, err := Search(Query{Imsi: "imsi-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) == 0 || len(records) >= 10 || !records[len(records)-1].Time.Equal(start.Add(9*time.Minute)) {
+		t.Fatalf("unexpected records after rotation: %+v", records)
+	}
+	for i := 1; i < len(records); i++ {
+		if records[i].Time.Before(records[i-1].Time) {
+			t.Fatalf("records out of order: %+v", records)
+		}
+	}
+}
+
+func TestSearchNotConfigured(t *testing.T) {
+	if _, err := Search(Query{}); err != ErrNotConfigured {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
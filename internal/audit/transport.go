@@ -0,0 +1,59 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package audit
+
+import (
+	"context"
+	"net/http"
+)
+
+type reportKey struct{}
+
+type reportInfo struct {
+	id   string
+	imsi string
+}
+
+// WithReport tags the context with the report being handled, so that the
+// outbound requests made with it are recorded against the report
+func WithReport(ctx context.Context, id, imsi string) context.Context {
+	return context.WithValue(ctx, reportKey{}, reportInfo{id: id, imsi: imsi})
+}
+
+type transport struct {
+	base http.RoundTripper
+}
+
+// Transport wraps the round tripper to record every request made with a
+// context tagged by WithReport
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{base: base}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	info, ok := req.Context().Value(reportKey{}).(reportInfo)
+	if !ok {
+		return t.base.RoundTrip(req)
+	}
+
+	rsp, err := t.base.RoundTrip(req)
+	r := Record{
+		Type:     EventUpstreamCall,
+		ReportId: info.id,
+		Imsi:     info.imsi,
+		Method:   req.Method,
+		Url:      req.URL.Redacted(),
+	}
+	if err != nil {
+		r.Error = err.Error()
+	} else {
+		r.StatusCode = rsp.StatusCode
+	}
+	Add(r)
+	return rsp, err
+}
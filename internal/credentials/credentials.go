@@ -0,0 +1,221 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package credentials adds authentication to outbound requests
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omec-project/metricfunc/config"
+	"github.com/omec-project/metricfunc/internal/tlsconfig"
+)
+
+const (
+	TypeBearer = "bearer"
+	TypeOAuth2 = "oauth2"
+	TypeBasic  = "basic"
+	TypeApiKey = "apikey"
+
+	defaultApiKeyHeader = "X-API-Key"
+	tokenTimeout        = 5 * time.Second
+)
+
+// Provider sets the credentials of a request
+type Provider interface {
+	Apply(req *http.Request) error
+}
+
+// invalidator is implemented by providers holding credentials which the
+// server may revoke, such as short lived access tokens
+type invalidator interface {
+	Invalidate()
+}
+
+// New returns the provider configured by cfg, or nil when cfg is nil.
+// httpClient is used to reach the token endpoint of oauth2.
+func New(cfg *config.Auth, httpClient *http.Client) (Provider, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	switch cfg.Type {
+	case TypeBearer:
+		token, err := NewSecret(cfg.Token, "token")
+		if err != nil {
+			return nil, err
+		}
+		return &bearer{token: token}, nil
+	case TypeBasic:
+		if cfg.Username == "" {
+			return nil, errors.New("basic auth requires a username")
+		}
+		password, err := NewSecret(cfg.Password, "password")
+		if err != nil {
+			return nil, err
+		}
+		return &basic{username: cfg.Username, password: password}, nil
+	case TypeApiKey:
+		key, err := NewSecret(cfg.ApiKey, "apiKey")
+		if err != nil {
+			return nil, err
+		}
+		header := cfg.Header
+		if header == "" {
+			header = defaultApiKeyHeader
+		}
+		return &apiKey{header: header, key: key}, nil
+	case TypeOAuth2:
+		return newClientCredentials(cfg, httpClient)
+	default:
+		return nil, fmt.Errorf("unknown auth type [%s]", cfg.Type)
+	}
+}
+
+// TokenClient returns the client of the oauth2 token endpoint of cfg. It
+// has a transport of its own, as the tls settings and http version of the
+// endpoint authenticated to are not those of the token endpoint: the tls
+// of cfg, the system roots if unset.
+func TokenClient(cfg *config.Auth) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg != nil && cfg.Tls != nil {
+		tlsCfg, err := tlsconfig.Client(cfg.Tls)
+		if err != nil {
+			return nil, fmt.Errorf("token endpoint: %w", err)
+		}
+		transport.TLSClientConfig = tlsCfg
+	}
+	return &http.Client{Transport: transport, Timeout: tokenTimeout}, nil
+}
+
+// Secret reads its value from a file or the environment. File contents are
+// re-read when the file changes, so rotated secrets are picked up.
+type Secret struct {
+	file    string
+	env     string
+	lock    sync.Mutex
+	value   string
+	modTime time.Time
+}
+
+// NewSecret fails when the secret, called name in errors, cannot be read
+func NewSecret(cfg *config.Secret, name string) (*Secret, error) {
+	if cfg == nil || (cfg.File == "" && cfg.Env == "") {
+		return nil, fmt.Errorf("%s must be read from a file or an environment variable", name)
+	}
+	s := &Secret{file: cfg.File, env: cfg.Env}
+	if _, err := s.Get(); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return s, nil
+}
+
+// Get returns the current value of the secret, never empty as an empty
+// token would match an empty bearer
+func (s *Secret) Get() (string, error) {
+	if s.file == "" {
+		value, ok := os.LookupEnv(s.env)
+		switch {
+		case !ok:
+			return "", fmt.Errorf("environment variable [%s] not set", s.env)
+		case value == "":
+			return "", fmt.Errorf("environment variable [%s] empty", s.env)
+		}
+		return value, nil
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	info, err := os.Stat(s.file)
+	if err != nil {
+		return "", err
+	}
+	if !info.ModTime().Equal(s.modTime) {
+		b, err := os.ReadFile(s.file)
+		if err != nil {
+			return "", err
+		}
+		s.value = strings.TrimSpace(string(b))
+		s.modTime = info.ModTime()
+	}
+	if s.value == "" {
+		return "", fmt.Errorf("file [%s] empty", s.file)
+	}
+	return s.value, nil
+}
+
+type bearer struct {
+	token *Secret
+}
+
+func (b *bearer) Apply(req *http.Request) error {
+	token, err := b.token.Get()
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+type basic struct {
+	username string
+	password *Secret
+}
+
+func (b *basic) Apply(req *http.Request) error {
+	password, err := b.password.Get()
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(b.username, password)
+	return nil
+}
+
+type apiKey struct {
+	header string
+	key    *Secret
+}
+
+func (a *apiKey) Apply(req *http.Request) error {
+	key, err := a.key.Get()
+	if err != nil {
+		return err
+	}
+	req.Header.Set(a.header, key)
+	return nil
+}
+
+type transport struct {
+	base     http.RoundTripper
+	provider Provider
+}
+
+// Transport wraps the round tripper to authenticate every request with
+// the provider. It returns base unchanged when provider is nil.
+func Transport(base http.RoundTripper, provider Provider) http.RoundTripper {
+	if provider == nil {
+		return base
+	}
+	return &transport{base: base, provider: provider}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// a RoundTripper must not modify the caller's request
+	req = req.Clone(req.Context())
+	if err := t.provider.Apply(req); err != nil {
+		return nil, fmt.Errorf("apply credentials: %w", err)
+	}
+	rsp, err := t.base.RoundTrip(req)
+	if err == nil && rsp.StatusCode == http.StatusUnauthorized {
+		if i, ok := t.provider.(invalidator); ok {
+			i.Invalidate()
+		}
+	}
+	return rsp, err
+}
@@ -0,0 +1,180 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package credentials
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/omec-project/metricfunc/config"
+)
+
+func applyTo(t *testing.T, p Provider) *http.Request {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "http://roc/aether-roc-api/targets", nil)
+	if err := p.Apply(req); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	return req
+}
+
+func TestBearerTokenFileRotation(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("first\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := New(&config.Auth{Type: TypeBearer, Token: &config.Secret{File: tokenFile}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := applyTo(t, p).Header.Get("Authorization"); got != "Bearer first" {
+		t.Fatalf("unexpected header: %q", got)
+	}
+
+	if err := os.WriteFile(tokenFile, []byte("second"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(tokenFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if got := applyTo(t, p).Header.Get("Authorization"); got != "Bearer second" {
+		t.Fatalf("rotated token not used: %q", got)
+	}
+}
+
+func TestApiKeyFromEnv(t *testing.T) {
+	t.Setenv("METRICFUNC_TEST_API_KEY", "secret-key")
+	p, err := New(&config.Auth{Type: TypeApiKey, ApiKey: &config.Secret{Env: "METRICFUNC_TEST_API_KEY"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := applyTo(t, p).Header.Get(defaultApiKeyHeader); got != "secret-key" {
+		t.Fatalf("unexpected api key header: %q", got)
+	}
+}
+
+func TestTokenClient(t *testing.T) {
+	tokenServer := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer tokenServer.Close()
+
+	// the system roots do not know the test CA
+	client, err := TokenClient(&config.Auth{Type: TypeOAuth2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Get(tokenServer.URL); err == nil {
+		t.Fatal("expected the unknown CA to be rejected")
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tokenServer.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	client, err = TokenClient(&config.Auth{Type: TypeOAuth2, Tls: &config.TLS{CaFile: caFile}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp, err := client.Get(tokenServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = rsp.Body.Close()
+}
+
+func TestSecretRejectsEmptyValue(t *testing.T) {
+	t.Setenv("METRICFUNC_TEST_EMPTY", "")
+	if _, err := NewSecret(&config.Secret{Env: "METRICFUNC_TEST_EMPTY"}, "token"); err == nil {
+		t.Error("expected an empty environment variable to be rejected")
+	}
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte(" \n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSecret(&config.Secret{File: tokenFile}, "token"); err == nil {
+		t.Error("expected an empty file to be rejected")
+	}
+}
+
+func TestSecretRequiresSource(t *testing.T) {
+	if _, err := New(&config.Auth{Type: TypeBearer}, nil); err == nil {
+		t.Fatal("expected bearer auth without token source to be rejected")
+	}
+}
+
+func TestOAuth2ClientCredentials(t *testing.T) {
+	var issued atomic.Int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "metricfunc" || secret != "s3cret" || r.FormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		n := issued.Add(1)
+		_ = json.NewEncoder(w).Encode(tokenResponse{
+			AccessToken: fmt.Sprintf("token-%d", n),
+			TokenType:   "Bearer",
+			ExpiresIn:   300,
+		})
+	}))
+	defer tokenServer.Close()
+
+	t.Setenv("METRICFUNC_TEST_CLIENT_SECRET", "s3cret")
+	p, err := New(&config.Auth{
+		Type:         TypeOAuth2,
+		TokenUrl:     tokenServer.URL,
+		ClientId:     "metricfunc",
+		ClientSecret: &config.Secret{Env: "METRICFUNC_TEST_CLIENT_SECRET"},
+	}, tokenServer.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var revoked atomic.Bool
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if revoked.Load() && r.Header.Get("Authorization") == "Bearer token-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer api.Close()
+	client := &http.Client{Transport: Transport(http.DefaultTransport, p)}
+
+	get := func() int {
+		rsp, err := client.Get(api.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = rsp.Body.Close()
+		return rsp.StatusCode
+	}
+
+	// the token is cached across requests
+	for range 2 {
+		if status := get(); status != http.StatusOK {
+			t.Fatalf("unexpected status: %d", status)
+		}
+	}
+	if issued.Load() != 1 {
+		t.Fatalf("token fetched %d times, want 1", issued.Load())
+	}
+
+	// a 401 drops the revoked token and the next request fetches a new one
+	revoked.Store(true)
+	if status := get(); status != http.StatusUnauthorized {
+		t.Fatalf("unexpected status with revoked token: %d", status)
+	}
+	if status := get(); status != http.StatusOK || issued.Load() != 2 {
+		t.Fatalf("unexpected result: status %d after %d tokens", status, issued.Load())
+	}
+}
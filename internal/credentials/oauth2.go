@@ -0,0 +1,136 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package credentials
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omec-project/metricfunc/config"
+	"github.com/omec-project/metricfunc/logger"
+)
+
+// refreshMargin renews access tokens this long before they expire
+const refreshMargin = 30 * time.Second
+
+// clientCredentials fetches access tokens with the OAuth2 client
+// credentials grant, as offered by Keycloak in front of Aether ROC
+type clientCredentials struct {
+	tokenUrl     string
+	clientId     string
+	clientSecret *Secret
+	scopes       []string
+	httpClient   *http.Client
+
+	lock    sync.Mutex
+	token   string
+	expires time.Time
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+func newClientCredentials(cfg *config.Auth, httpClient *http.Client) (*clientCredentials, error) {
+	if cfg.TokenUrl == "" || cfg.ClientId == "" {
+		return nil, errors.New("oauth2 requires tokenUrl and clientId")
+	}
+	clientSecret, err := NewSecret(cfg.ClientSecret, "clientSecret")
+	if err != nil {
+		return nil, err
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &clientCredentials{
+		tokenUrl:     cfg.TokenUrl,
+		clientId:     cfg.ClientId,
+		clientSecret: clientSecret,
+		scopes:       cfg.Scopes,
+		httpClient:   httpClient,
+	}, nil
+}
+
+func (c *clientCredentials) Apply(req *http.Request) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.token == "" || time.Until(c.expires) < refreshMargin {
+		if err := c.fetchLocked(req); err != nil {
+			return err
+		}
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	return nil
+}
+
+func (c *clientCredentials) Invalidate() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.token = ""
+}
+
+func (c *clientCredentials) fetchLocked(orig *http.Request) error {
+	clientSecret, err := c.clientSecret.Get()
+	if err != nil {
+		return err
+	}
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(c.scopes) != 0 {
+		form.Set("scope", strings.Join(c.scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(orig.Context(), http.MethodPost, c.tokenUrl,
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(c.clientId), url.QueryEscape(clientSecret))
+
+	rsp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("token request: %w", err)
+	}
+	defer func() {
+		if err := rsp.Body.Close(); err != nil {
+			logger.ControllerLog.Warnf("body close error: %v", err)
+		}
+	}()
+	if rsp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(rsp.Body, 512))
+		return fmt.Errorf("token request returned [%d %s] %s", rsp.StatusCode,
+			http.StatusText(rsp.StatusCode), strings.TrimSpace(string(msg)))
+	}
+
+	var token tokenResponse
+	if err := json.NewDecoder(rsp.Body).Decode(&token); err != nil {
+		return fmt.Errorf("decode token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return errors.New("token response without access_token")
+	}
+	if token.TokenType != "" && !strings.EqualFold(token.TokenType, "bearer") {
+		return fmt.Errorf("unsupported token type [%s]", token.TokenType)
+	}
+
+	c.token = token.AccessToken
+	c.expires = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	if token.ExpiresIn == 0 {
+		// no lifetime given, renew every few minutes
+		c.expires = time.Now().Add(5 * time.Minute)
+	}
+	logger.ControllerLog.Debugf("access token for [%s] from [%s] valid until [%v]",
+		c.clientId, c.tokenUrl, c.expires.Format(time.RFC3339))
+	return nil
+}
@@ -0,0 +1,237 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package health collects the state of the metricfunc components for the
+// liveness and readiness probes
+package health
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/omec-project/metricfunc/logger"
+)
+
+type Status string
+
+const (
+	StatusUp       Status = "up"
+	StatusStarting Status = "starting"
+	// StatusDown is a component which is temporarily unavailable, such as
+	// an unreachable upstream
+	StatusDown Status = "down"
+	// StatusFailed is a component which stopped working for good
+	StatusFailed Status = "failed"
+	// StatusStopping is reported during the shutdown
+	StatusStopping Status = "stopping"
+)
+
+const (
+	// checkTimeout bounds the checks run for a probe
+	checkTimeout = 2 * time.Second
+	// checkCacheTime avoids running the checks for every probe
+	checkCacheTime = 5 * time.Second
+)
+
+// Check reports the state of a component, a detail such as the lag of a
+// kafka reader and an error when the component is down
+type Check func(ctx context.Context) (detail string, err error)
+
+// Component is the state of a component in the probe responses
+type Component struct {
+	Name   string    `json:"name"`
+	Status Status    `json:"status"`
+	Detail string    `json:"detail,omitempty"`
+	Since  time.Time `json:"since"`
+	// Critical components have to be up for the pod to be ready
+	Critical bool `json:"critical"`
+}
+
+// Report is the body of the probe responses
+type Report struct {
+	Status     Status      `json:"status"`
+	Components []Component `json:"components"`
+}
+
+type checked struct {
+	critical bool
+	check    Check
+	state    Component
+	checked  time.Time
+}
+
+var registry = struct {
+	lock       sync.Mutex
+	components map[string]*Component
+	checks     map[string]*checked
+	stopping   bool
+}{
+	components: make(map[string]*Component),
+	checks:     make(map[string]*checked),
+}
+
+// Track registers a component which reports its own state with Set, it
+// starts out as starting
+func Track(name string, critical bool) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	registry.components[name] = &Component{Name: name, Status: StatusStarting, Since: time.Now(), Critical: critical}
+}
+
+// Set updates the state of a tracked component
+func Set(name string, status Status, detail string) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	c, ok := registry.components[name]
+	if !ok {
+		c = &Component{Name: name}
+		registry.components[name] = c
+	}
+	if c.Status != status {
+		c.Since = time.Now()
+		if status == StatusDown || status == StatusFailed {
+			logger.AppLog.Warnf("component [%s] %s: %s", name, status, detail)
+		}
+	}
+	c.Status = status
+	c.Detail = detail
+}
+
+// AddCheck registers a component whose state is polled on the probes
+func AddCheck(name string, critical bool, check Check) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	registry.checks[name] = &checked{critical: critical, check: check}
+}
+
+// Remove drops a component, tracked or checked
+func Remove(name string) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	delete(registry.components, name)
+	delete(registry.checks, name)
+}
+
+// Stopping marks metricfunc unready for the rest of its life
+func Stopping() {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	registry.stopping = true
+}
+
+func runCheck(ctx context.Context, name string, c *checked) Component {
+	detail, err := c.check(ctx)
+	state := Component{Name: name, Status: StatusUp, Detail: detail, Critical: c.critical}
+	if err != nil {
+		state.Status = StatusDown
+		state.Detail = err.Error()
+	}
+	return state
+}
+
+// components returns the state of all components, running the checks whose
+// cached result is outdated
+func components(ctx context.Context) []Component {
+	registry.lock.Lock()
+	due := make(map[string]*checked)
+	for name, c := range registry.checks {
+		if time.Since(c.checked) >= checkCacheTime {
+			due[name] = c
+		}
+	}
+	registry.lock.Unlock()
+
+	// checks may dial remote services, run them outside the lock and in
+	// parallel
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	results := make(map[string]Component, len(due))
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	for name, c := range due {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			state := runCheck(ctx, name, c)
+			lock.Lock()
+			results[name] = state
+			lock.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	now := time.Now()
+	var all []Component
+	for name, c := range registry.checks {
+		if state, ok := results[name]; ok {
+			state.Since = c.state.Since
+			if state.Status != c.state.Status || c.state.Since.IsZero() {
+				state.Since = now
+			}
+			c.state = state
+			c.checked = now
+		}
+		all = append(all, c.state)
+	}
+	for _, c := range registry.components {
+		all = append(all, *c)
+	}
+	slices.SortFunc(all, func(a, b Component) int { return cmp.Compare(a.Name, b.Name) })
+	return all
+}
+
+// Live reports failed components, other states do not warrant a restart
+func Live(ctx context.Context) Report {
+	report := Report{Status: StatusUp, Components: components(ctx)}
+	for _, c := range report.Components {
+		if c.Status == StatusFailed {
+			report.Status = StatusFailed
+		}
+	}
+	return report
+}
+
+// Ready reports whether all critical components are up
+func Ready(ctx context.Context) Report {
+	report := Report{Status: StatusUp, Components: components(ctx)}
+	for _, c := range report.Components {
+		if c.Critical && c.Status != StatusUp && report.Status == StatusUp {
+			report.Status = StatusDown
+		}
+	}
+	registry.lock.Lock()
+	if registry.stopping {
+		report.Status = StatusStopping
+	}
+	registry.lock.Unlock()
+	return report
+}
+
+func writeReport(w http.ResponseWriter, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status != StatusUp {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		logger.AppLog.Warnf("write health report error: %v", err)
+	}
+}
+
+// LiveHandler serves the liveness probe
+func LiveHandler(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, Live(r.Context()))
+}
+
+// ReadyHandler serves the readiness probe
+func ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, Ready(r.Context()))
+}
@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func resetRegistry(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		registry.lock.Lock()
+		defer registry.lock.Unlock()
+		registry.components = make(map[string]*Component)
+		registry.checks = make(map[string]*checked)
+		registry.stopping = false
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestReady(t *testing.T) {
+	resetRegistry(t)
+	Track("api server", true)
+	AddCheck("upstream user-app", false, func(context.Context) (string, error) {
+		return "", errors.New("circuit open")
+	})
+
+	if report := Ready(context.Background()); report.Status != StatusDown {
+		t.Fatalf("expected not ready while starting, got %s", report.Status)
+	}
+
+	Set("api server", StatusUp, "listening")
+	report := Ready(context.Background())
+	if report.Status != StatusUp {
+		t.Fatalf("a non critical component kept the pod unready: %+v", report)
+	}
+	if len(report.Components) != 2 || report.Components[1].Status != StatusDown ||
+		report.Components[1].Detail != "circuit open" {
+		t.Fatalf("unexpected components %+v", report.Components)
+	}
+
+	Stopping()
+	if report := Ready(context.Background()); report.Status != StatusStopping {
+		t.Fatalf("expected stopping, got %s", report.Status)
+	}
+}
+
+func TestLive(t *testing.T) {
+	resetRegistry(t)
+	Track("prometheus server", true)
+	if report := Live(context.Background()); report.Status != StatusUp {
+		t.Fatalf("a starting component is alive, got %s", report.Status)
+	}
+	Set("prometheus server", StatusFailed, "address already in use")
+	if report := Live(context.Background()); report.Status != StatusFailed {
+		t.Fatalf("expected failed, got %s", report.Status)
+	}
+}
+
+func TestCheckCached(t *testing.T) {
+	resetRegistry(t)
+	var calls atomic.Int32
+	AddCheck("kafka reader test", true, func(context.Context) (string, error) {
+		calls.Add(1)
+		return "lag 0", nil
+	})
+	Ready(context.Background())
+	Ready(context.Background())
+	if calls.Load() != 1 {
+		t.Fatalf("check run %d times within the cache time", calls.Load())
+	}
+}
+
+func TestReadyHandler(t *testing.T) {
+	resetRegistry(t)
+	AddCheck("kafka reader test", true, func(context.Context) (string, error) {
+		return "", errors.New("connection refused")
+	})
+
+	rec := httptest.NewRecorder()
+	ReadyHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("unexpected status %d", rec.Code)
+	}
+	var report Report
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Status != StatusDown || len(report.Components) != 1 || !report.Components[0].Critical {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
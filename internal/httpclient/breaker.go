@@ -0,0 +1,154 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package httpclient
+
+import (
+	"sync"
+	"time"
+
+	"github.com/omec-project/metricfunc/internal/promclient"
+	"github.com/omec-project/metricfunc/logger"
+)
+
+type breakerState int
+
+const (
+	stateClosed breakerState = iota
+	stateOpen
+	stateHalfOpen
+)
+
+// breaker opens after a run of consecutive failures and lets a single
+// trial request through once the open timeout has passed
+type breaker struct {
+	lock        sync.Mutex
+	upstream    string
+	threshold   int
+	openTimeout time.Duration
+	state       breakerState
+	failures    int
+	openedAt    time.Time
+	trial       bool
+}
+
+func newBreaker(upstream string, threshold int, openTimeout time.Duration) *breaker {
+	promclient.SetUpstreamCircuitOpen(upstream, false)
+	return &breaker{
+		upstream:    upstream,
+		threshold:   threshold,
+		openTimeout: openTimeout,
+	}
+}
+
+func (b *breaker) allow() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	switch b.state {
+	case stateOpen:
+		if time.Since(b.openedAt) < b.openTimeout {
+			return false
+		}
+		b.state = stateHalfOpen
+		b.trial = true
+		return true
+	case stateHalfOpen:
+		// only the trial request is let through
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *breaker) success() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.state != stateClosed {
+		logger.ControllerLog.Infof("[%s] circuit closed", b.upstream)
+		promclient.SetUpstreamCircuitOpen(b.upstream, false)
+	}
+	b.state = stateClosed
+	b.failures = 0
+	b.trial = false
+}
+
+func (b *breaker) failure() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.failures++
+	b.trial = false
+	if b.state == stateHalfOpen || (b.state == stateClosed && b.failures >= b.threshold) {
+		if b.state == stateClosed {
+			logger.ControllerLog.Warnf("[%s] circuit opened after [%d] consecutive failures", b.upstream, b.failures)
+		}
+		b.state = stateOpen
+		b.openedAt = time.Now()
+		promclient.SetUpstreamCircuitOpen(b.upstream, true)
+	}
+}
+
+// status returns the state of the circuit and the consecutive failures
+func (b *breaker) status() (breakerState, int) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.state, b.failures
+}
+
+// retryBudget caps retries to a ratio of the requests seen over the last
+// budgetWindow, so a struggling upstream is not flooded with retries
+type retryBudget struct {
+	lock       sync.Mutex
+	ratio      float64
+	minRetries int
+	requests   [budgetWindow]int
+	retries    [budgetWindow]int
+	slot       int64
+}
+
+const budgetWindow = 10 // seconds
+
+func newRetryBudget(ratio float64, minRetries int) *retryBudget {
+	return &retryBudget{ratio: ratio, minRetries: minRetries}
+}
+
+// advanceLocked clears the per second slots which fell out of the window
+func (r *retryBudget) advanceLocked() int {
+	now := time.Now().Unix()
+	for r.slot < now {
+		r.slot++
+		i := r.slot % budgetWindow
+		r.requests[i] = 0
+		r.retries[i] = 0
+		if now-r.slot >= budgetWindow {
+			r.slot = now - budgetWindow
+		}
+	}
+	return int(now % budgetWindow)
+}
+
+func (r *retryBudget) request() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.requests[r.advanceLocked()]++
+}
+
+func (r *retryBudget) withdraw() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	i := r.advanceLocked()
+	requests, retries := 0, 0
+	for j := range budgetWindow {
+		requests += r.requests[j]
+		retries += r.retries[j]
+	}
+	if retries >= r.minRetries && float64(retries) >= r.ratio*float64(requests) {
+		return false
+	}
+	r.retries[i]++
+	return true
+}
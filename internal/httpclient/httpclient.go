@@ -0,0 +1,217 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package httpclient is the outbound HTTP client used by the controller.
+// Every upstream gets its own Client with bounded, jittered retries, a
+// retry budget and a circuit breaker.
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/omec-project/metricfunc/internal/promclient"
+	"github.com/omec-project/metricfunc/logger"
+)
+
+// Options tune the retry and circuit breaking behaviour of a Client. Zero
+// values select the defaults.
+type Options struct {
+	MaxAttempts      int           // attempts per call, including the first one
+	AttemptTimeout   time.Duration // deadline of a single attempt
+	BackoffBase      time.Duration
+	BackoffMax       time.Duration
+	RetryBudgetRatio float64       // retries allowed per request over the budget window
+	MinRetries       int           // retries always allowed over the budget window
+	FailureThreshold int           // consecutive failures opening the circuit
+	OpenTimeout      time.Duration // time the circuit stays open before a trial request
+}
+
+func (o *Options) setDefaults() {
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 3
+	}
+	if o.AttemptTimeout <= 0 {
+		o.AttemptTimeout = 5 * time.Second
+	}
+	if o.BackoffBase <= 0 {
+		o.BackoffBase = 200 * time.Millisecond
+	}
+	if o.BackoffMax <= 0 {
+		o.BackoffMax = 10 * time.Second
+	}
+	if o.RetryBudgetRatio <= 0 {
+		o.RetryBudgetRatio = 0.2
+	}
+	if o.MinRetries <= 0 {
+		o.MinRetries = 10
+	}
+	if o.FailureThreshold <= 0 {
+		o.FailureThreshold = 5
+	}
+	if o.OpenTimeout <= 0 {
+		o.OpenTimeout = 30 * time.Second
+	}
+}
+
+// ErrCircuitOpen is returned without contacting the upstream while its
+// circuit is open
+var ErrCircuitOpen = errors.New("circuit open")
+
+// Client sends requests to a single upstream. It implements the Do method
+// of http.Client, taking the deadline and cancellation from the request
+// context.
+type Client struct {
+	upstream   string
+	httpClient *http.Client
+	opts       Options
+	breaker    *breaker
+	budget     *retryBudget
+}
+
+func New(upstream string, httpClient *http.Client, opts Options) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	opts.setDefaults()
+	return &Client{
+		upstream:   upstream,
+		httpClient: httpClient,
+		opts:       opts,
+		breaker:    newBreaker(upstream, opts.FailureThreshold, opts.OpenTimeout),
+		budget:     newRetryBudget(opts.RetryBudgetRatio, opts.MinRetries),
+	}
+}
+
+func (c *Client) Upstream() string {
+	return c.upstream
+}
+
+// Check reports the upstream as down while its circuit is open. It relies
+// on the outcome of the requests sent and does not contact the upstream
+// itself.
+func (c *Client) Check(context.Context) (string, error) {
+	state, failures := c.breaker.status()
+	if state != stateClosed {
+		return "", fmt.Errorf("%w after %d consecutive failures", ErrCircuitOpen, failures)
+	}
+	return fmt.Sprintf("%d consecutive failures", failures), nil
+}
+
+// retryable reports whether the response status is worth another attempt
+func retryable(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+}
+
+// backoff returns the full jitter delay before the given retry
+func (c *Client) backoff(retry int) time.Duration {
+	ceiling := c.opts.BackoffBase << retry
+	if ceiling <= 0 || ceiling > c.opts.BackoffMax {
+		ceiling = c.opts.BackoffMax
+	}
+	return rand.N(ceiling) + 1
+}
+
+// Do sends the request, retrying network errors and 429/5xx responses.
+// Responses with other statuses are returned to the caller as is.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	c.budget.request()
+
+	var lastErr error
+	for attempt := range c.opts.MaxAttempts {
+		if attempt > 0 {
+			if req.Body != nil && req.GetBody == nil {
+				break
+			}
+			if !c.budget.withdraw() {
+				lastErr = fmt.Errorf("retry budget exhausted: %w", lastErr)
+				break
+			}
+			delay := c.backoff(attempt - 1)
+			logger.ControllerLog.Warnf("[%s] %s %s attempt %d failed, retrying in %v: %v",
+				c.upstream, req.Method, req.URL.Redacted(), attempt, delay, lastErr)
+			select {
+			case <-ctx.Done():
+				return nil, errors.Join(ctx.Err(), lastErr)
+			case <-time.After(delay):
+			}
+		}
+
+		if !c.breaker.allow() {
+			promclient.IncrementUpstreamAttempts(c.upstream, "circuit_open")
+			return nil, fmt.Errorf("[%s] %w", c.upstream, ErrCircuitOpen)
+		}
+
+		rsp, err := c.attempt(req, attempt)
+		if err == nil && !retryable(rsp.StatusCode) {
+			c.breaker.success()
+			promclient.IncrementUpstreamAttempts(c.upstream, "success")
+			return rsp, nil
+		}
+
+		c.breaker.failure()
+		promclient.IncrementUpstreamFailures(c.upstream)
+		if err != nil {
+			promclient.IncrementUpstreamAttempts(c.upstream, "error")
+			lastErr = err
+		} else {
+			promclient.IncrementUpstreamAttempts(c.upstream, "retryable_status")
+			lastErr = fmt.Errorf("status %d %s", rsp.StatusCode, http.StatusText(rsp.StatusCode))
+			if attempt == c.opts.MaxAttempts-1 {
+				return rsp, nil
+			}
+			drain(rsp)
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, fmt.Errorf("[%s] %s %s failed: %w", c.upstream, req.Method, req.URL.Redacted(), lastErr)
+}
+
+func (c *Client) attempt(req *http.Request, attempt int) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), c.opts.AttemptTimeout)
+	areq := req.Clone(ctx)
+	if attempt > 0 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		areq.Body = body
+	}
+
+	rsp, err := c.httpClient.Do(areq)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// the attempt deadline keeps applying while the caller reads the body
+	rsp.Body = &cancelBody{ReadCloser: rsp.Body, cancel: cancel}
+	return rsp, nil
+}
+
+func drain(rsp *http.Response) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(rsp.Body, 4096))
+	if err := rsp.Body.Close(); err != nil {
+		logger.ControllerLog.Warnf("body close error: %v", err)
+	}
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
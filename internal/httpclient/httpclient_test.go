@@ -0,0 +1,126 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testOptions = Options{
+	MaxAttempts:      3,
+	BackoffBase:      time.Millisecond,
+	BackoffMax:       2 * time.Millisecond,
+	FailureThreshold: 2,
+	OpenTimeout:      time.Hour,
+}
+
+func TestDoRetriesServerErrors(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != "payload" {
+			t.Errorf("unexpected body on attempt %d: %q", calls.Load()+1, body)
+		}
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	c := New("test", server.Client(), testOptions)
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPatch, server.URL,
+		strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	_ = rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK || calls.Load() != 2 {
+		t.Fatalf("unexpected result: status %d after %d calls", rsp.StatusCode, calls.Load())
+	}
+}
+
+func TestDoDoesNotRetryClientErrors(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	c := New("test", server.Client(), testOptions)
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	_ = rsp.Body.Close()
+	if rsp.StatusCode != http.StatusNotFound || calls.Load() != 1 {
+		t.Fatalf("unexpected result: status %d after %d calls", rsp.StatusCode, calls.Load())
+	}
+}
+
+func TestCircuitOpensAfterFailures(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	c := New("test", server.Client(), testOptions)
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Do(req)
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected open circuit, got %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("unexpected number of calls before the circuit opened: %d", calls.Load())
+	}
+
+	if _, err := c.Do(req); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected request to be rejected by the open circuit, got %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("upstream called while the circuit was open")
+	}
+	if _, err := c.Check(context.Background()); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected check to report the open circuit, got %v", err)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	budget := newRetryBudget(0.5, 1)
+	for range 4 {
+		budget.request()
+	}
+	for i := range 2 {
+		if !budget.withdraw() {
+			t.Fatalf("retry %d denied within budget", i)
+		}
+	}
+	if budget.withdraw() {
+		t.Fatal("retry allowed beyond budget")
+	}
+}
@@ -0,0 +1,165 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package lifecycle runs the components of metricfunc and stops them in
+// order on shutdown
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omec-project/metricfunc/config"
+	"github.com/omec-project/metricfunc/internal/health"
+	"github.com/omec-project/metricfunc/internal/tlsconfig"
+	"github.com/omec-project/metricfunc/logger"
+)
+
+// Component is a long running part of metricfunc
+type Component struct {
+	Name string
+	// Run blocks while the component is up. Its context is cancelled when
+	// the shutdown begins. May be nil.
+	Run func(ctx context.Context) error
+	// Stop releases the component before the deadline of ctx. May be nil.
+	Stop func(ctx context.Context) error
+}
+
+// Manager starts components and stops them in reverse order of start, on a
+// signal or as soon as one of them fails
+type Manager struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	failed chan error
+
+	lock       sync.Mutex
+	components []Component
+	running    map[string]int
+	wg         sync.WaitGroup
+}
+
+func New() *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{
+		ctx:     ctx,
+		cancel:  cancel,
+		failed:  make(chan error, 1),
+		running: make(map[string]int),
+	}
+}
+
+// Start runs the component
+func (m *Manager) Start(c Component) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.components = append(m.components, c)
+	if c.Run == nil {
+		return
+	}
+
+	m.running[c.Name]++
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		err := c.Run(m.ctx)
+		m.lock.Lock()
+		m.running[c.Name]--
+		m.lock.Unlock()
+		if err != nil && m.ctx.Err() == nil {
+			select {
+			case m.failed <- fmt.Errorf("%s: %w", c.Name, err):
+			default:
+			}
+		}
+	}()
+}
+
+// Run waits until ctx is done or a component fails, then stops all
+// components within timeout. It returns the failure and the errors of the
+// shutdown.
+func (m *Manager) Run(ctx context.Context, timeout time.Duration) error {
+	var errs []error
+	select {
+	case <-ctx.Done():
+		logger.AppLog.Infof("shutting down within [%v]", timeout)
+	case err := <-m.failed:
+		logger.AppLog.Errorf("shutting down within [%v] after failure: %v", timeout, err)
+		errs = append(errs, err)
+	}
+	health.Stopping()
+	m.cancel()
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	m.lock.Lock()
+	components := m.components
+	m.lock.Unlock()
+	for i := len(components) - 1; i >= 0; i-- {
+		c := components[i]
+		if c.Stop == nil {
+			continue
+		}
+		logger.AppLog.Infof("stopping [%s]", c.Name)
+		if err := c.Stop(stopCtx); err != nil {
+			logger.AppLog.Errorf("stop [%s] failed: %v", c.Name, err)
+			errs = append(errs, fmt.Errorf("stop %s: %w", c.Name, err))
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		logger.AppLog.Infoln("shutdown complete")
+	case <-stopCtx.Done():
+		errs = append(errs, fmt.Errorf("still running after %v: %s", timeout, m.stillRunning()))
+	}
+	return errors.Join(errs...)
+}
+
+func (m *Manager) stillRunning() string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	var names []string
+	for name, n := range m.running {
+		if n > 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// HttpServer serves server, over TLS when tlsCfg is set, until the
+// shutdown, which lets active requests complete
+func HttpServer(name string, server *http.Server, tlsCfg *config.TLS) Component {
+	health.Track(name, true)
+	return Component{
+		Name: name,
+		Run: func(context.Context) error {
+			ln, err := net.Listen("tcp", server.Addr)
+			if err != nil {
+				health.Set(name, health.StatusFailed, err.Error())
+				return err
+			}
+			logger.AppLog.Infof("[%s] listening on [%s], tls [%v]", name, ln.Addr(), tlsCfg != nil)
+			health.Set(name, health.StatusUp, "listening on "+ln.Addr().String())
+			if err := tlsconfig.Serve(server, ln, tlsCfg); !errors.Is(err, http.ErrServerClosed) {
+				health.Set(name, health.StatusFailed, err.Error())
+				return err
+			}
+			return nil
+		},
+		Stop: server.Shutdown,
+	}
+}
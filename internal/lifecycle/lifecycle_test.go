@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStopInReverseOrder(t *testing.T) {
+	m := New()
+	var lock sync.Mutex
+	var stopped []string
+	for _, name := range []string{"controller", "kafka readers", "api server"} {
+		m.Start(Component{
+			Name: name,
+			Run: func(ctx context.Context) error {
+				<-ctx.Done()
+				return nil
+			},
+			Stop: func(context.Context) error {
+				lock.Lock()
+				defer lock.Unlock()
+				stopped = append(stopped, name)
+				return nil
+			},
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := m.Run(ctx, time.Second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := strings.Join(stopped, ","); got != "api server,kafka readers,controller" {
+		t.Fatalf("unexpected stop order: %s", got)
+	}
+}
+
+func TestFailureStopsAll(t *testing.T) {
+	m := New()
+	stopped := make(chan struct{})
+	m.Start(Component{
+		Name: "controller",
+		Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		},
+		Stop: func(context.Context) error {
+			close(stopped)
+			return nil
+		},
+	})
+	listenErr := errors.New("address already in use")
+	m.Start(Component{Name: "api server", Run: func(context.Context) error { return listenErr }})
+
+	err := m.Run(context.Background(), time.Second)
+	if !errors.Is(err, listenErr) {
+		t.Fatalf("failure not reported: %v", err)
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Fatal("remaining component not stopped")
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	m := New()
+	block := make(chan struct{})
+	defer close(block)
+	m.Start(Component{Name: "kafka readers", Run: func(context.Context) error {
+		<-block
+		return nil
+	}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := m.Run(ctx, 10*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "kafka readers") {
+		t.Fatalf("expected the stuck component to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metricdata
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/omec-project/metricfunc/internal/privacy"
+	"github.com/omec-project/metricfunc/logger"
+)
+
+const defaultIpLeaseRetention = 24 * time.Hour
+
+// IpLease records that a subscriber held a UE ip address during an interval
+type IpLease struct {
+	IpAddr string    `json:"ip-addr"`
+	Imsi   string    `json:"imsi"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end,omitempty"` // zero while the lease is active
+}
+
+func (l *IpLease) active() bool {
+	return l.End.IsZero()
+}
+
+func (l *IpLease) covers(at time.Time) bool {
+	return !at.Before(l.Start) && (l.active() || !at.After(l.End))
+}
+
+type ipLeases struct {
+	lock      sync.RWMutex
+	leases    map[string][]*IpLease // ip-addr is key, oldest first
+	retention time.Duration
+	lastPrune time.Time
+	observers []func(IpLease)
+}
+
+var leaseHistory = ipLeases{
+	leases:    make(map[string][]*IpLease),
+	retention: defaultIpLeaseRetention,
+}
+
+// count returns the number of leases kept, active and ended
+func (h *ipLeases) count() int {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	n := 0
+	for _, leases := range h.leases {
+		n += len(leases)
+	}
+	return n
+}
+
+// SetIpLeaseRetention sets for how long ended leases are kept
+func SetIpLeaseRetention(retention time.Duration) {
+	if retention <= 0 {
+		retention = defaultIpLeaseRetention
+	}
+	leaseHistory.lock.Lock()
+	defer leaseHistory.lock.Unlock()
+	leaseHistory.retention = retention
+}
+
+// AddIpLeaseObserver registers fn to be called whenever a subscriber starts
+// holding an ip address. fn must not block.
+func AddIpLeaseObserver(fn func(IpLease)) {
+	leaseHistory.lock.Lock()
+	defer leaseHistory.lock.Unlock()
+	leaseHistory.observers = append(leaseHistory.observers, fn)
+}
+
+func startIpLease(ipAddr, imsi string, at time.Time) {
+	if ipAddr == "" {
+		return
+	}
+
+	leaseHistory.lock.Lock()
+	leases := leaseHistory.leases[ipAddr]
+	if n := len(leases); n != 0 && leases[n-1].active() {
+		if leases[n-1].Imsi == imsi {
+			leaseHistory.lock.Unlock()
+			return
+		}
+		// the address was reassigned without us seeing the release
+		leases[n-1].End = at
+	}
+	lease := &IpLease{IpAddr: ipAddr, Imsi: imsi, Start: at}
+	leaseHistory.leases[ipAddr] = append(leases, lease)
+	// leases are stamped with the event time, retention is kept by the clock
+	leaseHistory.pruneLocked(time.Now())
+	observers := leaseHistory.observers
+	leaseHistory.lock.Unlock()
+
+	logger.CacheLog.Debugf("ip-addr [%s] leased to imsi [%s]",
+		privacy.IpAddr(privacy.Logs, ipAddr), privacy.Imsi(privacy.Logs, imsi))
+	for _, observer := range observers {
+		observer(*lease)
+	}
+}
+
+func endIpLease(ipAddr, imsi string, at time.Time) {
+	if ipAddr == "" {
+		return
+	}
+
+	leaseHistory.lock.Lock()
+	defer leaseHistory.lock.Unlock()
+	leases := leaseHistory.leases[ipAddr]
+	if n := len(leases); n != 0 && leases[n-1].active() && leases[n-1].Imsi == imsi {
+		leases[n-1].End = at
+		logger.CacheLog.Debugf("ip-addr [%s] released by imsi [%s]",
+			privacy.IpAddr(privacy.Logs, ipAddr), privacy.Imsi(privacy.Logs, imsi))
+	}
+}
+
+// pruneLocked drops the leases which ended before the retention period,
+// at most once a minute
+func (h *ipLeases) pruneLocked(now time.Time) {
+	if now.Sub(h.lastPrune) < time.Minute {
+		return
+	}
+	h.lastPrune = now
+	cutoff := now.Add(-h.retention)
+	for ipAddr, leases := range h.leases {
+		kept := leases[:0]
+		for _, lease := range leases {
+			if lease.active() || lease.End.After(cutoff) {
+				kept = append(kept, lease)
+			}
+		}
+		if len(kept) == 0 {
+			delete(h.leases, ipAddr)
+		} else {
+			h.leases[ipAddr] = kept
+		}
+	}
+}
+
+// GetImsiFromIpAddrAt returns the imsi which held the ip address at the
+// given time, including subscribers which have since released it
+func GetImsiFromIpAddrAt(ipAddr string, at time.Time) (string, error) {
+	leaseHistory.lock.RLock()
+	defer leaseHistory.lock.RUnlock()
+	leases := leaseHistory.leases[ipAddr]
+	for i := len(leases) - 1; i >= 0; i-- {
+		if leases[i].covers(at) {
+			return leases[i].Imsi, nil
+		}
+	}
+	return "", fmt.Errorf("no lease of ip-addr [%v] at [%v]",
+		privacy.IpAddr(privacy.Logs, ipAddr), at.Format(time.RFC3339))
+}
+
+// GetIpLeaseHistory returns the retained leases of the ip address, oldest first
+func GetIpLeaseHistory(ipAddr string) []IpLease {
+	leaseHistory.lock.RLock()
+	defer leaseHistory.lock.RUnlock()
+	history := []IpLease{}
+	for _, lease := range leaseHistory.leases[ipAddr] {
+		history = append(history, *lease)
+	}
+	return history
+}
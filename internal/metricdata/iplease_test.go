@@ -0,0 +1,52 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metricdata
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIpLeaseHistory(t *testing.T) {
+	const ipAddr = "10.250.0.7"
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var observed []IpLease
+	AddIpLeaseObserver(func(lease IpLease) { observed = append(observed, lease) })
+
+	startIpLease(ipAddr, "imsi-1", start)
+	endIpLease(ipAddr, "imsi-1", start.Add(time.Minute))
+	startIpLease(ipAddr, "imsi-2", start.Add(2*time.Minute))
+	// a repeated add of the active holder does not open a new lease
+	startIpLease(ipAddr, "imsi-2", start.Add(3*time.Minute))
+
+	for _, tc := range []struct {
+		at   time.Duration
+		imsi string
+	}{
+		{30 * time.Second, "imsi-1"},
+		{time.Minute, "imsi-1"},
+		{90 * time.Second, ""},
+		{10 * time.Minute, "imsi-2"},
+	} {
+		imsi, err := GetImsiFromIpAddrAt(ipAddr, start.Add(tc.at))
+		if tc.imsi == "" {
+			if err == nil {
+				t.Errorf("at %v: expected no holder, got %q", tc.at, imsi)
+			}
+			continue
+		}
+		if err != nil || imsi != tc.imsi {
+			t.Errorf("at %v: got %q, %v want %q", tc.at, imsi, err, tc.imsi)
+		}
+	}
+
+	if history := GetIpLeaseHistory(ipAddr); len(history) != 2 {
+		t.Fatalf("unexpected history: %+v", history)
+	}
+	if len(observed) != 2 || observed[1].Imsi != "imsi-2" {
+		t.Fatalf("unexpected observed leases: %+v", observed)
+	}
+}
@@ -7,6 +7,7 @@ package metricdata
 import (
 	"sync"
 
+	"github.com/omec-project/metricfunc/internal/promclient"
 	"github.com/omec-project/util/metricinfo"
 )
 
@@ -16,7 +17,8 @@ type MetricData struct {
 	Subscribers  map[string]*metricinfo.CoreSubscriber
 	SubLock      sync.RWMutex
 	NfStatusLock sync.RWMutex
-	NfStatus     map[string]*metricinfo.CNfStatus
+	NfStatus     map[string]*NfStatus
+	NfProfiles   map[string]*NfProfile // by nf instance id, under the nf status lock
 	SmfSvcStats  nfServiceStats
 	AmfSvcStats  nfServiceStats
 }
@@ -24,8 +26,29 @@ type MetricData struct {
 func init() {
 	metricData = MetricData{
 		Subscribers: make(map[string]*metricinfo.CoreSubscriber),
-		NfStatus:    make(map[string]*metricinfo.CNfStatus),
+		NfStatus:    make(map[string]*NfStatus),
+		NfProfiles:  make(map[string]*NfProfile),
 		SmfSvcStats: nfServiceStats{svcStats: make(map[string]map[string]uint64)},
 		AmfSvcStats: nfServiceStats{svcStats: make(map[string]map[string]uint64)},
 	}
+
+	promclient.RegisterCacheSize("subscribers", func() int {
+		metricData.SubLock.RLock()
+		defer metricData.SubLock.RUnlock()
+		return len(metricData.Subscribers)
+	})
+	promclient.RegisterCacheSize("nfs", func() int {
+		metricData.NfStatusLock.RLock()
+		defer metricData.NfStatusLock.RUnlock()
+		return len(metricData.NfStatus)
+	})
+	promclient.RegisterCacheSize("nf_profiles", func() int {
+		metricData.NfStatusLock.RLock()
+		defer metricData.NfStatusLock.RUnlock()
+		return len(metricData.NfProfiles)
+	})
+	promclient.RegisterCacheSize("service_stats", func() int {
+		return metricData.SmfSvcStats.buckets() + metricData.AmfSvcStats.buckets()
+	})
+	promclient.RegisterCacheSize("ip_leases", leaseHistory.count)
 }
@@ -0,0 +1,122 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metricdata
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/util/metricinfo"
+)
+
+// NfProfile is the profile an nf instance registered in the NRF
+type NfProfile struct {
+	NfInstanceId      string              `json:"nfInstanceId"`
+	NfInstanceName    string              `json:"nfInstanceName,omitempty"`
+	NfType            metricinfo.NfType   `json:"nfType"`
+	NfStatus          models.NFStatus     `json:"nfStatus"`
+	Fqdn              string              `json:"fqdn,omitempty"`
+	Ipv4Addresses     []string            `json:"ipv4Addresses,omitempty"`
+	Ipv6Addresses     []string            `json:"ipv6Addresses,omitempty"`
+	PlmnList          []models.PlmnId     `json:"plmnList,omitempty"`
+	SNssais           []models.Snssai     `json:"sNssais,omitempty"`
+	PerPlmnSnssaiList []models.PlmnSnssai `json:"perPlmnSnssaiList,omitempty"`
+	Updated           time.Time           `json:"updated"` // fetched from the NRF
+}
+
+// ids returns the names the nf may be known by in the events, its
+// instance id, name, fqdn or addresses
+func (p *NfProfile) ids() []string {
+	ids := []string{p.NfInstanceId, p.NfInstanceName, p.Fqdn}
+	ids = append(ids, p.Ipv4Addresses...)
+	ids = append(ids, p.Ipv6Addresses...)
+	return slices.DeleteFunc(ids, func(id string) bool { return id == "" })
+}
+
+// SetNfProfiles replaces the profiles of the nfs of the type, those the
+// NRF no longer knows removed
+func SetNfProfiles(nfType metricinfo.NfType, profiles []NfProfile) {
+	metricData.NfStatusLock.Lock()
+	defer metricData.NfStatusLock.Unlock()
+
+	maps.DeleteFunc(metricData.NfProfiles, func(_ string, p *NfProfile) bool { return p.NfType == nfType })
+	for _, profile := range profiles {
+		metricData.NfProfiles[profile.NfInstanceId] = &profile
+	}
+}
+
+// nfInventory joins the status of the nfs with their NRF profiles and
+// service stats, adding the nfs only the NRF knows. The nf status lock is
+// held by the caller.
+func nfInventory(now time.Time) []NfStatus {
+	byId := make(map[string]*NfProfile)
+	for _, profile := range metricData.NfProfiles {
+		for _, id := range profile.ids() {
+			byId[id] = profile
+		}
+	}
+
+	var nfs []NfStatus
+	joined := make(map[*NfProfile]bool)
+	for _, nfStatus := range metricData.NfStatus {
+		nf := nfStatus.snapshot(now)
+		if profile, ok := byId[nf.NfName]; ok && (nf.NfType == "" || nf.NfType == profile.NfType) {
+			joined[profile] = true
+			nf.setProfile(profile)
+		}
+		nfs = append(nfs, nf)
+	}
+	for _, profile := range metricData.NfProfiles {
+		if joined[profile] {
+			continue
+		}
+		nf := NfStatus{NfName: cmp.Or(profile.NfInstanceName, profile.NfInstanceId)}
+		nf.setProfile(profile)
+		nfs = append(nfs, nf)
+	}
+	for i := range nfs {
+		nfs[i].ServiceStats = serviceStats(&nfs[i])
+	}
+	sortNfs(nfs)
+	return nfs
+}
+
+// setProfile adds the profile to the snapshot of the nf
+func (nf *NfStatus) setProfile(profile *NfProfile) {
+	p := *profile
+	nf.Profile = &p
+	nf.NfType = profile.NfType
+	nf.Health = nf.health()
+}
+
+// serviceStats returns the messages by type of the nf, kept by the id of
+// the amfs and smfs sending them
+func serviceStats(nf *NfStatus) map[string]uint64 {
+	var stats *nfServiceStats
+	switch nf.NfType {
+	case metricinfo.NfTypeSmf:
+		stats = &metricData.SmfSvcStats
+	case metricinfo.NfTypeAmf:
+		stats = &metricData.AmfSvcStats
+	default:
+		return nil
+	}
+	ids := []string{nf.NfName}
+	if nf.Profile != nil {
+		ids = append(ids, nf.Profile.ids()...)
+	}
+
+	stats.svcStatLock.RLock()
+	defer stats.svcStatLock.RUnlock()
+	for _, id := range ids {
+		if msgTypes, ok := stats.svcStats[id]; ok {
+			return maps.Clone(msgTypes)
+		}
+	}
+	return nil
+}
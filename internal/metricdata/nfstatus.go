@@ -5,43 +5,289 @@
 package metricdata
 
 import (
+	"context"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
 	"github.com/omec-project/metricfunc/internal/promclient"
+	"github.com/omec-project/metricfunc/internal/tracing"
+	"github.com/omec-project/metricfunc/logger"
+	"github.com/omec-project/openapi/v2/models"
 	"github.com/omec-project/util/metricinfo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func GetNfStatusbyNfType(nfType string) []metricinfo.CNfStatus {
-	var nfs []metricinfo.CNfStatus
-	metricData.NfStatusLock.RLock()
-	defer metricData.NfStatusLock.RUnlock()
+// NfStatusUnknown is the status of an nf silent for longer than the
+// staleness timeout
+const NfStatusUnknown metricinfo.NfStatusType = "Unknown"
+
+// health of an nf, merging the status it reports with the probes
+const (
+	NfHealthUp = "Up"
+	// NfHealthReportedDown is an nf reported disconnected
+	NfHealthReportedDown = "ReportedDown"
+	// NfHealthUnreachable is an nf not reported disconnected which failed
+	// a probe
+	NfHealthUnreachable = "Unreachable"
+	NfHealthUnknown     = "Unknown"
+)
+
+const (
+	// nfHistorySize status changes are kept per nf, the oldest dropped
+	// first
+	nfHistorySize = 20
+	// nfStatusCheckInterval is how often silent nfs are looked for
+	nfStatusCheckInterval = 5 * time.Second
+)
+
+// NfStatusChange is a change of the status of an nf
+type NfStatusChange struct {
+	Time     time.Time               `json:"time"`
+	NfStatus metricinfo.NfStatusType `json:"nfStatus"`
+}
+
+// NfProbeResult is the result of the last probe of an nf of a type
+type NfProbeResult struct {
+	Type            string    `json:"type"`
+	Reachable       bool      `json:"reachable"`
+	Time            time.Time `json:"time"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	Error           string    `json:"error,omitempty"`
+	Failures        int       `json:"failures,omitempty"` // in a row
+}
+
+// NfStatus is the status of an nf with its history. Uptime and downtime
+// add up the time spent connected and not connected since the nf first
+// reported a status. Nfs only probed or registered in the NRF have no
+// status.
+type NfStatus struct {
+	NfType          metricinfo.NfType       `json:"nfType,omitempty"`
+	NfStatus        metricinfo.NfStatusType `json:"nfStatus,omitempty"`
+	NfName          string                  `json:"nfName,omitempty"`
+	FirstSeen       time.Time               `json:"firstSeen"`
+	LastSeen        time.Time               `json:"lastSeen"` // of the last status event
+	Since           time.Time               `json:"since"`    // of the current status
+	UptimeSeconds   float64                 `json:"uptimeSeconds"`
+	DowntimeSeconds float64                 `json:"downtimeSeconds"`
+	// Flaps counts the times the nf went from connected to disconnected or
+	// unknown
+	Flaps   int              `json:"flaps"`
+	History []NfStatusChange `json:"history,omitempty"`
+	Health  string           `json:"health"`
+	Probes  []NfProbeResult  `json:"probes,omitempty"`
+	Profile *NfProfile       `json:"profile,omitempty"` // as registered in the NRF
+	// ServiceStats counts the messages by type of an amf or smf
+	ServiceStats map[string]uint64 `json:"serviceStats,omitempty"`
+
+	// uptime and downtime are those before Since
+	uptime, downtime time.Duration
+}
+
+// nfStatusTimeout is how long an nf may stay silent before its status is
+// unknown, zero to trust the last status forever
+var nfStatusTimeout atomic.Int64
+
+// SetNfStatusTimeout sets how long an nf may stay silent before its status
+// is unknown, zero never
+func SetNfStatusTimeout(timeout time.Duration) {
+	nfStatusTimeout.Store(int64(timeout))
+}
 
-	for _, nfStatus := range metricData.NfStatus {
-		if nfStatus.NfType == metricinfo.NfType(nfType) {
-			nfs = append(nfs, *nfStatus)
+// setStatus moves the nf to status at the time given
+func (nf *NfStatus) setStatus(status metricinfo.NfStatusType, at time.Time) {
+	if nf.NfStatus == status {
+		return
+	}
+	if !nf.Since.IsZero() {
+		if nf.NfStatus == metricinfo.NfStatusConnected {
+			nf.uptime += at.Sub(nf.Since)
+			nf.Flaps++
+		} else {
+			nf.downtime += at.Sub(nf.Since)
 		}
 	}
-	return nfs
+	nf.NfStatus = status
+	nf.Since = at
+	nf.History = append(nf.History, NfStatusChange{Time: at, NfStatus: status})
+	if len(nf.History) > nfHistorySize {
+		nf.History = slices.Delete(nf.History, 0, len(nf.History)-nfHistorySize)
+	}
+}
+
+// snapshot returns a copy of the nf with the durations up to now
+func (nf *NfStatus) snapshot(now time.Time) NfStatus {
+	s := *nf
+	s.History = slices.Clone(nf.History)
+	s.Probes = slices.Clone(nf.Probes)
+	s.Health = nf.health()
+	uptime, downtime := nf.durations(now)
+	s.UptimeSeconds, s.DowntimeSeconds = uptime.Seconds(), downtime.Seconds()
+	return s
+}
+
+func (nf *NfStatus) durations(now time.Time) (uptime, downtime time.Duration) {
+	uptime, downtime = nf.uptime, nf.downtime
+	if nf.Since.IsZero() {
+		return uptime, downtime
+	}
+	if nf.NfStatus == metricinfo.NfStatusConnected {
+		uptime += now.Sub(nf.Since)
+	} else {
+		downtime += now.Sub(nf.Since)
+	}
+	return uptime, downtime
+}
+
+// health tells a disconnection the nf reported apart from a failed probe
+func (nf *NfStatus) health() string {
+	switch {
+	case nf.NfStatus == metricinfo.NfStatusDisconnected:
+		return NfHealthReportedDown
+	case slices.ContainsFunc(nf.Probes, func(p NfProbeResult) bool { return !p.Reachable }),
+		nf.Profile != nil && nf.Profile.NfStatus == models.NFSTATUS_SUSPENDED:
+		// the NRF suspends the nfs missing their heartbeats
+		return NfHealthUnreachable
+	case nf.NfStatus == metricinfo.NfStatusConnected || len(nf.Probes) > 0,
+		nf.Profile != nil && nf.Profile.NfStatus == models.NFSTATUS_REGISTERED:
+		return NfHealthUp
+	}
+	return NfHealthUnknown
+}
+
+// export sets the metrics of the nf
+func (nf *NfStatus) export(now time.Time) {
+	for _, probe := range nf.Probes {
+		promclient.SetNfProbe(nf.NfName, string(nf.NfType), probe.Type, probe.Reachable,
+			time.Duration(probe.DurationSeconds*float64(time.Second)))
+	}
+	if nf.Since.IsZero() {
+		// only probed
+		return
+	}
+	var connected uint64
+	if nf.NfStatus == metricinfo.NfStatusConnected {
+		connected = 1
+	}
+	promclient.SetNfStatus(nf.NfName, string(nf.NfType), string(nf.NfStatus), connected)
+	uptime, downtime := nf.durations(now)
+	promclient.SetNfStatusDetails(nf.NfName, string(nf.NfType), nf.NfStatus == NfStatusUnknown,
+		nf.LastSeen, uptime, downtime, nf.Flaps)
 }
 
-func GetNfStatusAll() []metricinfo.CNfStatus {
-	var nfs []metricinfo.CNfStatus
+func GetNfStatusbyNfType(nfType string) []NfStatus {
 	metricData.NfStatusLock.RLock()
 	defer metricData.NfStatusLock.RUnlock()
 
-	for _, nfStatus := range metricData.NfStatus {
-		nfs = append(nfs, *nfStatus)
-	}
-	return nfs
+	return slices.DeleteFunc(nfInventory(time.Now()), func(nf NfStatus) bool {
+		return nf.NfType != metricinfo.NfType(nfType)
+	})
+}
+
+func sortNfs(nfs []NfStatus) {
+	slices.SortFunc(nfs, func(a, b NfStatus) int { return strings.Compare(a.NfName, b.NfName) })
+}
+
+// GetNfStatusAll returns the inventory of the nfs, those which reported a
+// status, were probed or are registered in the NRF
+func GetNfStatusAll() []NfStatus {
+	metricData.NfStatusLock.RLock()
+	defer metricData.NfStatusLock.RUnlock()
+
+	return nfInventory(time.Now())
 }
 
-func HandleNfStatusEvent(nfStatus *metricinfo.CNfStatus) {
+func HandleNfStatusEvent(ctx context.Context, nfStatus *metricinfo.CNfStatus) {
+	_, span := tracing.Tracer().Start(ctx, "metricdata nf status event",
+		trace.WithAttributes(attribute.String("metricfunc.nf.type", string(nfStatus.NfType))))
+	defer span.End()
+	handleNfStatus(nfStatus, time.Now())
+}
+
+func handleNfStatus(nfStatus *metricinfo.CNfStatus, now time.Time) {
 	metricData.NfStatusLock.Lock()
 	defer metricData.NfStatusLock.Unlock()
 
-	metricData.NfStatus[nfStatus.NfName] = nfStatus
+	nf, ok := metricData.NfStatus[nfStatus.NfName]
+	if !ok {
+		nf = &NfStatus{NfName: nfStatus.NfName, FirstSeen: now}
+		metricData.NfStatus[nfStatus.NfName] = nf
+	}
+	if nf.NfStatus == NfStatusUnknown {
+		logger.CacheLog.Infof("nf [%s] reporting again after %v", nf.NfName, now.Sub(nf.LastSeen))
+	}
+	nf.NfType = nfStatus.NfType
+	nf.LastSeen = now
+	nf.setStatus(nfStatus.NfStatus, now)
+	nf.export(now)
+}
+
+// HandleNfProbe merges the result of a probe into the status of the nf,
+// adding the nf if it never reported a status
+func HandleNfProbe(nfName string, nfType metricinfo.NfType, result NfProbeResult) {
+	metricData.NfStatusLock.Lock()
+	defer metricData.NfStatusLock.Unlock()
 
-	if nfStatus.NfStatus == metricinfo.NfStatusConnected {
-		promclient.SetNfStatus(nfStatus.NfName, string(nfStatus.NfType), string(nfStatus.NfStatus), 1)
+	nf, ok := metricData.NfStatus[nfName]
+	if !ok {
+		nf = &NfStatus{NfName: nfName, NfType: nfType, FirstSeen: result.Time}
+		metricData.NfStatus[nfName] = nf
+	}
+	if nf.NfType == "" {
+		nf.NfType = nfType
+	}
+	// a first probe counts as following a successful one
+	last := NfProbeResult{Reachable: true}
+	i := slices.IndexFunc(nf.Probes, func(p NfProbeResult) bool { return p.Type == result.Type })
+	if i >= 0 {
+		last = nf.Probes[i]
+	}
+	if !result.Reachable {
+		result.Failures = last.Failures + 1
+	}
+	if last.Reachable != result.Reachable {
+		logger.CacheLog.Infof("nf [%s] %s probe reachable [%v] %s", nfName, result.Type, result.Reachable,
+			result.Error)
+	}
+	if i >= 0 {
+		nf.Probes[i] = result
 	} else {
-		promclient.SetNfStatus(nfStatus.NfName, string(nfStatus.NfType), string(nfStatus.NfStatus), 0)
+		nf.Probes = append(nf.Probes, result)
+	}
+	nf.export(result.Time)
+}
+
+// checkNfStatus marks the nfs silent for longer than the timeout as
+// unknown and refreshes the metrics of all nfs
+func checkNfStatus(now time.Time) {
+	timeout := time.Duration(nfStatusTimeout.Load())
+	metricData.NfStatusLock.Lock()
+	defer metricData.NfStatusLock.Unlock()
+
+	for _, nf := range metricData.NfStatus {
+		if timeout > 0 && !nf.LastSeen.IsZero() && nf.NfStatus != NfStatusUnknown && now.Sub(nf.LastSeen) > timeout {
+			logger.CacheLog.Warnf("nf [%s] of type [%s] silent since %v, status [%s] now unknown",
+				nf.NfName, nf.NfType, nf.LastSeen.Format(time.RFC3339), nf.NfStatus)
+			// unknown from the moment the nf went stale
+			nf.setStatus(NfStatusUnknown, nf.LastSeen.Add(timeout))
+		}
+		nf.export(now)
+	}
+}
+
+// RunNfStatusCheck looks for silent nfs and refreshes the nf metrics until
+// ctx is cancelled
+func RunNfStatusCheck(ctx context.Context) error {
+	ticker := time.NewTicker(nfStatusCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			checkNfStatus(now)
+		}
 	}
 }
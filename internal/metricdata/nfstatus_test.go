@@ -0,0 +1,143 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metricdata
+
+import (
+	"testing"
+	"time"
+
+	"github.com/omec-project/util/metricinfo"
+)
+
+func resetNfStatus(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		metricData.NfStatusLock.Lock()
+		defer metricData.NfStatusLock.Unlock()
+		metricData.NfStatus = make(map[string]*NfStatus)
+		metricData.NfProfiles = make(map[string]*NfProfile)
+		SetNfStatusTimeout(0)
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func nfEvent(name string, status metricinfo.NfStatusType) *metricinfo.CNfStatus {
+	return &metricinfo.CNfStatus{NfName: name, NfType: metricinfo.NfTypeGnb, NfStatus: status}
+}
+
+func TestNfStatusDurations(t *testing.T) {
+	resetNfStatus(t)
+	start := time.Now()
+	handleNfStatus(nfEvent("gnb1", metricinfo.NfStatusConnected), start)
+	handleNfStatus(nfEvent("gnb1", metricinfo.NfStatusConnected), start.Add(time.Minute))
+	handleNfStatus(nfEvent("gnb1", metricinfo.NfStatusDisconnected), start.Add(10*time.Minute))
+	handleNfStatus(nfEvent("gnb1", metricinfo.NfStatusConnected), start.Add(12*time.Minute))
+
+	metricData.NfStatusLock.RLock()
+	nf := metricData.NfStatus["gnb1"].snapshot(start.Add(15 * time.Minute))
+	metricData.NfStatusLock.RUnlock()
+
+	if nf.UptimeSeconds != 13*60 || nf.DowntimeSeconds != 2*60 {
+		t.Errorf("uptime %vs downtime %vs, want 780s and 120s", nf.UptimeSeconds, nf.DowntimeSeconds)
+	}
+	if nf.Flaps != 1 {
+		t.Errorf("flaps = %d, want 1", nf.Flaps)
+	}
+	if len(nf.History) != 3 {
+		t.Errorf("history %+v, want 3 changes", nf.History)
+	}
+	if !nf.FirstSeen.Equal(start) || !nf.LastSeen.Equal(start.Add(12*time.Minute)) ||
+		!nf.Since.Equal(start.Add(12*time.Minute)) {
+		t.Errorf("unexpected times %+v", nf)
+	}
+}
+
+func TestNfStatusStaleness(t *testing.T) {
+	resetNfStatus(t)
+	start := time.Now()
+	handleNfStatus(nfEvent("gnb1", metricinfo.NfStatusConnected), start)
+	handleNfStatus(nfEvent("gnb2", metricinfo.NfStatusConnected), start.Add(time.Minute))
+
+	// no timeout, the last status is trusted
+	checkNfStatus(start.Add(time.Hour))
+	if nfs := GetNfStatusAll(); nfs[0].NfStatus != metricinfo.NfStatusConnected {
+		t.Fatalf("status %s without timeout, want connected", nfs[0].NfStatus)
+	}
+
+	SetNfStatusTimeout(90 * time.Second)
+	checkNfStatus(start.Add(2 * time.Minute))
+	nfs := GetNfStatusAll()
+	if nfs[0].NfName != "gnb1" || nfs[0].NfStatus != NfStatusUnknown || nfs[0].Flaps != 1 {
+		t.Errorf("gnb1 %+v, want unknown after one flap", nfs[0])
+	}
+	if !nfs[0].Since.Equal(start.Add(90 * time.Second)) {
+		t.Errorf("gnb1 unknown since %v, want when it went stale", nfs[0].Since)
+	}
+	if nfs[1].NfStatus != metricinfo.NfStatusConnected {
+		t.Errorf("gnb2 %s, want connected", nfs[1].NfStatus)
+	}
+
+	// reporting again ends the unknown status
+	handleNfStatus(nfEvent("gnb1", metricinfo.NfStatusConnected), start.Add(3*time.Minute))
+	if nf := GetNfStatusbyNfType(string(metricinfo.NfTypeGnb))[0]; nf.NfStatus != metricinfo.NfStatusConnected {
+		t.Errorf("gnb1 %s after reporting again, want connected", nf.NfStatus)
+	}
+}
+
+func TestNfStatusHistoryBounded(t *testing.T) {
+	resetNfStatus(t)
+	start := time.Now()
+	for i := range 2 * nfHistorySize {
+		status := metricinfo.NfStatusConnected
+		if i%2 == 1 {
+			status = metricinfo.NfStatusDisconnected
+		}
+		handleNfStatus(nfEvent("gnb1", status), start.Add(time.Duration(i)*time.Second))
+	}
+	nf := GetNfStatusAll()[0]
+	if len(nf.History) != nfHistorySize {
+		t.Fatalf("history of %d changes, want %d", len(nf.History), nfHistorySize)
+	}
+	if last := nf.History[nfHistorySize-1]; !last.Time.Equal(start.Add(time.Duration(2*nfHistorySize-1) * time.Second)) {
+		t.Errorf("last change at %v, want the latest", last.Time)
+	}
+}
+
+func TestNfHealth(t *testing.T) {
+	resetNfStatus(t)
+	now := time.Now()
+	probe := func(name string, reachable bool) {
+		HandleNfProbe(name, metricinfo.NfTypeGnb, NfProbeResult{Type: "sctp", Reachable: reachable, Time: now})
+	}
+	handleNfStatus(nfEvent("up", metricinfo.NfStatusConnected), now)
+	probe("up", true)
+	handleNfStatus(nfEvent("down", metricinfo.NfStatusDisconnected), now)
+	probe("down", false)
+	handleNfStatus(nfEvent("unreachable", metricinfo.NfStatusConnected), now)
+	probe("unreachable", false)
+	probe("probed", true)
+	handleNfStatus(nfEvent("silent", metricinfo.NfStatusConnected), now.Add(-time.Hour))
+	SetNfStatusTimeout(time.Minute)
+	checkNfStatus(now)
+
+	want := map[string]string{
+		"down":        NfHealthReportedDown,
+		"probed":      NfHealthUp,
+		"silent":      NfHealthUnknown,
+		"unreachable": NfHealthUnreachable,
+		"up":          NfHealthUp,
+	}
+	for _, nf := range GetNfStatusAll() {
+		if nf.Health != want[nf.NfName] {
+			t.Errorf("nf %s health %s, want %s", nf.NfName, nf.Health, want[nf.NfName])
+		}
+	}
+	// only probed, no status nor durations
+	probed := GetNfStatusAll()[1]
+	if probed.NfStatus != "" || probed.UptimeSeconds != 0 || probed.DowntimeSeconds != 0 {
+		t.Errorf("probed nf %+v, want no status", probed)
+	}
+}
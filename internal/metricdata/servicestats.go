@@ -5,12 +5,16 @@
 package metricdata
 
 import (
+	"context"
 	"fmt"
 	"sync"
 
 	"github.com/omec-project/metricfunc/internal/promclient"
+	"github.com/omec-project/metricfunc/internal/tracing"
 	"github.com/omec-project/metricfunc/logger"
 	"github.com/omec-project/util/metricinfo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type nfServiceStats struct {
@@ -18,7 +22,22 @@ type nfServiceStats struct {
 	svcStats    map[string]map[string]uint64 // Nf IP is key
 }
 
-func HandleServiceEvent(msgType *metricinfo.CoreMsgType, sourceNf metricinfo.NfType) {
+// buckets returns the number of message type counters of all nfs
+func (s *nfServiceStats) buckets() int {
+	s.svcStatLock.RLock()
+	defer s.svcStatLock.RUnlock()
+	n := 0
+	for _, msgTypes := range s.svcStats {
+		n += len(msgTypes)
+	}
+	return n
+}
+
+func HandleServiceEvent(ctx context.Context, msgType *metricinfo.CoreMsgType, sourceNf metricinfo.NfType) {
+	_, span := tracing.Tracer().Start(ctx, "metricdata service event",
+		trace.WithAttributes(attribute.String("metricfunc.nf.type", string(sourceNf))))
+	defer span.End()
+
 	switch sourceNf {
 	case metricinfo.NfTypeSmf:
 		handleSmfServiceEvent(msgType)
@@ -5,12 +5,19 @@
 package metricdata
 
 import (
+	"context"
 	"fmt"
 	"sync/atomic"
+	"time"
 
+	"github.com/omec-project/metricfunc/internal/privacy"
 	"github.com/omec-project/metricfunc/internal/promclient"
+	"github.com/omec-project/metricfunc/internal/subtrace"
+	"github.com/omec-project/metricfunc/internal/tracing"
 	"github.com/omec-project/metricfunc/logger"
 	"github.com/omec-project/util/metricinfo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var smContextActive uint64
@@ -25,68 +32,112 @@ func decSMContextActive() uint64 {
 	return smContextActive
 }
 
-func HandleSubscriberEvent(subsData *metricinfo.CoreSubscriberData, sourceNf metricinfo.NfType) {
+var subscriberOps = map[metricinfo.SubscriberOp]string{
+	metricinfo.SubsOpAdd: "add",
+	metricinfo.SubsOpMod: "modify",
+	metricinfo.SubsOpDel: "delete",
+}
+
+// HandleSubscriberEvent applies a subscriber event which happened at the given
+// time, the current time when unknown. ip leases are stamped with it so that
+// lag or a replay of the stream does not shift them
+func HandleSubscriberEvent(ctx context.Context, subsData *metricinfo.CoreSubscriberData, sourceNf metricinfo.NfType,
+	at time.Time,
+) {
+	if at.IsZero() {
+		at = time.Now()
+	}
+	_, span := tracing.Tracer().Start(ctx, "metricdata subscriber event", trace.WithAttributes(
+		attribute.String("metricfunc.nf.type", string(sourceNf)),
+		attribute.String("metricfunc.subscriber.operation", subscriberOps[subsData.Operation])))
+	var err error
+	defer func() { tracing.End(span, err) }()
+
 	switch subsData.Operation {
 	case metricinfo.SubsOpAdd:
-		err := storeSubscriber(&subsData.Subscriber, sourceNf)
+		err = storeSubscriber(&subsData.Subscriber, sourceNf, at)
 		if err != nil {
-			logger.CacheLog.Infof("store subscriber %v failed for sourceNF [%v]", subsData.Subscriber.Imsi, sourceNf)
+			logger.CacheLog.Infof("store subscriber %v failed for sourceNF [%v]",
+				privacy.Imsi(privacy.Logs, subsData.Subscriber.Imsi), sourceNf)
 		}
 	case metricinfo.SubsOpMod:
-		updateSubscriber(&subsData.Subscriber, sourceNf)
+		updateSubscriber(&subsData.Subscriber, sourceNf, at)
 	case metricinfo.SubsOpDel:
-		err := deleteSubscriber(&subsData.Subscriber, sourceNf)
+		err = deleteSubscriber(&subsData.Subscriber, sourceNf, at)
 		if err != nil {
-			logger.CacheLog.Infof("delete subscriber %v failed for sourceNF [%v]", subsData.Subscriber.Imsi, sourceNf)
+			logger.CacheLog.Infof("delete subscriber %v failed for sourceNF [%v]",
+				privacy.Imsi(privacy.Logs, subsData.Subscriber.Imsi), sourceNf)
 		}
 	default:
+		err = fmt.Errorf("unknown subscriber operation [%v]", subsData.Operation)
 		logger.CacheLog.Errorf("unknown smf subscriber operation [%v]", subsData.Operation)
 	}
 }
 
-func storeSubscriber(sub *metricinfo.CoreSubscriber, sourceNf metricinfo.NfType) error {
+func storeSubscriber(sub *metricinfo.CoreSubscriber, sourceNf metricinfo.NfType, at time.Time) error {
 	metricData.SubLock.Lock()
 
 	if _, ok := metricData.Subscribers[sub.Imsi]; !ok {
 		metricData.Subscribers[sub.Imsi] = sub
 
 		promclient.SetSmfSessStats(sub.SmfIp, sub.Slice, sub.Dnn, sub.UpfName, incSMContextActive())
-		logger.CacheLog.Debugf("storing subscriber with imsi [%s]", sub.Imsi)
+		logger.CacheLog.Debugf("storing subscriber with imsi [%s]", privacy.Imsi(privacy.Logs, sub.Imsi))
 		pushPrometheusCoreSubData(sub)
+		traceSubscriber("subscriber stored", sub, "")
 		metricData.SubLock.Unlock()
+		startIpLease(sub.IPAddress, sub.Imsi, at)
 	} else {
 		metricData.SubLock.Unlock()
-		updateSubscriber(sub, sourceNf)
+		updateSubscriber(sub, sourceNf, at)
 	}
 
 	return nil
 }
 
-func updateSubscriber(sub *metricinfo.CoreSubscriber, sourceNf metricinfo.NfType) {
+func updateSubscriber(sub *metricinfo.CoreSubscriber, sourceNf metricinfo.NfType, at time.Time) {
+	oldIp, newIp, ok := updateSubscriberData(sub, sourceNf)
+	if ok && oldIp != newIp {
+		endIpLease(oldIp, sub.Imsi, at)
+		startIpLease(newIp, sub.Imsi, at)
+	}
+}
+
+// updateSubscriberData merges the event into the cached subscriber and
+// returns its ip address before and after the update
+func updateSubscriberData(sub *metricinfo.CoreSubscriber, sourceNf metricinfo.NfType) (string, string, bool) {
 	metricData.SubLock.Lock()
 	defer metricData.SubLock.Unlock()
-	if s, ok := metricData.Subscribers[sub.Imsi]; ok {
-		deletePrometheusCoreSubData(s)
-
-		switch sourceNf {
-		case metricinfo.NfTypeSmf:
-			// SMF specific fields
-			fillSmfSubsriberData(sub, s)
-		case metricinfo.NfTypeAmf:
-			// AMF specific fields
-			fillAmfSubsriberData(sub, s)
-		}
-		pushPrometheusCoreSubData(s)
+	s, ok := metricData.Subscribers[sub.Imsi]
+	if !ok {
+		return "", "", false
 	}
+	oldIp := s.IPAddress
+	deletePrometheusCoreSubData(s)
+
+	switch sourceNf {
+	case metricinfo.NfTypeSmf:
+		// SMF specific fields
+		fillSmfSubsriberData(sub, s)
+	case metricinfo.NfTypeAmf:
+		// AMF specific fields
+		fillAmfSubsriberData(sub, s)
+	}
+	pushPrometheusCoreSubData(s)
+	if oldIp != s.IPAddress {
+		traceSubscriber("subscriber updated, ip address changed", s, oldIp)
+	} else {
+		traceSubscriber("subscriber updated", s, "")
+	}
+	return oldIp, s.IPAddress, true
 }
 
-func deleteSubscriber(sub *metricinfo.CoreSubscriber, sourceNf metricinfo.NfType) error {
+func deleteSubscriber(sub *metricinfo.CoreSubscriber, sourceNf metricinfo.NfType, at time.Time) error {
 	metricData.SubLock.Lock()
 	defer metricData.SubLock.Unlock()
 	imsi := sub.Imsi
 	s, ok := metricData.Subscribers[imsi]
 	if !ok {
-		return fmt.Errorf("subscriber with imsi [%s] already deleted", imsi)
+		return fmt.Errorf("subscriber with imsi [%s] already deleted", privacy.Imsi(privacy.Logs, imsi))
 	}
 
 	promclient.SetSmfSessStats(s.SmfIp, s.Slice, s.Dnn, s.UpfName, decSMContextActive())
@@ -101,7 +152,9 @@ func deleteSubscriber(sub *metricinfo.CoreSubscriber, sourceNf metricinfo.NfType
 	// register subscriber delete
 	deletePrometheusCoreSubData(s)
 
-	logger.CacheLog.Debugf("deleting subscriber with imsi [%s]", imsi)
+	logger.CacheLog.Debugf("deleting subscriber with imsi [%s]", privacy.Imsi(privacy.Logs, imsi))
+	traceSubscriber("subscriber deleted", s, "")
+	endIpLease(s.IPAddress, imsi, at)
 
 	return nil
 }
@@ -120,11 +173,12 @@ func GetSubscriberImsiFromIpAddr(ipaddr string) (*metricinfo.CoreSubscriber, err
 	defer metricData.SubLock.RUnlock()
 	for imsi, sub := range metricData.Subscribers {
 		if sub.IPAddress == ipaddr {
-			logger.CacheLog.Infof("found subscriber with ip-addr [%s], imsi [%s]", ipaddr, imsi)
+			logger.CacheLog.Infof("found subscriber with ip-addr [%s], imsi [%s]",
+				privacy.IpAddr(privacy.Logs, ipaddr), privacy.Imsi(privacy.Logs, imsi))
 			return sub, nil
 		}
 	}
-	return nil, fmt.Errorf("subscriber with ip-addr [%v] not found", ipaddr)
+	return nil, fmt.Errorf("subscriber with ip-addr [%v] not found", privacy.IpAddr(privacy.Logs, ipaddr))
 }
 
 func GetSubscriberAll() []string {
@@ -139,6 +193,16 @@ func GetSubscriberAll() []string {
 	return imsis
 }
 
+// traceSubscriber records the cached state of a traced subscriber and the
+// ip address it held before, if it changed. Called with the subscriber lock
+// held.
+func traceSubscriber(message string, s *metricinfo.CoreSubscriber, prevIp string) {
+	ids := subtrace.Ids{Imsi: s.Imsi, IpAddr: s.IPAddress, Guti: s.Guti, PrevIpAddr: prevIp}
+	if subtrace.Traced(ids) {
+		subtrace.Record("metricdata", ids, message, *s)
+	}
+}
+
 // Pushing to prometheus client module
 func pushPrometheusCoreSubData(sub *metricinfo.CoreSubscriber) {
 	promclient.PushCoreSubData(sub.Imsi, sub.IPAddress, sub.SmfSubState, sub.SmfIp, sub.Dnn, sub.Slice, sub.UpfName)
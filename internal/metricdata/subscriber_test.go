@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metricdata
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/omec-project/metricfunc/internal/subtrace"
+	"github.com/omec-project/util/metricinfo"
+)
+
+func TestTracedSubscriberEvents(t *testing.T) {
+	const imsi = "imsi-208930000000042"
+	if _, err := subtrace.Add(subtrace.Target{Kind: subtrace.KindImsi, Value: imsi}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = subtrace.Remove(subtrace.KindImsi, imsi)
+		_ = subtrace.DeleteBundle(imsi)
+	})
+
+	for _, data := range []metricinfo.CoreSubscriberData{
+		{Operation: metricinfo.SubsOpAdd, Subscriber: metricinfo.CoreSubscriber{Imsi: imsi, IPAddress: "10.250.0.42"}},
+		{Operation: metricinfo.SubsOpMod, Subscriber: metricinfo.CoreSubscriber{Imsi: imsi, IPAddress: "10.250.0.43"}},
+		{Operation: metricinfo.SubsOpDel, Subscriber: metricinfo.CoreSubscriber{Imsi: imsi}},
+	} {
+		HandleSubscriberEvent(context.Background(), &data, metricinfo.NfTypeSmf, time.Time{})
+	}
+
+	bundle, err := subtrace.GetBundle(imsi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"subscriber stored", "subscriber updated, ip address changed", "subscriber deleted"}
+	if len(bundle.Events) != len(want) {
+		t.Fatalf("unexpected events %+v", bundle.Events)
+	}
+	for i, e := range bundle.Events {
+		if e.Message != want[i] {
+			t.Errorf("event %d: got %q want %q", i, e.Message, want[i])
+		}
+	}
+	// the previous ip address is a field of its own, masked with the others
+	if prev := bundle.Events[1].PrevIpAddr; prev != "10.250.0.42" {
+		t.Errorf("previous ip address %q, want 10.250.0.42", prev)
+	}
+}
+
+func TestSubscriberLeaseEventTime(t *testing.T) {
+	const imsi, ipAddr = "imsi-208930000000043", "10.250.0.44"
+	added := time.Now().Add(-time.Hour).Truncate(time.Second)
+	deleted := added.Add(time.Minute)
+
+	// events handled late still stamp the lease with the time they happened
+	HandleSubscriberEvent(context.Background(), &metricinfo.CoreSubscriberData{
+		Operation:  metricinfo.SubsOpAdd,
+		Subscriber: metricinfo.CoreSubscriber{Imsi: imsi, IPAddress: ipAddr},
+	}, metricinfo.NfTypeSmf, added)
+	HandleSubscriberEvent(context.Background(), &metricinfo.CoreSubscriberData{
+		Operation:  metricinfo.SubsOpDel,
+		Subscriber: metricinfo.CoreSubscriber{Imsi: imsi},
+	}, metricinfo.NfTypeSmf, deleted)
+
+	history := GetIpLeaseHistory(ipAddr)
+	if len(history) != 1 || !history[0].Start.Equal(added) || !history[0].End.Equal(deleted) {
+		t.Fatalf("lease history %+v, want a lease from %v to %v", history, added, deleted)
+	}
+}
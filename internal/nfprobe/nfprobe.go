@@ -0,0 +1,192 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package nfprobe checks the reachability of the nfs configured on an
+// interval, merging the results into their status
+package nfprobe
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/omec-project/metricfunc/config"
+	"github.com/omec-project/metricfunc/internal/metricdata"
+	"github.com/omec-project/metricfunc/internal/nrf"
+	"github.com/omec-project/metricfunc/internal/sbiclient"
+	"github.com/omec-project/metricfunc/logger"
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/util/metricinfo"
+)
+
+const (
+	defaultProbeInterval = 30 * time.Second
+	defaultProbeTimeout  = 5 * time.Second
+)
+
+// target is a probe of an nf, probe failing when the nf is unreachable
+type target struct {
+	nfName string
+	nfType metricinfo.NfType
+	kind   string
+	probe  func(ctx context.Context) error
+}
+
+// Prober probes the nfs and merges the results into the nf status
+type Prober struct {
+	interval time.Duration
+	timeout  time.Duration
+	targets  []target
+}
+
+// NewProber returns a prober of the targets configured
+func NewProber(cfg *config.NfProbes) (*Prober, error) {
+	p := &Prober{interval: defaultProbeInterval, timeout: defaultProbeTimeout}
+	if cfg.Interval > 0 {
+		p.interval = time.Duration(cfg.Interval) * time.Second
+	}
+	if cfg.Timeout > 0 {
+		p.timeout = time.Duration(cfg.Timeout) * time.Second
+	}
+	for _, probe := range cfg.Targets {
+		t, err := newTarget(probe, p.timeout)
+		if err != nil {
+			return nil, fmt.Errorf("%s probe of nf %s: %w", probe.Type, probe.NfName, err)
+		}
+		p.targets = append(p.targets, t)
+	}
+	return p, nil
+}
+
+func newTarget(probe config.NfProbe, timeout time.Duration) (target, error) {
+	t := target{nfName: probe.NfName, nfType: metricinfo.NfType(probe.NfType), kind: probe.Type}
+	address := net.JoinHostPort(probe.EndPoint.Addr, strconv.Itoa(probe.EndPoint.Port))
+	switch probe.Type {
+	case "http":
+		client, err := sbiclient.New(&probe.EndPoint, timeout)
+		if err != nil {
+			return t, err
+		}
+		url := sbiclient.BaseUrl(&probe.EndPoint) + cmp.Or(probe.EndPoint.Path, "/")
+		t.probe = func(ctx context.Context) error { return probeHttp(ctx, client, url) }
+	case "tcp":
+		t.probe = func(ctx context.Context) error { return probeTcp(ctx, address) }
+	case "sctp":
+		t.probe = func(ctx context.Context) error { return probeSctp(ctx, address) }
+	case "nrf":
+		nfType, err := models.NewNFTypeFromValue(probe.NfType)
+		if err != nil {
+			return t, err
+		}
+		client, err := nrf.NewClient(&probe.EndPoint, timeout)
+		if err != nil {
+			return t, err
+		}
+		t.probe = func(ctx context.Context) error { return probeNrf(ctx, client, *nfType, probe.NfInstanceId) }
+	default:
+		return t, fmt.Errorf("unknown probe type [%s]", probe.Type)
+	}
+	return t, nil
+}
+
+// Run probes the nfs every interval until ctx is cancelled
+func (p *Prober) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		p.probe(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// probe probes all nfs at once
+func (p *Prober) probe(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, t := range p.targets {
+		wg.Go(func() { p.probeTarget(ctx, t) })
+	}
+	wg.Wait()
+}
+
+func (p *Prober) probeTarget(ctx context.Context, t target) {
+	probeCtx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	start := time.Now()
+	err := t.probe(probeCtx)
+	if ctx.Err() != nil {
+		// shutting down, the nf is not to blame
+		return
+	}
+	result := metricdata.NfProbeResult{
+		Type:            t.kind,
+		Reachable:       err == nil,
+		Time:            start,
+		DurationSeconds: time.Since(start).Seconds(),
+	}
+	if err != nil {
+		result.Error = err.Error()
+		logger.AppLog.Debugf("%s probe of nf [%s] failed: %v", t.kind, t.nfName, err)
+	}
+	metricdata.HandleNfProbe(t.nfName, t.nfType, result)
+}
+
+// probeHttp reaches the SBI of the nf, any answer but a server error will
+// do as the probe is not authorised for the services of the nf
+func probeHttp(ctx context.Context, client *http.Client, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
+
+func probeTcp(ctx context.Context, address string) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// probeNrf looks for a registered instance of the nf type in the NRF, the
+// instance given if set
+func probeNrf(ctx context.Context, client *nrf.Client, nfType models.NFType, nfInstanceId string) error {
+	profiles, err := client.Discover(ctx, nfType)
+	if err != nil {
+		return err
+	}
+	registered := slices.ContainsFunc(profiles, func(profile models.NFProfileDiscovery) bool {
+		return profile.NfStatus == models.NFSTATUS_REGISTERED &&
+			(nfInstanceId == "" || profile.NfInstanceId == nfInstanceId)
+	})
+	switch {
+	case registered:
+		return nil
+	case nfInstanceId != "":
+		return fmt.Errorf("instance %s not registered in the nrf", nfInstanceId)
+	}
+	return fmt.Errorf("no %s registered in the nrf", nfType)
+}
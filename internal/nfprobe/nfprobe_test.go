@@ -0,0 +1,163 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package nfprobe
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/omec-project/metricfunc/config"
+	"github.com/omec-project/metricfunc/internal/metricdata"
+	"github.com/omec-project/openapi/v2/models"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// endPoint returns the endpoint of the listener
+func endPoint(t *testing.T, addr net.Addr) config.ServerAddr {
+	t.Helper()
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := strconv.Atoi(port)
+	return config.ServerAddr{Addr: host, Port: p}
+}
+
+// closedEndPoint returns an endpoint nothing listens on
+func closedEndPoint(t *testing.T) config.ServerAddr {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := endPoint(t, listener.Addr())
+	listener.Close()
+	return e
+}
+
+// probeResult probes the nf once and returns the result merged into its
+// status
+func probeResult(t *testing.T, probe config.NfProbe) metricdata.NfProbeResult {
+	t.Helper()
+	prober, err := NewProber(&config.NfProbes{Targets: []config.NfProbe{probe}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prober.probe(context.Background())
+	for _, nf := range metricdata.GetNfStatusAll() {
+		if nf.NfName != probe.NfName {
+			continue
+		}
+		for _, result := range nf.Probes {
+			if result.Type == probe.Type {
+				return result
+			}
+		}
+	}
+	t.Fatalf("no %s probe result of %s", probe.Type, probe.NfName)
+	return metricdata.NfProbeResult{}
+}
+
+func TestProbeHttp(t *testing.T) {
+	status := http.StatusNotFound
+	server := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.ProtoMajor != 2 || req.URL.Path != "/namf-comm/v1" {
+			t.Errorf("unexpected request %s %s", req.Proto, req.URL.Path)
+		}
+		w.WriteHeader(status)
+	}), &http2.Server{}))
+	defer server.Close()
+
+	probe := config.NfProbe{NfName: "amf-http", NfType: "AMF", Type: "http", EndPoint: endPoint(t, server.Listener.Addr())}
+	probe.EndPoint.Path = "/namf-comm/v1"
+	// any answer but a server error is reachable
+	if result := probeResult(t, probe); !result.Reachable {
+		t.Errorf("probe %+v, want reachable", result)
+	}
+	status = http.StatusServiceUnavailable
+	if result := probeResult(t, probe); result.Reachable || result.Failures != 1 {
+		t.Errorf("probe %+v, want unreachable once", result)
+	}
+}
+
+func TestProbeTcp(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	probe := config.NfProbe{NfName: "upf-tcp", NfType: "UPF", Type: "tcp", EndPoint: endPoint(t, listener.Addr())}
+	if result := probeResult(t, probe); !result.Reachable {
+		t.Errorf("probe %+v, want reachable", result)
+	}
+	probe.EndPoint = closedEndPoint(t)
+	for range 2 {
+		probeResult(t, probe)
+	}
+	if result := probeResult(t, probe); result.Reachable || result.Failures != 3 || result.Error == "" {
+		t.Errorf("probe %+v, want unreachable three times in a row", result)
+	}
+}
+
+func TestProbeSctpUnreachable(t *testing.T) {
+	// refused, or sctp not supported by the kernel
+	probe := config.NfProbe{NfName: "amf-sctp", NfType: "AMF", Type: "sctp", EndPoint: closedEndPoint(t)}
+	if result := probeResult(t, probe); result.Reachable {
+		t.Errorf("probe %+v, want unreachable", result)
+	}
+}
+
+func TestProbeNrf(t *testing.T) {
+	server := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		if req.URL.Path != "/nnrf-disc/v1/nf-instances" || query.Get("requester-nf-type") == "" {
+			t.Errorf("unexpected request %s", req.URL)
+		}
+		result := models.SearchResult{NfInstances: []models.NFProfileDiscovery{}}
+		if query.Get("target-nf-type") == "SMF" {
+			result.NfInstances = append(result.NfInstances,
+				models.NFProfileDiscovery{NfInstanceId: "smf-1", NfType: models.NFTYPE_SMF, NfStatus: models.NFSTATUS_REGISTERED},
+				models.NFProfileDiscovery{NfInstanceId: "smf-2", NfType: models.NFTYPE_SMF, NfStatus: models.NFSTATUS_SUSPENDED})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(result)
+	}), &http2.Server{}))
+	defer server.Close()
+
+	nrfEndPoint := endPoint(t, server.Listener.Addr())
+	for _, tc := range []struct {
+		nfType, nfInstanceId string
+		reachable            bool
+	}{
+		{"SMF", "", true},
+		{"SMF", "smf-1", true},
+		{"SMF", "smf-2", false},
+		{"AMF", "", false},
+	} {
+		probe := config.NfProbe{
+			NfName: "nrf-" + tc.nfType + tc.nfInstanceId, NfType: tc.nfType, Type: "nrf",
+			NfInstanceId: tc.nfInstanceId, EndPoint: nrfEndPoint,
+		}
+		if result := probeResult(t, probe); result.Reachable != tc.reachable {
+			t.Errorf("%s %s probe %+v, want reachable %v", tc.nfType, tc.nfInstanceId, result, tc.reachable)
+		}
+	}
+}
+
+func TestNewProberUnknownNfType(t *testing.T) {
+	_, err := NewProber(&config.NfProbes{Targets: []config.NfProbe{
+		{NfName: "x", NfType: "GNB", Type: "nrf", EndPoint: config.ServerAddr{Addr: "nrf", Port: 29510}},
+	}})
+	if err == nil {
+		t.Error("expected the nf type unknown to the NRF to be rejected")
+	}
+}
@@ -0,0 +1,96 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package nfprobe
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// probeSctp sets up an SCTP association with the nf, such as the N2 of an
+// amf, and shuts it down
+func probeSctp(ctx context.Context, address string) error {
+	host, portValue, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portValue)
+	if err != nil {
+		return err
+	}
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+	if len(ips) == 0 {
+		return fmt.Errorf("no address of %s", host)
+	}
+
+	family := syscall.AF_INET6
+	var sa syscall.Sockaddr
+	if ip4 := ips[0].IP.To4(); ip4 != nil {
+		family = syscall.AF_INET
+		sa4 := &syscall.SockaddrInet4{Port: port}
+		copy(sa4.Addr[:], ip4)
+		sa = sa4
+	} else {
+		sa6 := &syscall.SockaddrInet6{Port: port}
+		copy(sa6.Addr[:], ips[0].IP.To16())
+		sa = sa6
+	}
+
+	fd, err := syscall.Socket(family, syscall.SOCK_STREAM|syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC,
+		syscall.IPPROTO_SCTP)
+	if err != nil {
+		return fmt.Errorf("sctp socket: %w", err)
+	}
+	// the file owns the socket from now on, its poller waiting for the
+	// association
+	f := os.NewFile(uintptr(fd), "sctp")
+	defer f.Close()
+	if err := syscall.Connect(fd, sa); err != nil && err != syscall.EINPROGRESS {
+		return fmt.Errorf("sctp connect: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := f.SetWriteDeadline(deadline); err != nil {
+			return err
+		}
+	}
+	rawConn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var connectErr error
+	waited := false
+	err = rawConn.Write(func(fd uintptr) bool {
+		if !waited {
+			// writable once the association is up or failed
+			waited = true
+			return false
+		}
+		soErr, err := syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_ERROR)
+		switch {
+		case err != nil:
+			connectErr = err
+		case soErr != 0:
+			connectErr = syscall.Errno(soErr)
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("sctp connect: %w", err)
+	}
+	if connectErr != nil {
+		return fmt.Errorf("sctp connect: %w", connectErr)
+	}
+	return nil
+}
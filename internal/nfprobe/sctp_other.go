@@ -0,0 +1,16 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !linux
+
+package nfprobe
+
+import (
+	"context"
+	"errors"
+)
+
+func probeSctp(context.Context, string) error {
+	return errors.New("sctp probes are only supported on linux")
+}
@@ -0,0 +1,116 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package nrf
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/omec-project/metricfunc/config"
+	"github.com/omec-project/metricfunc/internal/metricdata"
+	"github.com/omec-project/metricfunc/logger"
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/util/metricinfo"
+)
+
+const (
+	defaultInventoryInterval = 60 * time.Second
+	inventoryTimeout         = 10 * time.Second
+)
+
+// defaultNfTypes are the nfs of the 5G core
+var defaultNfTypes = []models.NFType{
+	models.NFTYPE_AMF, models.NFTYPE_SMF, models.NFTYPE_UPF, models.NFTYPE_AUSF,
+	models.NFTYPE_UDM, models.NFTYPE_UDR, models.NFTYPE_PCF, models.NFTYPE_NSSF,
+}
+
+// Inventory polls the profiles of the nfs registered in the NRF into the
+// nf status
+type Inventory struct {
+	client   *Client
+	interval time.Duration
+	nfTypes  []models.NFType
+}
+
+// NewInventory returns the inventory of the nf types, the 5G core ones if
+// none, registered in the NRF at the endpoint
+func NewInventory(endPoint *config.ServerAddr, nfTypes []string) (*Inventory, error) {
+	client, err := NewClient(endPoint, inventoryTimeout)
+	if err != nil {
+		return nil, err
+	}
+	inv := &Inventory{client: client, interval: defaultInventoryInterval, nfTypes: defaultNfTypes}
+	if endPoint.PollInterval > 0 {
+		inv.interval = time.Duration(endPoint.PollInterval) * time.Second
+	}
+	if len(nfTypes) != 0 {
+		inv.nfTypes = nil
+		for _, value := range nfTypes {
+			nfType, err := models.NewNFTypeFromValue(value)
+			if err != nil {
+				return nil, fmt.Errorf("nrf inventory: %w", err)
+			}
+			inv.nfTypes = append(inv.nfTypes, *nfType)
+		}
+	}
+	return inv, nil
+}
+
+// Run polls the NRF every interval until ctx is cancelled
+func (inv *Inventory) Run(ctx context.Context) error {
+	ticker := time.NewTicker(inv.interval)
+	defer ticker.Stop()
+	for {
+		inv.poll(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll replaces the profiles of each nf type, keeping those of the types
+// the NRF failed to give
+func (inv *Inventory) poll(ctx context.Context) {
+	for _, nfType := range inv.nfTypes {
+		found, err := inv.client.Discover(ctx, nfType)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.AppLog.Warnf("nrf inventory of [%s] kept as fetching failed: %v", nfType, err)
+			}
+			continue
+		}
+		now := time.Now()
+		profiles := make([]metricdata.NfProfile, 0, len(found))
+		for _, p := range found {
+			profiles = append(profiles, nfProfile(&p, now))
+		}
+		metricdata.SetNfProfiles(metricinfo.NfType(nfType), profiles)
+		logger.AppLog.Debugf("nrf inventory of [%s] holds %d instances", nfType, len(profiles))
+	}
+}
+
+func nfProfile(p *models.NFProfileDiscovery, updated time.Time) metricdata.NfProfile {
+	profile := metricdata.NfProfile{
+		NfInstanceId:      p.NfInstanceId,
+		NfType:            metricinfo.NfType(p.NfType),
+		NfStatus:          p.NfStatus,
+		Ipv4Addresses:     p.Ipv4Addresses,
+		Ipv6Addresses:     p.Ipv6Addresses,
+		PlmnList:          p.PlmnList,
+		SNssais:           p.SNssais,
+		PerPlmnSnssaiList: p.PerPlmnSnssaiList,
+		Updated:           updated,
+	}
+	if p.NfInstanceName != nil {
+		profile.NfInstanceName = *p.NfInstanceName
+	}
+	if p.Fqdn != nil {
+		profile.Fqdn = *p.Fqdn
+	}
+	return profile
+}
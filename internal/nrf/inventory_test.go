@@ -0,0 +1,147 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package nrf
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/omec-project/metricfunc/config"
+	"github.com/omec-project/metricfunc/internal/metricdata"
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/util/metricinfo"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// nrfStub answers the discoveries with the instances of the nf type
+type nrfStub struct {
+	lock      sync.Mutex
+	instances map[models.NFType][]models.NFProfileDiscovery
+	down      bool
+}
+
+func (s *nrfStub) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if req.URL.Path != "/nrf/nnrf-disc/v1/nf-instances" {
+		http.NotFound(w, req)
+		return
+	}
+	if s.down {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	instances := s.instances[models.NFType(req.URL.Query().Get("target-nf-type"))]
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(models.SearchResult{NfInstances: append([]models.NFProfileDiscovery{}, instances...)})
+}
+
+func startNrfStub(t *testing.T, stub *nrfStub) *config.ServerAddr {
+	t.Helper()
+	server := httptest.NewServer(h2c.NewHandler(stub, &http2.Server{}))
+	t.Cleanup(server.Close)
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := strconv.Atoi(port)
+	return &config.ServerAddr{Addr: host, Port: p, Path: "/nrf/"}
+}
+
+func findNf(nfs []metricdata.NfStatus, name string) *metricdata.NfStatus {
+	for i := range nfs {
+		if nfs[i].NfName == name {
+			return &nfs[i]
+		}
+	}
+	return nil
+}
+
+func TestInventory(t *testing.T) {
+	amfName := "amf-west"
+	stub := &nrfStub{instances: map[models.NFType][]models.NFProfileDiscovery{
+		models.NFTYPE_AMF: {{
+			NfInstanceId:   "5f4c1a52-0000-4000-8000-000000000001",
+			NfInstanceName: &amfName,
+			NfType:         models.NFTYPE_AMF,
+			NfStatus:       models.NFSTATUS_REGISTERED,
+			Ipv4Addresses:  []string{"10.0.0.1"},
+			PlmnList:       []models.PlmnId{{Mcc: "208", Mnc: "93"}},
+			SNssais:        []models.Snssai{{Sst: 1}},
+		}},
+		models.NFTYPE_SMF: {{
+			NfInstanceId:  "5f4c1a52-0000-4000-8000-000000000002",
+			NfType:        models.NFTYPE_SMF,
+			NfStatus:      models.NFSTATUS_SUSPENDED,
+			Ipv4Addresses: []string{"10.0.0.2"},
+		}},
+	}}
+	inv, err := NewInventory(startNrfStub(t, stub), []string{"AMF", "SMF"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the amf reports its status and messages by its address
+	ctx := context.Background()
+	metricdata.HandleNfStatusEvent(ctx, &metricinfo.CNfStatus{
+		NfName: "10.0.0.1", NfType: metricinfo.NfTypeAmf, NfStatus: metricinfo.NfStatusConnected,
+	})
+	metricdata.HandleServiceEvent(ctx, &metricinfo.CoreMsgType{MsgType: "registration", SourceNfId: "10.0.0.1"},
+		metricinfo.NfTypeAmf)
+	inv.poll(ctx)
+
+	nfs := metricdata.GetNfStatusAll()
+	if len(nfs) != 2 {
+		t.Fatalf("inventory %+v, want the amf and smf", nfs)
+	}
+	amf := findNf(nfs, "10.0.0.1")
+	if amf == nil || amf.Profile == nil || amf.Profile.NfInstanceName != amfName ||
+		amf.NfStatus != metricinfo.NfStatusConnected || amf.Health != metricdata.NfHealthUp {
+		t.Fatalf("amf %+v, want its status joined with its profile", amf)
+	}
+	if len(amf.Profile.PlmnList) != 1 || len(amf.Profile.SNssais) != 1 || amf.ServiceStats["registration"] != 1 {
+		t.Errorf("amf profile %+v and stats %v, want its plmn, slice and messages", amf.Profile, amf.ServiceStats)
+	}
+	// known by the NRF only, suspended for missing its heartbeats
+	smf := findNf(nfs, "5f4c1a52-0000-4000-8000-000000000002")
+	if smf == nil || smf.NfType != metricinfo.NfTypeSmf || smf.Health != metricdata.NfHealthUnreachable {
+		t.Errorf("smf %+v, want an unreachable smf", smf)
+	}
+	if smfs := metricdata.GetNfStatusbyNfType("SMF"); len(smfs) != 1 {
+		t.Errorf("smfs %+v, want one", smfs)
+	}
+
+	// the profiles are kept while the NRF is down
+	stub.lock.Lock()
+	stub.down = true
+	stub.lock.Unlock()
+	inv.poll(ctx)
+	if nfs := metricdata.GetNfStatusAll(); len(nfs) != 2 {
+		t.Errorf("inventory %+v with the NRF down, want it kept", nfs)
+	}
+
+	// deregistered instances leave the inventory
+	stub.lock.Lock()
+	stub.down = false
+	delete(stub.instances, models.NFTYPE_SMF)
+	stub.lock.Unlock()
+	inv.poll(ctx)
+	if nfs := metricdata.GetNfStatusAll(); len(nfs) != 1 || nfs[0].Profile == nil {
+		t.Errorf("inventory %+v, want the amf only", nfs)
+	}
+}
+
+func TestNewInventoryUnknownNfType(t *testing.T) {
+	if _, err := NewInventory(&config.ServerAddr{Addr: "nrf", Port: 29510}, []string{"GNB"}); err == nil {
+		t.Error("expected the nf type unknown to the NRF to be rejected")
+	}
+}
@@ -0,0 +1,79 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package nrf looks the nfs up in the NRF, through its discovery service
+package nrf
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/omec-project/metricfunc/config"
+	"github.com/omec-project/metricfunc/internal/sbiclient"
+	"github.com/omec-project/openapi/v2/models"
+)
+
+const (
+	discoveryPath = "/nnrf-disc/v1/nf-instances"
+	// requesterNfType is required by the discovery, metricfunc takes the
+	// part of an analytics function
+	requesterNfType = models.NFTYPE_NWDAF
+)
+
+// Client discovers the nf instances registered in an NRF
+type Client struct {
+	url        string
+	httpClient *http.Client
+}
+
+// NewClient returns a client of the NRF at the endpoint, its path the
+// prefix of the NRF api if set
+func NewClient(endPoint *config.ServerAddr, timeout time.Duration) (*Client, error) {
+	httpClient, err := sbiclient.New(endPoint, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		url:        sbiclient.BaseUrl(endPoint) + strings.TrimSuffix(endPoint.Path, "/") + discoveryPath,
+		httpClient: httpClient,
+	}, nil
+}
+
+// Discover returns the profiles of the instances of the nf type the NRF
+// knows, whatever their status
+func (c *Client) Discover(ctx context.Context, nfType models.NFType) ([]models.NFProfileDiscovery, error) {
+	query := url.Values{}
+	query.Set("target-nf-type", string(nfType))
+	query.Set("requester-nf-type", string(requesterNfType))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		// no instance of the type
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("nrf discovery of %s: %s", nfType, resp.Status)
+	}
+
+	var result models.SearchResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("nrf discovery of %s: %w", nfType, err)
+	}
+	return result.NfInstances, nil
+}
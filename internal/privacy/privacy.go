@@ -0,0 +1,265 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package privacy pseudonymises subscriber identities before they leave
+// metricfunc through logs, metrics or the api
+package privacy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/omec-project/metricfunc/config"
+	"github.com/omec-project/metricfunc/internal/credentials"
+	"github.com/omec-project/util/metricinfo"
+)
+
+type Mode string
+
+const (
+	// ModeClear passes identities unchanged
+	ModeClear Mode = "clear"
+	// ModeHash replaces identities by a keyed hash, equal identities map to
+	// equal hashes so that they can still be correlated
+	ModeHash Mode = "hash"
+	// ModeTruncate keeps the network part of an identity: the MCC and MNC
+	// of an IMSI, the /24 (IPv4) or /48 (IPv6) of an ip address
+	ModeTruncate Mode = "truncate"
+)
+
+// Channel is a consumer of subscriber identities
+type Channel int
+
+const (
+	Logs Channel = iota
+	Metrics
+	ApiObserver
+	ApiOperator
+	channels
+)
+
+const (
+	hashPrefix  = "h:"
+	hashLength  = 8 // bytes of the hmac kept
+	plmnDigits  = 5 // MCC and a two digit MNC, three digit MNCs lose one digit
+	imsiPrefix  = "imsi-"
+	maskedTmsi  = 8 // hex digits of the 5G-TMSI at the end of a GUTI
+	ipv4Network = 24
+	ipv6Network = 48
+)
+
+// keyCheckInterval is how often the key is read again to pick up a rotation
+var keyCheckInterval = 10 * time.Second
+
+type settings struct {
+	key *credentials.Secret
+	// hasher is of the last key read, hashing on while the key cannot be
+	// read rather than letting identities out
+	hasher atomic.Pointer[hasher]
+	// checked is when the key was last read, in unix nanoseconds
+	checked atomic.Int64
+	modes   [channels]Mode
+}
+
+// hasher reuses the hmacs keyed with key
+type hasher struct {
+	key  string
+	macs sync.Pool
+}
+
+func newHasher(key string) *hasher {
+	h := &hasher{key: key}
+	h.macs.New = func() any { return hmac.New(sha256.New, []byte(key)) }
+	return h
+}
+
+// current starts out with all channels clear
+var current atomic.Pointer[settings]
+
+func init() {
+	s := &settings{}
+	for ch := range s.modes {
+		s.modes[ch] = ModeClear
+	}
+	current.Store(s)
+}
+
+func parseMode(name string) (Mode, error) {
+	switch Mode(name) {
+	case "", ModeClear:
+		return ModeClear, nil
+	case ModeHash, ModeTruncate:
+		return Mode(name), nil
+	default:
+		return "", fmt.Errorf("unknown privacy mode [%s]", name)
+	}
+}
+
+// Init sets the mode of every channel, all channels are clear when cfg is
+// nil
+func Init(cfg *config.Privacy) error {
+	s := &settings{}
+	if cfg == nil {
+		cfg = &config.Privacy{}
+	}
+
+	var err error
+	for ch, name := range map[Channel]string{
+		Logs:        cfg.Logs,
+		Metrics:     cfg.Metrics,
+		ApiObserver: cfg.Api.Observer,
+		ApiOperator: cfg.Api.Operator,
+	} {
+		if s.modes[ch], err = parseMode(name); err != nil {
+			return err
+		}
+	}
+
+	for _, mode := range s.modes {
+		if mode != ModeHash || s.key != nil {
+			continue
+		}
+		if cfg.HashKey == nil {
+			return errors.New("hash mode requires a hashKey")
+		}
+		secret, err := credentials.NewSecret(cfg.HashKey, "hashKey")
+		if err != nil {
+			return err
+		}
+		key, err := secret.Get()
+		if err != nil {
+			return err
+		}
+		s.key = secret
+		s.hasher.Store(newHasher(key))
+		s.checked.Store(time.Now().UnixNano())
+	}
+	if s.modes[Metrics] == ModeTruncate {
+		return errors.New("metrics privacy cannot truncate, distinct subscribers would share a series")
+	}
+	current.Store(s)
+	return nil
+}
+
+// Enabled reports whether identities are altered on the channel
+func Enabled(ch Channel) bool {
+	return current.Load().modes[ch] != ModeClear
+}
+
+// currentHasher returns the hasher of the current key. The key is read
+// again once per keyCheckInterval, by a single caller, to pick up a rotated
+// key file
+func (s *settings) currentHasher() *hasher {
+	h := s.hasher.Load()
+	now := time.Now().UnixNano()
+	checked := s.checked.Load()
+	if time.Duration(now-checked) < keyCheckInterval || !s.checked.CompareAndSwap(checked, now) {
+		return h
+	}
+	key, err := s.key.Get()
+	if err != nil || key == h.key {
+		return h
+	}
+	h = newHasher(key)
+	s.hasher.Store(h)
+	return h
+}
+
+func (s *settings) hash(kind, value string) string {
+	h := s.currentHasher()
+	mac := h.macs.Get().(hash.Hash)
+	defer h.macs.Put(mac)
+	mac.Reset()
+	// the kind keeps an imsi and an ip address of the same spelling apart
+	mac.Write([]byte(kind + ":" + value))
+	return hashPrefix + hex.EncodeToString(mac.Sum(nil)[:hashLength])
+}
+
+// Imsi pseudonymises an imsi, with or without the imsi- prefix
+func Imsi(ch Channel, imsi string) string {
+	s := current.Load()
+	if imsi == "" || s.modes[ch] == ModeClear {
+		return imsi
+	}
+	digits := strings.TrimPrefix(imsi, imsiPrefix)
+	prefix := imsi[:len(imsi)-len(digits)]
+	if s.modes[ch] == ModeHash {
+		return prefix + s.hash("imsi", digits)
+	}
+	if len(digits) <= plmnDigits {
+		return prefix + strings.Repeat("*", len(digits))
+	}
+	return prefix + digits[:plmnDigits] + strings.Repeat("*", len(digits)-plmnDigits)
+}
+
+// IpAddr pseudonymises an ip address
+func IpAddr(ch Channel, ipAddr string) string {
+	s := current.Load()
+	if ipAddr == "" || s.modes[ch] == ModeClear {
+		return ipAddr
+	}
+	if s.modes[ch] == ModeHash {
+		return s.hash("ip", ipAddr)
+	}
+	ip := net.ParseIP(ipAddr)
+	if ip == nil {
+		return "*"
+	}
+	mask := net.CIDRMask(ipv6Network, 8*net.IPv6len)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, mask = ip4, net.CIDRMask(ipv4Network, 8*net.IPv4len)
+	}
+	return (&net.IPNet{IP: ip.Mask(mask), Mask: mask}).String()
+}
+
+// IpAddrs pseudonymises a list of ip addresses
+func IpAddrs(ch Channel, ipAddrs []string) []string {
+	if !Enabled(ch) {
+		return ipAddrs
+	}
+	masked := make([]string, len(ipAddrs))
+	for i, ipAddr := range ipAddrs {
+		masked[i] = IpAddr(ch, ipAddr)
+	}
+	return masked
+}
+
+// Guti pseudonymises a GUTI, truncation masks the 5G-TMSI
+func Guti(ch Channel, guti string) string {
+	s := current.Load()
+	if guti == "" || s.modes[ch] == ModeClear {
+		return guti
+	}
+	if s.modes[ch] == ModeHash {
+		return s.hash("guti", guti)
+	}
+	if len(guti) <= maskedTmsi {
+		return strings.Repeat("*", len(guti))
+	}
+	return guti[:len(guti)-maskedTmsi] + strings.Repeat("*", maskedTmsi)
+}
+
+// Subscriber returns sub with its identities pseudonymised, sub itself is
+// returned when the channel is clear
+func Subscriber(ch Channel, sub *metricinfo.CoreSubscriber) *metricinfo.CoreSubscriber {
+	if sub == nil || !Enabled(ch) {
+		return sub
+	}
+	masked := *sub
+	masked.Imsi = Imsi(ch, sub.Imsi)
+	masked.IPAddress = IpAddr(ch, sub.IPAddress)
+	masked.Guti = Guti(ch, sub.Guti)
+	// the tmsi identifies the subscriber within the AMF
+	masked.Tmsi = 0
+	return &masked
+}
@@ -0,0 +1,138 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package privacy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/omec-project/metricfunc/config"
+	"github.com/omec-project/util/metricinfo"
+)
+
+func initPrivacy(t *testing.T, cfg *config.Privacy) {
+	t.Helper()
+	if err := Init(cfg); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = Init(nil) })
+}
+
+func TestTruncate(t *testing.T) {
+	initPrivacy(t, &config.Privacy{Logs: "truncate"})
+
+	for _, tc := range []struct{ got, want string }{
+		{Imsi(Logs, "208930000000001"), "20893**********"},
+		{Imsi(Logs, "imsi-208930000000001"), "imsi-20893**********"},
+		{IpAddr(Logs, "172.250.1.17"), "172.250.1.0/24"},
+		{IpAddr(Logs, "2001:db8:1234:5678::1"), "2001:db8:1234::/48"},
+		{IpAddr(Logs, "not-an-ip"), "*"},
+		{Guti(Logs, "2089300007487c0000000001"), "2089300007487c00********"},
+		// other channels stay clear
+		{Imsi(Metrics, "208930000000001"), "208930000000001"},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("got %q want %q", tc.got, tc.want)
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	t.Setenv("METRICFUNC_TEST_PRIVACY_KEY", "k1")
+	initPrivacy(t, &config.Privacy{
+		HashKey: &config.Secret{Env: "METRICFUNC_TEST_PRIVACY_KEY"},
+		Metrics: "hash",
+	})
+
+	hashed := Imsi(Metrics, "208930000000001")
+	if !strings.HasPrefix(hashed, hashPrefix) || strings.Contains(hashed, "0000000001") {
+		t.Fatalf("imsi not hashed: %q", hashed)
+	}
+	if Imsi(Metrics, "imsi-208930000000001") != "imsi-"+hashed {
+		t.Fatal("imsi with prefix hashed differently")
+	}
+	if Imsi(Metrics, "208930000000002") == hashed {
+		t.Fatal("different imsis share a hash")
+	}
+
+	// another key gives other hashes
+	t.Setenv("METRICFUNC_TEST_PRIVACY_KEY", "k2")
+	initPrivacy(t, &config.Privacy{HashKey: &config.Secret{Env: "METRICFUNC_TEST_PRIVACY_KEY"}, Metrics: "hash"})
+	if Imsi(Metrics, "208930000000001") == hashed {
+		t.Fatal("hash does not depend on the key")
+	}
+}
+
+func TestHashKeyRotation(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "privacy-key")
+	if err := os.WriteFile(keyFile, []byte("k1"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	initPrivacy(t, &config.Privacy{HashKey: &config.Secret{File: keyFile}, Metrics: "hash"})
+	hashed := Imsi(Metrics, "208930000000001")
+
+	if err := os.WriteFile(keyFile, []byte("k2"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(keyFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+	// the key is not read again on every hash
+	if got := Imsi(Metrics, "208930000000001"); got != hashed {
+		t.Fatalf("key read again before the check interval, got %q want %q", got, hashed)
+	}
+
+	interval := keyCheckInterval
+	keyCheckInterval = 0
+	t.Cleanup(func() { keyCheckInterval = interval })
+	rotated := Imsi(Metrics, "208930000000001")
+	if rotated == hashed {
+		t.Fatal("rotated key not used")
+	}
+
+	// identities stay hashed, with the last key, while the key is missing
+	if err := os.Remove(keyFile); err != nil {
+		t.Fatal(err)
+	}
+	if got := Imsi(Metrics, "208930000000001"); got != rotated {
+		t.Errorf("got %q without the key file, want %q", got, rotated)
+	}
+}
+
+func TestMetricsTruncateRejected(t *testing.T) {
+	if err := Init(&config.Privacy{Metrics: "truncate"}); err == nil {
+		t.Fatal("expected truncated metric labels to be rejected")
+	}
+}
+
+func TestHashRequiresKey(t *testing.T) {
+	if err := Init(&config.Privacy{Api: config.ApiPrivacy{Observer: "hash"}}); err == nil {
+		t.Fatal("expected hash mode without key to be rejected")
+	}
+	if err := Init(&config.Privacy{Logs: "scramble"}); err == nil {
+		t.Fatal("expected unknown mode to be rejected")
+	}
+}
+
+func TestSubscriber(t *testing.T) {
+	initPrivacy(t, &config.Privacy{Api: config.ApiPrivacy{Observer: "truncate"}})
+	sub := &metricinfo.CoreSubscriber{Imsi: "208930000000001", IPAddress: "172.250.1.17", Tmsi: 1, Dnn: "internet"}
+
+	if Subscriber(ApiOperator, sub) != sub {
+		t.Fatal("clear channel should return the subscriber unchanged")
+	}
+	masked := Subscriber(ApiObserver, sub)
+	if masked.Imsi != "20893**********" || masked.IPAddress != "172.250.1.0/24" || masked.Tmsi != 0 ||
+		masked.Dnn != "internet" {
+		t.Fatalf("unexpected masked subscriber %+v", masked)
+	}
+	if sub.Imsi != "208930000000001" {
+		t.Fatal("subscriber modified in place")
+	}
+}
@@ -0,0 +1,76 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package profiling serves the pprof profiles on a server of their own,
+// to operators only
+package profiling
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"strconv"
+	"time"
+
+	"github.com/omec-project/metricfunc/config"
+	"github.com/omec-project/metricfunc/internal/apiauth"
+	"github.com/omec-project/metricfunc/logger"
+)
+
+// NewServer returns the pprof server, served by the caller. The callers
+// are authenticated by auth and must be operators, the server is open to
+// everyone when auth is nil.
+func NewServer(cfg *config.ServerAddr, auth *config.ApiServerAuth) (*http.Server, error) {
+	authenticator, err := apiauth.New(auth)
+	if err != nil {
+		return nil, fmt.Errorf("pprof server authentication: %w", err)
+	}
+	if authenticator == nil {
+		logger.AppLog.Warnln("pprof server authentication disabled, all callers may read the profiles")
+	}
+
+	mux := http.NewServeMux()
+	// the named profiles, such as heap and goroutine, are served by Index
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	logger.AppLog.Debugf("pprof server initialised on [%v]", net.JoinHostPort(cfg.Addr, strconv.Itoa(cfg.Port)))
+	return &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Port),
+		Handler:           authorize(authenticator, mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}, nil
+}
+
+// authorize passes the requests of operators on to next
+func authorize(authenticator *apiauth.Authenticator, next http.Handler) http.Handler {
+	if authenticator == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		identity, err := authenticator.Authenticate(req)
+		switch {
+		case errors.Is(err, apiauth.ErrNoCredentials), errors.Is(err, apiauth.ErrInvalidCredentials):
+			logger.AppLog.Warnf("pprof server: %v for [%s] from [%s]", err, req.URL.Path, req.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metricfunc"`)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		case err != nil:
+			logger.AppLog.Errorf("pprof server authentication error: %+v", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		case identity.Role < apiauth.RoleOperator:
+			logger.AppLog.Warnf("[%s] with role [%s] denied pprof [%s], requires [%s]",
+				identity.Name, identity.Role, req.URL.Path, apiauth.RoleOperator)
+			http.Error(w, "requires role "+apiauth.RoleOperator.String(), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,61 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package profiling
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/omec-project/metricfunc/config"
+)
+
+func TestAuthorize(t *testing.T) {
+	t.Setenv("METRICFUNC_TEST_OBSERVER", "observer-token")
+	t.Setenv("METRICFUNC_TEST_OPERATOR", "operator-token")
+	server, err := NewServer(&config.ServerAddr{Port: 5001}, &config.ApiServerAuth{Tokens: []config.ApiToken{
+		{Name: "grafana", Token: &config.Secret{Env: "METRICFUNC_TEST_OBSERVER"}, Role: "observer"},
+		{Name: "admin", Token: &config.Secret{Env: "METRICFUNC_TEST_OPERATOR"}, Role: "operator"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		token string
+		path  string
+		want  int
+	}{
+		{"", "/debug/pprof/", http.StatusUnauthorized},
+		{"guess", "/debug/pprof/", http.StatusUnauthorized},
+		{"observer-token", "/debug/pprof/", http.StatusForbidden},
+		{"operator-token", "/debug/pprof/", http.StatusOK},
+		{"operator-token", "/debug/pprof/goroutine", http.StatusOK},
+		// metrics are not served on the pprof server
+		{"operator-token", "/metrics", http.StatusNotFound},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("GET %s with [%s] = %d, want %d", tc.path, tc.token, rec.Code, tc.want)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	server, err := NewServer(&config.ServerAddr{Port: 5001}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/pprof/cmdline", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("GET /debug/pprof/cmdline = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
@@ -6,11 +6,21 @@ package promclient
 
 import (
 	"fmt"
+	"net"
 	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/omec-project/metricfunc/config"
+	"github.com/omec-project/metricfunc/internal/health"
+	"github.com/omec-project/metricfunc/internal/privacy"
 	"github.com/omec-project/metricfunc/logger"
+	"github.com/omec-project/util/http2_util"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
@@ -21,25 +31,100 @@ type PromStats struct {
 	amfSvcStat  *prometheus.CounterVec
 	smfSessions *prometheus.GaugeVec
 	nfStatus    *prometheus.GaugeVec
+
+	nfStale    *prometheus.GaugeVec
+	nfLastSeen *prometheus.GaugeVec
+	nfUptime   *prometheus.GaugeVec
+	nfDowntime *prometheus.GaugeVec
+	nfFlaps    *prometheus.GaugeVec
+
+	nfProbeUp       *prometheus.GaugeVec
+	nfProbeDuration *prometheus.GaugeVec
+
+	controllerQueueDepth    prometheus.Gauge
+	controllerQueueRejected prometheus.Counter
+	controllerQueueWait     prometheus.Histogram
+	controllerTaskDuration  *prometheus.HistogramVec
+	controllerOutcome       *prometheus.CounterVec
+
+	upstreamAttempts    *prometheus.CounterVec
+	upstreamFailures    *prometheus.CounterVec
+	upstreamCircuitOpen *prometheus.GaugeVec
+
+	// metricfunc itself
+	kafkaMessages      *prometheus.CounterVec
+	kafkaFailures      *prometheus.CounterVec
+	kafkaLag           *prometheus.GaugeVec
+	eventDuration      *prometheus.HistogramVec
+	apiRequestDuration *prometheus.HistogramVec
+	cacheEntries       *cacheSizes
+	buildInfo          *prometheus.GaugeVec
+	pushFailures       *prometheus.CounterVec
+	pushDropped        *prometheus.CounterVec
+	pushBuffered       *prometheus.GaugeVec
+}
+
+// cacheSizes reports the number of entries of the caches when scraped
+type cacheSizes struct {
+	desc  *prometheus.Desc
+	lock  sync.Mutex
+	sizes map[string]func() int
+}
+
+func (c *cacheSizes) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
 }
 
-var promStats *PromStats
+func (c *cacheSizes) Collect(ch chan<- prometheus.Metric) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for cache, size := range c.sizes {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(size()), cache)
+	}
+}
+
+var (
+	promStats *PromStats
+	// registry holds the metrics of metricfunc only, leaving the global
+	// registry to the libraries
+	registry = prometheus.NewRegistry()
+)
 
 func init() {
 	promStats = initPromStats()
+	registry.MustRegister(collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
 
 	if err := promStats.register(); err != nil {
 		logger.PromLog.Panicln("prometheus stats register failed", err.Error())
 	}
 }
 
-func StartPrometheusClient(cfg *config.ServerAddr) {
-	logger.PromLog.Debugf("prometheus server initialised on address [%v] port [%v]", cfg.Addr, cfg.Port)
+// Handler serves the metrics of metricfunc, for the prometheus server and
+// the api server
+func Handler() http.Handler {
+	return promhttp.InstrumentMetricHandler(registry, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+}
+
+// Gatherer returns the metrics of metricfunc
+func Gatherer() prometheus.Gatherer {
+	return registry
+}
+
+// NewPrometheusServer returns the server of the /metrics endpoint and the
+// kubernetes probes, served by the caller
+func NewPrometheusServer(cfg *config.ServerAddr) (*http.Server, error) {
+	logger.PromLog.Debugf("prometheus server initialised on [%v]", net.JoinHostPort(cfg.Addr, strconv.Itoa(cfg.Port)))
 	HTTPAddr := fmt.Sprintf(":%d", cfg.Port)
-	http.Handle("/metrics", promhttp.Handler())
-	if err := http.ListenAndServe(HTTPAddr, nil); err != nil {
-		logger.PromLog.Errorf("failed to start http server: %v", err)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	mux.HandleFunc("/healthz", health.LiveHandler)
+	mux.HandleFunc("/readyz", health.ReadyHandler)
+	server, err := http2_util.NewServer(HTTPAddr, "", mux)
+	if err != nil {
+		return nil, fmt.Errorf("prometheus server initialise: %w", err)
 	}
+	return server, nil
 }
 
 func initPromStats() *PromStats {
@@ -64,6 +149,41 @@ func initPromStats() *PromStats {
 			Help: "NF Status up/down",
 		}, []string{"Nfname", "nfType"}),
 
+		nfStale: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "nf_status_stale",
+			Help: "Whether the NF was silent for longer than the staleness timeout, its status unknown",
+		}, []string{"Nfname", "nfType"}),
+
+		nfLastSeen: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "nf_status_last_seen_timestamp_seconds",
+			Help: "Time of the last status event of the NF",
+		}, []string{"Nfname", "nfType"}),
+
+		nfUptime: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "nf_status_uptime_seconds",
+			Help: "Time the NF spent connected since first seen",
+		}, []string{"Nfname", "nfType"}),
+
+		nfDowntime: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "nf_status_downtime_seconds",
+			Help: "Time the NF spent disconnected or unknown since first seen",
+		}, []string{"Nfname", "nfType"}),
+
+		nfFlaps: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "nf_status_flaps",
+			Help: "Times the NF went from connected to disconnected or unknown",
+		}, []string{"Nfname", "nfType"}),
+
+		nfProbeUp: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "nf_probe_up",
+			Help: "Whether the last probe of the NF reached it",
+		}, []string{"Nfname", "nfType", "probe"}),
+
+		nfProbeDuration: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "nf_probe_duration_seconds",
+			Help: "Time taken by the last probe of the NF",
+		}, []string{"Nfname", "nfType", "probe"}),
+
 		smfSvcStat: prometheus.NewCounterVec(prometheus.CounterOpts{
 			Name: "smf_svc_stats",
 			Help: "smf service stats",
@@ -73,65 +193,263 @@ func initPromStats() *PromStats {
 			Name: "amf_svc_stats",
 			Help: "amf service stats",
 		}, []string{"amfid", "msgtype"}),
+
+		controllerQueueDepth: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "controller_queue_depth",
+			Help: "Number of rogue ip tasks waiting in the controller queue",
+		}),
+
+		controllerQueueRejected: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "controller_queue_rejected_total",
+			Help: "Number of rogue ip tasks rejected because the controller queue was full",
+		}),
+
+		controllerQueueWait: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "controller_queue_wait_seconds",
+			Help:    "Time rogue ip tasks spent in the controller queue",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+		}),
+
+		controllerTaskDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "controller_task_duration_seconds",
+			Help:    "Time taken to handle a controller task",
+			Buckets: prometheus.ExponentialBuckets(0.005, 3, 10),
+		}, []string{"kind"}),
+
+		controllerOutcome: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "controller_outcome_total",
+			Help: "Outcomes of rogue ip report handling",
+		}, []string{"outcome"}),
+
+		upstreamAttempts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "controller_upstream_attempts_total",
+			Help: "Outbound request attempts of the controller per upstream and result",
+		}, []string{"upstream", "result"}),
+
+		upstreamFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "controller_upstream_failures_total",
+			Help: "Failed outbound request attempts of the controller per upstream",
+		}, []string{"upstream"}),
+
+		upstreamCircuitOpen: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "controller_upstream_circuit_open",
+			Help: "Whether the circuit breaker of the upstream is open",
+		}, []string{"upstream"}),
+
+		kafkaMessages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "metricfunc_kafka_messages_total",
+			Help: "Kafka messages consumed per topic and event type",
+		}, []string{"topic", "event_type"}),
+
+		kafkaFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "metricfunc_kafka_messages_failed_total",
+			Help: "Kafka messages which could not be read or handled per topic and reason",
+		}, []string{"topic", "reason"}),
+
+		kafkaLag: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "metricfunc_kafka_consumer_lag",
+			Help: "Messages of the topic not consumed yet, as of the last message consumed",
+		}, []string{"topic"}),
+
+		eventDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "metricfunc_event_handling_duration_seconds",
+			Help:    "Time taken to handle a Kafka event per event type",
+			Buckets: prometheus.ExponentialBuckets(0.00001, 4, 10),
+		}, []string{"event_type"}),
+
+		apiRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "metricfunc_api_request_duration_seconds",
+			Help:    "Time taken to serve an api request per route and status code",
+			Buckets: prometheus.ExponentialBuckets(0.0005, 4, 10),
+		}, []string{"method", "route", "code"}),
+
+		cacheEntries: &cacheSizes{
+			desc: prometheus.NewDesc("metricfunc_cache_entries",
+				"Number of entries of the in-memory caches", []string{"cache"}, nil),
+			sizes: make(map[string]func() int),
+		},
+
+		buildInfo: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "metricfunc_build_info",
+			Help: "Version of metricfunc, always 1",
+		}, []string{"version", "revision", "goversion"}),
+
+		pushFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "metricfunc_push_failures_total",
+			Help: "Failed pushes of the metrics per receiver",
+		}, []string{"receiver"}),
+
+		pushDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "metricfunc_push_dropped_total",
+			Help: "Pushes of the metrics dropped per receiver, on a full buffer or rejected",
+		}, []string{"receiver"}),
+
+		pushBuffered: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "metricfunc_push_buffered",
+			Help: "Pushes of the metrics buffered per receiver, not sent yet",
+		}, []string{"receiver"}),
 	}
 }
 
 func (ps *PromStats) register() error {
-	if err := prometheus.Register(ps.coreSub); err != nil {
+	if err := registry.Register(ps.coreSub); err != nil {
 		logger.PromLog.Errorf("register core subscriber detail stats failed: %v", err.Error())
 		return err
 	}
 
-	if err := prometheus.Register(ps.violSub); err != nil {
+	if err := registry.Register(ps.violSub); err != nil {
 		logger.PromLog.Errorf("register viol subscriber detail stats failed: %v", err.Error())
 		return err
 	}
 
-	if err := prometheus.Register(ps.smfSessions); err != nil {
+	if err := registry.Register(ps.smfSessions); err != nil {
 		logger.PromLog.Errorf("register core subscriber count stats failed: %v", err.Error())
 		return err
 	}
 
-	if err := prometheus.Register(ps.nfStatus); err != nil {
+	if err := registry.Register(ps.nfStatus); err != nil {
 		logger.PromLog.Errorf("register nf status stats failed: %v", err.Error())
 		return err
 	}
 
-	if err := prometheus.Register(ps.smfSvcStat); err != nil {
+	for _, nfGauge := range []*prometheus.GaugeVec{
+		ps.nfStale, ps.nfLastSeen, ps.nfUptime, ps.nfDowntime, ps.nfFlaps, ps.nfProbeUp, ps.nfProbeDuration,
+	} {
+		if err := registry.Register(nfGauge); err != nil {
+			logger.PromLog.Errorf("register nf status details failed: %v", err.Error())
+			return err
+		}
+	}
+
+	if err := registry.Register(ps.smfSvcStat); err != nil {
 		logger.PromLog.Errorf("register smf service stats failed: %v", err.Error())
 		return err
 	}
 
-	if err := prometheus.Register(ps.amfSvcStat); err != nil {
+	if err := registry.Register(ps.amfSvcStat); err != nil {
 		logger.PromLog.Errorf("register amf service stats failed: %v", err.Error())
 		return err
 	}
+
+	if err := registry.Register(ps.controllerQueueDepth); err != nil {
+		logger.PromLog.Errorf("register controller queue depth failed: %v", err.Error())
+		return err
+	}
+
+	if err := registry.Register(ps.controllerQueueRejected); err != nil {
+		logger.PromLog.Errorf("register controller queue rejected failed: %v", err.Error())
+		return err
+	}
+
+	if err := registry.Register(ps.controllerQueueWait); err != nil {
+		logger.PromLog.Errorf("register controller queue wait failed: %v", err.Error())
+		return err
+	}
+
+	if err := registry.Register(ps.controllerTaskDuration); err != nil {
+		logger.PromLog.Errorf("register controller task duration failed: %v", err.Error())
+		return err
+	}
+
+	if err := registry.Register(ps.controllerOutcome); err != nil {
+		logger.PromLog.Errorf("register controller outcome failed: %v", err.Error())
+		return err
+	}
+
+	if err := registry.Register(ps.upstreamAttempts); err != nil {
+		logger.PromLog.Errorf("register upstream attempts failed: %v", err.Error())
+		return err
+	}
+
+	if err := registry.Register(ps.upstreamFailures); err != nil {
+		logger.PromLog.Errorf("register upstream failures failed: %v", err.Error())
+		return err
+	}
+
+	if err := registry.Register(ps.upstreamCircuitOpen); err != nil {
+		logger.PromLog.Errorf("register upstream circuit state failed: %v", err.Error())
+		return err
+	}
+
+	if err := registry.Register(ps.kafkaMessages); err != nil {
+		logger.PromLog.Errorf("register kafka messages failed: %v", err.Error())
+		return err
+	}
+
+	if err := registry.Register(ps.kafkaFailures); err != nil {
+		logger.PromLog.Errorf("register kafka failures failed: %v", err.Error())
+		return err
+	}
+
+	if err := registry.Register(ps.kafkaLag); err != nil {
+		logger.PromLog.Errorf("register kafka consumer lag failed: %v", err.Error())
+		return err
+	}
+
+	if err := registry.Register(ps.eventDuration); err != nil {
+		logger.PromLog.Errorf("register event handling duration failed: %v", err.Error())
+		return err
+	}
+
+	if err := registry.Register(ps.apiRequestDuration); err != nil {
+		logger.PromLog.Errorf("register api request duration failed: %v", err.Error())
+		return err
+	}
+
+	if err := registry.Register(ps.cacheEntries); err != nil {
+		logger.PromLog.Errorf("register cache entries failed: %v", err.Error())
+		return err
+	}
+
+	if err := registry.Register(ps.buildInfo); err != nil {
+		logger.PromLog.Errorf("register build info failed: %v", err.Error())
+		return err
+	}
+
+	if err := registry.Register(ps.pushFailures); err != nil {
+		logger.PromLog.Errorf("register push failures failed: %v", err.Error())
+		return err
+	}
+
+	if err := registry.Register(ps.pushDropped); err != nil {
+		logger.PromLog.Errorf("register push dropped failed: %v", err.Error())
+		return err
+	}
+
+	if err := registry.Register(ps.pushBuffered); err != nil {
+		logger.PromLog.Errorf("register push buffered failed: %v", err.Error())
+		return err
+	}
 	return nil
 }
 
-// PushCoreSubData increments message level stats
+// PushCoreSubData increments message level stats. The imsi and ip_addr
+// labels are pseudonymised according to the metrics privacy mode.
 func PushCoreSubData(imsi, ip_addr, state, smf_ip, dnn, slice, upf string) {
 	logger.PromLog.Debugf(
 		"adding subscriber data [%v, %v, %v, %v, %v, %v, %v]",
-		imsi, ip_addr, state, smf_ip, dnn, slice, upf,
+		privacy.Imsi(privacy.Logs, imsi), privacy.IpAddr(privacy.Logs, ip_addr), state, smf_ip, dnn, slice, upf,
 	)
-	promStats.coreSub.WithLabelValues(imsi, ip_addr, state, smf_ip, dnn, slice, upf).Inc()
+	promStats.coreSub.WithLabelValues(privacy.Imsi(privacy.Metrics, imsi), privacy.IpAddr(privacy.Metrics, ip_addr),
+		state, smf_ip, dnn, slice, upf).Inc()
 }
 
 func DeleteCoreSubData(imsi, ip_addr, state, smf_ip, dnn, slice, upf string) {
 	logger.PromLog.Debugf(
 		"deleting subscriber data [%v, %v, %v, %v, %v, %v, %v]",
-		imsi, ip_addr, state, smf_ip, dnn, slice, upf,
+		privacy.Imsi(privacy.Logs, imsi), privacy.IpAddr(privacy.Logs, ip_addr), state, smf_ip, dnn, slice, upf,
 	)
-	promStats.coreSub.DeleteLabelValues(imsi, ip_addr, state, smf_ip, dnn, slice, upf)
+	promStats.coreSub.DeleteLabelValues(privacy.Imsi(privacy.Metrics, imsi), privacy.IpAddr(privacy.Metrics, ip_addr),
+		state, smf_ip, dnn, slice, upf)
 }
 
 func PushViolSubData(imsi, ip_addr, state string) {
 	logger.PromLog.Debugf(
 		"adding viol subscriber data [%v, %v, %v]",
-		imsi, ip_addr, state,
+		privacy.Imsi(privacy.Logs, imsi), privacy.IpAddr(privacy.Logs, ip_addr), state,
 	)
-	promStats.violSub.WithLabelValues(imsi, ip_addr, state).Inc()
+	promStats.violSub.WithLabelValues(privacy.Imsi(privacy.Metrics, imsi), privacy.IpAddr(privacy.Metrics, ip_addr),
+		state).Inc()
 }
 
 // SetSessStats maintains Session level stats
@@ -148,6 +466,32 @@ func SetNfStatus(nfName, nfType, nfStatus string, value uint64) {
 	promStats.nfStatus.WithLabelValues(nfName, nfType).Set(float64(value))
 }
 
+// SetNfStatusDetails sets the staleness, last event, uptime, downtime and
+// flaps of an nf
+func SetNfStatusDetails(nfName, nfType string, stale bool, lastSeen time.Time, uptime, downtime time.Duration,
+	flaps int,
+) {
+	var staleValue float64
+	if stale {
+		staleValue = 1
+	}
+	promStats.nfStale.WithLabelValues(nfName, nfType).Set(staleValue)
+	promStats.nfLastSeen.WithLabelValues(nfName, nfType).Set(float64(lastSeen.UnixMilli()) / 1000)
+	promStats.nfUptime.WithLabelValues(nfName, nfType).Set(uptime.Seconds())
+	promStats.nfDowntime.WithLabelValues(nfName, nfType).Set(downtime.Seconds())
+	promStats.nfFlaps.WithLabelValues(nfName, nfType).Set(float64(flaps))
+}
+
+// SetNfProbe sets the result of the last probe of an nf
+func SetNfProbe(nfName, nfType, probe string, up bool, duration time.Duration) {
+	var upValue float64
+	if up {
+		upValue = 1
+	}
+	promStats.nfProbeUp.WithLabelValues(nfName, nfType, probe).Set(upValue)
+	promStats.nfProbeDuration.WithLabelValues(nfName, nfType, probe).Set(duration.Seconds())
+}
+
 func IncrementSmfSvcStats(smfId, msgType string) {
 	logger.PromLog.Debugf("incrementing smf service stats, instance [%v] msgtype [%v]", smfId, msgType)
 	promStats.smfSvcStat.WithLabelValues(smfId, msgType).Inc()
@@ -157,3 +501,89 @@ func IncrementAmfSvcStats(amfId, msgType string) {
 	logger.PromLog.Debugf("incrementing amf service stats, instance [%v] msgtype [%v]", amfId, msgType)
 	promStats.smfSvcStat.WithLabelValues(amfId, msgType).Inc()
 }
+
+func SetControllerQueueDepth(depth int) {
+	promStats.controllerQueueDepth.Set(float64(depth))
+}
+
+func IncrementControllerQueueRejected() {
+	promStats.controllerQueueRejected.Inc()
+}
+
+func ObserveControllerQueueWait(wait time.Duration) {
+	promStats.controllerQueueWait.Observe(wait.Seconds())
+}
+
+func ObserveControllerTaskDuration(kind string, duration time.Duration) {
+	promStats.controllerTaskDuration.WithLabelValues(kind).Observe(duration.Seconds())
+}
+
+func IncrementControllerOutcome(outcome string) {
+	logger.PromLog.Debugf("incrementing controller outcome [%v]", outcome)
+	promStats.controllerOutcome.WithLabelValues(outcome).Inc()
+}
+
+func IncrementUpstreamAttempts(upstream, result string) {
+	promStats.upstreamAttempts.WithLabelValues(upstream, result).Inc()
+}
+
+func IncrementUpstreamFailures(upstream string) {
+	promStats.upstreamFailures.WithLabelValues(upstream).Inc()
+}
+
+func SetUpstreamCircuitOpen(upstream string, open bool) {
+	var value float64
+	if open {
+		value = 1
+	}
+	promStats.upstreamCircuitOpen.WithLabelValues(upstream).Set(value)
+}
+
+func IncrementKafkaMessages(topic, eventType string) {
+	promStats.kafkaMessages.WithLabelValues(topic, eventType).Inc()
+}
+
+func IncrementKafkaFailures(topic, reason string) {
+	promStats.kafkaFailures.WithLabelValues(topic, reason).Inc()
+}
+
+func SetKafkaConsumerLag(topic string, lag int64) {
+	promStats.kafkaLag.WithLabelValues(topic).Set(float64(lag))
+}
+
+// DeleteKafkaTopic drops the series of a topic no longer read
+func DeleteKafkaTopic(topic string) {
+	promStats.kafkaLag.DeleteLabelValues(topic)
+}
+
+func ObserveEventDuration(eventType string, duration time.Duration) {
+	promStats.eventDuration.WithLabelValues(eventType).Observe(duration.Seconds())
+}
+
+// ObserveApiRequest records an api request by route pattern, the paths hold
+// subscriber identities
+func ObserveApiRequest(method, route string, code int, duration time.Duration) {
+	promStats.apiRequestDuration.WithLabelValues(method, route, strconv.Itoa(code)).Observe(duration.Seconds())
+}
+
+// RegisterCacheSize reports the number of entries of a cache, size is
+// called on every scrape
+func RegisterCacheSize(cache string, size func() int) {
+	promStats.cacheEntries.lock.Lock()
+	defer promStats.cacheEntries.lock.Unlock()
+	promStats.cacheEntries.sizes[cache] = size
+}
+
+// SetBuildInfo reports the version of metricfunc and the vcs revision it
+// was built from, when known
+func SetBuildInfo(version string) {
+	revision := "unknown"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				revision = setting.Value
+			}
+		}
+	}
+	promStats.buildInfo.WithLabelValues(version, revision, runtime.Version()).Set(1)
+}
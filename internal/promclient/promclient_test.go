@@ -0,0 +1,129 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package promclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	// registers pprof on the global mux, which must not be served
+	_ "net/http/pprof"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/omec-project/metricfunc/config"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// gather returns the series of the metric by their labels, joined as
+// name=value pairs
+func gather(t *testing.T, name string) map[string]*dto.Metric {
+	t.Helper()
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	series := make(map[string]*dto.Metric)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			var labels string
+			for _, label := range m.GetLabel() {
+				labels += label.GetName() + "=" + label.GetValue() + ","
+			}
+			series[labels] = m
+		}
+	}
+	return series
+}
+
+func TestCacheSize(t *testing.T) {
+	size := 3
+	RegisterCacheSize("test", func() int { return size })
+	t.Cleanup(func() { delete(promStats.cacheEntries.sizes, "test") })
+
+	m, ok := gather(t, "metricfunc_cache_entries")["cache=test,"]
+	if !ok || m.GetGauge().GetValue() != 3 {
+		t.Fatalf("cache entries = %v, want 3", m)
+	}
+	size = 5
+	if m := gather(t, "metricfunc_cache_entries")["cache=test,"]; m.GetGauge().GetValue() != 5 {
+		t.Errorf("cache entries = %v after resize, want 5", m)
+	}
+}
+
+func TestObserveApiRequest(t *testing.T) {
+	ObserveApiRequest("GET", "/nfStatus", 200, 10*time.Millisecond)
+	ObserveApiRequest("GET", "/nfStatus", 200, 20*time.Millisecond)
+
+	m, ok := gather(t, "metricfunc_api_request_duration_seconds")["code=200,method=GET,route=/nfStatus,"]
+	if !ok {
+		t.Fatal("no series of the route")
+	}
+	if count := m.GetHistogram().GetSampleCount(); count != 2 {
+		t.Errorf("sample count = %d, want 2", count)
+	}
+}
+
+func TestKafkaLag(t *testing.T) {
+	SetKafkaConsumerLag("test-topic", 7)
+	if m := gather(t, "metricfunc_kafka_consumer_lag")["topic=test-topic,"]; m.GetGauge().GetValue() != 7 {
+		t.Fatalf("lag = %v, want 7", m)
+	}
+	DeleteKafkaTopic("test-topic")
+	if _, ok := gather(t, "metricfunc_kafka_consumer_lag")["topic=test-topic,"]; ok {
+		t.Error("lag of the topic not deleted")
+	}
+}
+
+func TestBuildInfo(t *testing.T) {
+	SetBuildInfo("1.2.3")
+	for labels, m := range gather(t, "metricfunc_build_info") {
+		if m.GetGauge().GetValue() != 1 {
+			t.Errorf("build info %s = %v, want 1", labels, m.GetGauge().GetValue())
+		}
+		for _, label := range m.GetLabel() {
+			if label.GetName() == "goversion" && label.GetValue() != runtime.Version() {
+				t.Errorf("goversion = %s, want %s", label.GetValue(), runtime.Version())
+			}
+		}
+		return
+	}
+	t.Fatal("no build info")
+}
+
+func TestPrometheusServer(t *testing.T) {
+	server, err := NewPrometheusServer(&config.ServerAddr{Port: 9089})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]int{
+		"/metrics":            http.StatusOK,
+		"/debug/pprof/":       http.StatusNotFound,
+		"/debug/pprof/symbol": http.StatusNotFound,
+	} {
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != want {
+			t.Errorf("GET %s = %d, want %d", path, rec.Code, want)
+		}
+	}
+}
+
+func TestGlobalRegistryUntouched(t *testing.T) {
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if strings.HasPrefix(family.GetName(), "metricfunc_") {
+			t.Errorf("[%s] registered globally", family.GetName())
+		}
+	}
+}
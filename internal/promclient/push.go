@@ -0,0 +1,439 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package promclient
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/omec-project/metricfunc/config"
+	"github.com/omec-project/metricfunc/internal/credentials"
+	"github.com/omec-project/metricfunc/internal/tlsconfig"
+	"github.com/omec-project/metricfunc/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	otelprom "go.opentelemetry.io/contrib/bridges/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	defaultPushInterval   = 30 * time.Second
+	defaultPushBatchSize  = 10
+	defaultPushBufferSize = 120
+	// remoteWriteAttempts are made per push before the batch is left in
+	// the buffer for the next push
+	remoteWriteAttempts = 3
+)
+
+// remoteWriteBackoff is the delay before the first retry, doubled on the
+// next ones
+var remoteWriteBackoff = time.Second
+
+// errRejected is returned for batches the receiver will never accept, they
+// are dropped rather than retried
+var errRejected = errors.New("rejected by the receiver")
+
+// Pusher sends the metrics to the receivers of the configuration at every
+// interval, in addition to the /metrics endpoint
+type Pusher struct {
+	interval time.Duration
+	// lock keeps the push of Stop apart from the one of Run
+	lock      sync.Mutex
+	receivers []receiver
+	shutdown  []func(context.Context) error
+}
+
+// receiver is a push receiver fed with the metrics gathered
+type receiver interface {
+	push(ctx context.Context, families []*dto.MetricFamily, now time.Time)
+}
+
+// NewPusher returns the pusher to the receivers of cfg, run by the caller
+func NewPusher(cfg *config.MetricsPush) (*Pusher, error) {
+	p := &Pusher{interval: defaultPushInterval}
+	if cfg.Interval > 0 {
+		p.interval = time.Duration(cfg.Interval) * time.Second
+	}
+	batchSize := cmp.Or(cfg.BatchSize, defaultPushBatchSize)
+	bufferSize := cmp.Or(cfg.BufferSize, defaultPushBufferSize)
+
+	if cfg.RemoteWrite != nil {
+		client, err := newPushHttpClient(cfg.RemoteWrite)
+		if err != nil {
+			return nil, fmt.Errorf("remote-write: %w", err)
+		}
+		w := &remoteWrite{url: pushUrl(cfg.RemoteWrite, "/api/v1/write"), client: client}
+		external := externalLabels(cfg.ExternalLabels)
+		p.receivers = append(p.receivers, &pushBuffer[[]timeSeries]{
+			name:       "remote-write",
+			batchSize:  batchSize,
+			bufferSize: bufferSize,
+			collect: func(families []*dto.MetricFamily, now time.Time) ([]timeSeries, error) {
+				return remoteWriteSeries(families, now, external), nil
+			},
+			send: w.send,
+		})
+		logger.PromLog.Infof("pushing metrics to remote-write receiver [%s] every %v", w.url, p.interval)
+	}
+
+	if cfg.Otlp != nil {
+		client, err := newPushHttpClient(cfg.Otlp)
+		if err != nil {
+			return nil, fmt.Errorf("otlp: %w", err)
+		}
+		url := pushUrl(cfg.Otlp, "/v1/metrics")
+		exporter, err := otlpmetrichttp.New(context.Background(),
+			otlpmetrichttp.WithEndpointURL(url),
+			otlpmetrichttp.WithHTTPClient(client),
+			otlpmetrichttp.WithRetry(otlpmetrichttp.RetryConfig{
+				Enabled:         true,
+				InitialInterval: remoteWriteBackoff,
+				MaxInterval:     p.interval / 4,
+				MaxElapsedTime:  p.interval / 2,
+			}))
+		if err != nil {
+			return nil, fmt.Errorf("otlp: %w", err)
+		}
+		res := otlpResource(cfg.ExternalLabels)
+		p.receivers = append(p.receivers, &pushBuffer[*metricdata.ResourceMetrics]{
+			name:       "otlp",
+			batchSize:  batchSize,
+			bufferSize: bufferSize,
+			collect: func(families []*dto.MetricFamily, _ time.Time) (*metricdata.ResourceMetrics, error) {
+				producer := otelprom.NewMetricProducer(otelprom.WithGatherer(
+					prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) { return families, nil })))
+				scopes, err := producer.Produce(context.Background())
+				return &metricdata.ResourceMetrics{Resource: res, ScopeMetrics: scopes}, err
+			},
+			send: func(ctx context.Context, batch []*metricdata.ResourceMetrics) (int, error) {
+				for i, rm := range batch {
+					if err := exporter.Export(ctx, rm); err != nil {
+						return i, err
+					}
+				}
+				return len(batch), nil
+			},
+		})
+		p.shutdown = append(p.shutdown, exporter.Shutdown)
+		logger.PromLog.Infof("pushing metrics to otlp receiver [%s] every %v", url, p.interval)
+	}
+	return p, nil
+}
+
+// Run pushes the metrics at every interval until ctx is cancelled
+func (p *Pusher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			p.push(ctx)
+		}
+	}
+}
+
+// Stop pushes the metrics a last time, along with those still buffered
+func (p *Pusher) Stop(ctx context.Context) error {
+	p.push(ctx)
+	var errs []error
+	for _, shutdown := range p.shutdown {
+		errs = append(errs, shutdown(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+func (p *Pusher) push(ctx context.Context) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	families, err := registry.Gather()
+	if err != nil {
+		// the metrics gathered are pushed still
+		logger.PromLog.Warnf("gather metrics to push: %v", err)
+	}
+	now := time.Now()
+	for _, r := range p.receivers {
+		r.push(ctx, families, now)
+	}
+}
+
+// pushBuffer keeps the metrics gathered for a receiver until they are sent,
+// dropping the oldest once full
+type pushBuffer[T any] struct {
+	name       string
+	batchSize  int
+	bufferSize int
+	collect    func(families []*dto.MetricFamily, now time.Time) (T, error)
+	// send returns the number of items of the batch sent
+	send   func(ctx context.Context, batch []T) (int, error)
+	buffer []T
+}
+
+func (b *pushBuffer[T]) push(ctx context.Context, families []*dto.MetricFamily, now time.Time) {
+	item, err := b.collect(families, now)
+	if err != nil {
+		logger.PromLog.Warnf("[%s] convert metrics: %v", b.name, err)
+	} else {
+		b.buffer = append(b.buffer, item)
+	}
+	if dropped := len(b.buffer) - b.bufferSize; dropped > 0 {
+		b.buffer = slices.Delete(b.buffer, 0, dropped)
+		promStats.pushDropped.WithLabelValues(b.name).Add(float64(dropped))
+		logger.PromLog.Warnf("[%s] buffer full, dropped the %d oldest pushes", b.name, dropped)
+	}
+
+	for len(b.buffer) > 0 {
+		batch := b.buffer[:min(len(b.buffer), b.batchSize)]
+		sent, err := b.send(ctx, batch)
+		if errors.Is(err, errRejected) {
+			// sending it again would fail again
+			sent = len(batch)
+			promStats.pushDropped.WithLabelValues(b.name).Add(float64(sent))
+		}
+		b.buffer = slices.Delete(b.buffer, 0, sent)
+		if err != nil {
+			promStats.pushFailures.WithLabelValues(b.name).Inc()
+			logger.PromLog.Warnf("[%s] push failed, %d pushes buffered: %v", b.name, len(b.buffer), err)
+			break
+		}
+	}
+	promStats.pushBuffered.WithLabelValues(b.name).Set(float64(len(b.buffer)))
+}
+
+// newPushHttpClient returns an http client for the receiver, sending the
+// configured credentials
+func newPushHttpClient(endPoint *config.ServerAddr) (*http.Client, error) {
+	tlsCfg, err := tlsconfig.Client(endPoint.Tls)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsCfg
+
+	tokenClient, err := credentials.TokenClient(endPoint.Auth)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := credentials.New(endPoint.Auth, tokenClient)
+	if err != nil {
+		return nil, fmt.Errorf("auth: %w", err)
+	}
+	return &http.Client{Transport: credentials.Transport(transport, provider), Timeout: 10 * time.Second}, nil
+}
+
+func pushUrl(endPoint *config.ServerAddr, defaultPath string) string {
+	return fmt.Sprintf("%s://%s%s", tlsconfig.Scheme(endPoint),
+		net.JoinHostPort(endPoint.Addr, strconv.Itoa(endPoint.Port)), cmp.Or(endPoint.Path, defaultPath))
+}
+
+func otlpResource(external map[string]string) *resource.Resource {
+	attributes := []attribute.KeyValue{attribute.String("service.name", "metricfunc")}
+	for _, name := range slices.Sorted(maps.Keys(external)) {
+		attributes = append(attributes, attribute.String(name, external[name]))
+	}
+	return resource.NewSchemaless(attributes...)
+}
+
+// label, sample and timeSeries are the messages of the remote-write 1.0
+// protocol
+type label struct {
+	name, value string
+}
+
+type sample struct {
+	value     float64
+	timestamp int64 // milliseconds since the epoch
+}
+
+type timeSeries struct {
+	labels  []label // sorted by name
+	samples []sample
+}
+
+func externalLabels(external map[string]string) []label {
+	labels := make([]label, 0, len(external))
+	for name, value := range external {
+		labels = append(labels, label{name, value})
+	}
+	return labels
+}
+
+// remoteWriteSeries flattens the metric families into series of one sample,
+// histograms and summaries into their _bucket, quantile, _sum and _count
+// series as exposed on /metrics
+func remoteWriteSeries(families []*dto.MetricFamily, now time.Time, external []label) []timeSeries {
+	ts := now.UnixMilli()
+	var series []timeSeries
+	add := func(name string, m *dto.Metric, value float64, extra ...label) {
+		labels := []label{{"__name__", name}}
+		for _, pair := range m.GetLabel() {
+			labels = append(labels, label{pair.GetName(), pair.GetValue()})
+		}
+		labels = append(labels, extra...)
+		// the labels of the series take precedence over the external ones
+		for _, l := range external {
+			if !slices.ContainsFunc(labels, func(other label) bool { return other.name == l.name }) {
+				labels = append(labels, l)
+			}
+		}
+		slices.SortFunc(labels, func(a, b label) int { return strings.Compare(a.name, b.name) })
+		series = append(series, timeSeries{labels: labels, samples: []sample{{value, ts}}})
+	}
+
+	for _, family := range families {
+		name := family.GetName()
+		for _, m := range family.GetMetric() {
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, m, m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add(name, m, m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				add(name, m, m.GetUntyped().GetValue())
+			case dto.MetricType_SUMMARY:
+				for _, q := range m.GetSummary().GetQuantile() {
+					add(name, m, q.GetValue(), label{"quantile", formatFloat(q.GetQuantile())})
+				}
+				add(name+"_sum", m, m.GetSummary().GetSampleSum())
+				add(name+"_count", m, float64(m.GetSummary().GetSampleCount()))
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				for _, b := range h.GetBucket() {
+					add(name+"_bucket", m, float64(b.GetCumulativeCount()), label{"le", formatFloat(b.GetUpperBound())})
+				}
+				add(name+"_bucket", m, float64(h.GetSampleCount()), label{"le", "+Inf"})
+				add(name+"_sum", m, h.GetSampleSum())
+				add(name+"_count", m, float64(h.GetSampleCount()))
+			}
+		}
+	}
+	return series
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// remoteWrite sends series to a prometheus remote-write receiver
+type remoteWrite struct {
+	url    string
+	client *http.Client
+}
+
+// send writes the series of the batch in a single request, the samples of
+// the same series merged
+func (w *remoteWrite) send(ctx context.Context, batch [][]timeSeries) (int, error) {
+	var merged []timeSeries
+	index := make(map[string]int)
+	for _, series := range batch {
+		for _, s := range series {
+			var key strings.Builder
+			for _, l := range s.labels {
+				key.WriteString(l.name + "\xff" + l.value + "\xff")
+			}
+			i, ok := index[key.String()]
+			if !ok {
+				i = len(merged)
+				index[key.String()] = i
+				merged = append(merged, timeSeries{labels: s.labels})
+			}
+			merged[i].samples = append(merged[i].samples, s.samples...)
+		}
+	}
+	body := snappy.Encode(nil, encodeWriteRequest(merged))
+
+	var err error
+	for attempt := range remoteWriteAttempts {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			case <-time.After(remoteWriteBackoff << (attempt - 1)):
+			}
+		}
+		if err = w.post(ctx, body); err == nil || errors.Is(err, errRejected) {
+			break
+		}
+	}
+	if err != nil && !errors.Is(err, errRejected) {
+		return 0, err
+	}
+	return len(batch), err
+}
+
+func (w *remoteWrite) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	req.Header.Set("User-Agent", "metricfunc")
+	rsp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	message, _ := io.ReadAll(io.LimitReader(rsp.Body, 512))
+	switch {
+	case rsp.StatusCode/100 == 2:
+		return nil
+	case rsp.StatusCode == http.StatusTooManyRequests || rsp.StatusCode >= http.StatusInternalServerError:
+		return fmt.Errorf("status %d: %s", rsp.StatusCode, bytes.TrimSpace(message))
+	default:
+		return fmt.Errorf("%w, status %d: %s", errRejected, rsp.StatusCode, bytes.TrimSpace(message))
+	}
+}
+
+// encodeWriteRequest encodes the WriteRequest protobuf message of the
+// series
+func encodeWriteRequest(series []timeSeries) []byte {
+	var b, ts, msg []byte
+	for _, s := range series {
+		ts = ts[:0]
+		for _, l := range s.labels {
+			msg = protowire.AppendTag(msg[:0], 1, protowire.BytesType)
+			msg = protowire.AppendString(msg, l.name)
+			msg = protowire.AppendTag(msg, 2, protowire.BytesType)
+			msg = protowire.AppendString(msg, l.value)
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, msg)
+		}
+		for _, s := range s.samples {
+			msg = protowire.AppendTag(msg[:0], 1, protowire.Fixed64Type)
+			msg = protowire.AppendFixed64(msg, math.Float64bits(s.value))
+			msg = protowire.AppendTag(msg, 2, protowire.VarintType)
+			msg = protowire.AppendVarint(msg, uint64(s.timestamp))
+			ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, msg)
+		}
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, ts)
+	}
+	return b
+}
@@ -0,0 +1,252 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package promclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/omec-project/metricfunc/config"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// endPoint returns the receiver of the test server
+func endPoint(t *testing.T, server *httptest.Server) *config.ServerAddr {
+	t.Helper()
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := strconv.Atoi(port)
+	return &config.ServerAddr{Addr: host, Port: p}
+}
+
+// fields returns the fields of a protobuf message by number
+func fields(t *testing.T, b []byte) map[protowire.Number][][]byte {
+	t.Helper()
+	result := make(map[protowire.Number][][]byte)
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatal(protowire.ParseError(n))
+		}
+		b = b[n:]
+		var value []byte
+		switch typ {
+		case protowire.BytesType:
+			value, n = protowire.ConsumeBytes(b)
+		case protowire.Fixed64Type:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			value = b[:n]
+		case protowire.VarintType:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			value = b[:n]
+		default:
+			t.Fatalf("unexpected wire type %v", typ)
+		}
+		if n < 0 {
+			t.Fatal(protowire.ParseError(n))
+		}
+		result[num] = append(result[num], value)
+		b = b[n:]
+	}
+	return result
+}
+
+// decodeWriteRequest returns the sample values of the series by their
+// labels
+func decodeWriteRequest(t *testing.T, body []byte) map[string][]float64 {
+	t.Helper()
+	series := make(map[string][]float64)
+	for _, ts := range fields(t, body)[1] {
+		tsFields := fields(t, ts)
+		var key string
+		for _, l := range tsFields[1] {
+			lFields := fields(t, l)
+			key += string(lFields[1][0]) + "=" + string(lFields[2][0]) + ","
+		}
+		for _, s := range tsFields[2] {
+			bits, _ := protowire.ConsumeFixed64(fields(t, s)[1][0])
+			series[key] = append(series[key], math.Float64frombits(bits))
+		}
+	}
+	return series
+}
+
+func TestRemoteWrite(t *testing.T) {
+	remoteWriteBackoff = time.Millisecond
+	t.Cleanup(func() { remoteWriteBackoff = time.Second })
+
+	var (
+		lock     sync.Mutex
+		status   = http.StatusServiceUnavailable
+		attempts int
+		received map[string][]float64
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		attempts++
+		if req.URL.Path != "/api/v1/write" || req.Header.Get("Content-Encoding") != "snappy" {
+			t.Errorf("unexpected request %s with encoding [%s]", req.URL.Path, req.Header.Get("Content-Encoding"))
+		}
+		if status != http.StatusNoContent {
+			w.WriteHeader(status)
+			return
+		}
+		compressed, _ := io.ReadAll(req.Body)
+		body, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			t.Errorf("snappy: %v", err)
+		}
+		received = decodeWriteRequest(t, body)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	pusher, err := NewPusher(&config.MetricsPush{
+		ExternalLabels: map[string]string{"site": "edge1"},
+		RemoteWrite:    endPoint(t, server),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetKafkaConsumerLag("push-topic", 1)
+	t.Cleanup(func() { DeleteKafkaTopic("push-topic") })
+
+	// the receiver is down, the push is buffered after all attempts
+	pusher.push(context.Background())
+	if attempts != remoteWriteAttempts {
+		t.Errorf("attempts = %d, want %d", attempts, remoteWriteAttempts)
+	}
+
+	// back up, both pushes are sent in a single request
+	lock.Lock()
+	status, attempts = http.StatusNoContent, 0
+	lock.Unlock()
+	SetKafkaConsumerLag("push-topic", 2)
+	pusher.push(context.Background())
+	if attempts != 1 {
+		t.Errorf("attempts = %d, want 1", attempts)
+	}
+	key := "__name__=metricfunc_kafka_consumer_lag,site=edge1,topic=push-topic,"
+	if got := received[key]; len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Errorf("samples of %s = %v, want [1 2]", key, got)
+	}
+
+	// rejected pushes are dropped rather than retried
+	lock.Lock()
+	status, attempts = http.StatusBadRequest, 0
+	lock.Unlock()
+	pusher.push(context.Background())
+	if attempts != 1 {
+		t.Errorf("attempts = %d, want 1", attempts)
+	}
+	if buffered := len(pusher.receivers[0].(*pushBuffer[[]timeSeries]).buffer); buffered != 0 {
+		t.Errorf("buffered = %d after rejection, want 0", buffered)
+	}
+}
+
+func TestRemoteWriteHistogram(t *testing.T) {
+	families := []*dto.MetricFamily{{
+		Name: proto.String("latency_seconds"),
+		Type: dto.MetricType_HISTOGRAM.Enum(),
+		Metric: []*dto.Metric{{
+			Label: []*dto.LabelPair{{Name: proto.String("route"), Value: proto.String("/")}},
+			Histogram: &dto.Histogram{
+				SampleCount: proto.Uint64(3),
+				SampleSum:   proto.Float64(1.5),
+				Bucket:      []*dto.Bucket{{UpperBound: proto.Float64(0.5), CumulativeCount: proto.Uint64(2)}},
+			},
+		}},
+	}}
+	series := remoteWriteSeries(families, time.Now(), []label{{"route", "external"}, {"site", "edge1"}})
+	want := []string{
+		"__name__=latency_seconds_bucket,le=0.5,route=/,site=edge1,",
+		"__name__=latency_seconds_bucket,le=+Inf,route=/,site=edge1,",
+		"__name__=latency_seconds_sum,route=/,site=edge1,",
+		"__name__=latency_seconds_count,route=/,site=edge1,",
+	}
+	if len(series) != len(want) {
+		t.Fatalf("got %d series, want %d", len(series), len(want))
+	}
+	for i, s := range series {
+		var key string
+		for _, l := range s.labels {
+			key += l.name + "=" + l.value + ","
+		}
+		if key != want[i] {
+			t.Errorf("series %d = %s, want %s", i, key, want[i])
+		}
+	}
+}
+
+func TestPushBufferDropsOldest(t *testing.T) {
+	var sent []int
+	down := true
+	next := 0
+	b := &pushBuffer[int]{
+		name:       "test",
+		batchSize:  2,
+		bufferSize: 3,
+		collect: func([]*dto.MetricFamily, time.Time) (int, error) {
+			next++
+			return next, nil
+		},
+		send: func(_ context.Context, batch []int) (int, error) {
+			if down {
+				return 0, errors.New("down")
+			}
+			sent = append(sent, batch...)
+			return len(batch), nil
+		},
+	}
+	for range 5 {
+		b.push(context.Background(), nil, time.Now())
+	}
+	down = false
+	b.push(context.Background(), nil, time.Now())
+	if want := []int{4, 5, 6}; len(sent) != len(want) || sent[0] != 4 || sent[2] != 6 {
+		t.Errorf("sent %v, want %v", sent, want)
+	}
+}
+
+func TestOtlp(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests <- req
+		w.Header().Set("Content-Type", "application/x-protobuf")
+	}))
+	defer server.Close()
+
+	pusher, err := NewPusher(&config.MetricsPush{Otlp: endPoint(t, server)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pusher.push(context.Background())
+	select {
+	case req := <-requests:
+		if req.URL.Path != "/v1/metrics" {
+			t.Errorf("path = %s, want /v1/metrics", req.URL.Path)
+		}
+	default:
+		t.Fatal("no metrics pushed")
+	}
+	if err := pusher.Stop(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
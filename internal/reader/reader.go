@@ -7,34 +7,159 @@ package reader
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/omec-project/metricfunc/config"
+	"github.com/omec-project/metricfunc/internal/health"
 	"github.com/omec-project/metricfunc/internal/metricdata"
+	"github.com/omec-project/metricfunc/internal/privacy"
+	"github.com/omec-project/metricfunc/internal/promclient"
+	"github.com/omec-project/metricfunc/internal/subtrace"
+	"github.com/omec-project/metricfunc/internal/tracing"
 	"github.com/omec-project/metricfunc/logger"
 	"github.com/omec-project/util/metricinfo"
 	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func StartKafkaReader(cfg *config.Configuration) {
-	// Start Kafka Event Reader
-	for _, nfStream := range cfg.NfStreams {
-		r := kafka.NewReader(kafka.ReaderConfig{
-			Brokers:  makeUrlsFromUriPort(nfStream.Urls),
-			Topic:    nfStream.Topic.TopicName,
-			MaxBytes: 10e6, // 10MB
-		})
+// Readers runs a kafka reader per nf stream, following the changes of the
+// streams on configuration reloads
+type Readers struct {
+	lock    sync.Mutex
+	ctx     context.Context
+	streams []config.NFStream
+	running map[string]context.CancelFunc // stream key is key
+	// topics counts the running readers of each topic, which share the lag
+	// series of the topic
+	topics map[string]int
+	wg     sync.WaitGroup
+	errs   []error
+	// run reads a stream until ctx is done
+	run func(ctx context.Context, stream config.NFStream) error
+}
+
+func NewReaders(streams []config.NFStream) *Readers {
+	return &Readers{
+		streams: streams,
+		running: make(map[string]context.CancelFunc),
+		topics:  make(map[string]int),
+		run:     runReader,
+	}
+}
+
+// streamKey identifies a stream by its topic and brokers
+func streamKey(stream config.NFStream) string {
+	brokers := makeUrlsFromUriPort(stream.Urls)
+	slices.Sort(brokers)
+	return stream.Topic.TopicName + "@" + strings.Join(brokers, ",")
+}
+
+// Run reads the nf streams until ctx is done, then closes the readers
+func (rs *Readers) Run(ctx context.Context) error {
+	rs.lock.Lock()
+	rs.ctx = ctx
+	rs.reconcileLocked()
+	rs.lock.Unlock()
+
+	<-ctx.Done()
+	rs.wg.Wait()
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	return errors.Join(rs.errs...)
+}
 
-		go reader(r)
+// Update starts the readers of new streams and stops the readers of the
+// streams which are gone
+func (rs *Readers) Update(streams []config.NFStream) {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	rs.streams = streams
+	if rs.ctx != nil && rs.ctx.Err() == nil {
+		rs.reconcileLocked()
 	}
 }
 
+func (rs *Readers) reconcileLocked() {
+	wanted := make(map[string]config.NFStream)
+	for _, stream := range rs.streams {
+		wanted[streamKey(stream)] = stream
+	}
+	for key, cancel := range rs.running {
+		if _, ok := wanted[key]; !ok {
+			logger.AppLog.Infof("stopping kafka reader [%s]", key)
+			cancel()
+			delete(rs.running, key)
+		}
+	}
+	for key, stream := range wanted {
+		if _, ok := rs.running[key]; !ok {
+			ctx, cancel := context.WithCancel(rs.ctx)
+			rs.running[key] = cancel
+			topic := stream.Topic.TopicName
+			rs.topics[topic]++
+			rs.wg.Add(1)
+			go func() {
+				defer rs.wg.Done()
+				err := rs.run(ctx, stream)
+				rs.lock.Lock()
+				defer rs.lock.Unlock()
+				if err != nil {
+					rs.errs = append(rs.errs, err)
+				}
+				// a reader replacing this one on a reload may already be
+				// reporting the lag of the topic
+				if rs.topics[topic]--; rs.topics[topic] == 0 {
+					delete(rs.topics, topic)
+					promclient.DeleteKafkaTopic(topic)
+				}
+			}()
+		}
+	}
+}
+
+// runReader reads the stream until ctx is done, then closes the reader
+func runReader(ctx context.Context, stream config.NFStream) error {
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:  makeUrlsFromUriPort(stream.Urls),
+		Topic:    stream.Topic.TopicName,
+		MaxBytes: 10e6, // 10MB
+	})
+
+	// the brokers keep the check apart from a replacement reader of the topic
+	checkName := "kafka reader " + streamKey(stream)
+	health.AddCheck(checkName, true, func(ctx context.Context) (string, error) {
+		// fetches the last offset from the broker, which also checks the
+		// connectivity
+		lag, err := r.ReadLag(ctx)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("lag %d", lag), nil
+	})
+	defer health.Remove(checkName)
+
+	reader(ctx, r)
+	logger.AppLog.Infof("kafka reader for topic [%s] closed", r.Config().Topic)
+	if err := r.Close(); err != nil {
+		return fmt.Errorf("close kafka reader [%s]: %w", r.Config().Topic, err)
+	}
+	return nil
+}
+
 // make urls from config uri and port
 func makeUrlsFromUriPort(uriPortCfg []config.Urls) []string {
 	var urls []string
 	for _, uriPort := range uriPortCfg {
-		urls = append(urls, fmt.Sprintf("%s:%d", uriPort.Uri, uriPort.Port))
+		urls = append(urls, net.JoinHostPort(uriPort.Uri, strconv.Itoa(uriPort.Port)))
 	}
 
 	return urls
@@ -53,34 +178,84 @@ func getSourceNfType(r *kafka.Reader) metricinfo.NfType {
 	}
 }
 
-func reader(r *kafka.Reader) {
+func reader(ctx context.Context, r *kafka.Reader) {
 	logger.AppLog.Infof("kafka reader for topic [%s] initialised", r.Config().Topic)
 	sourceNf := getSourceNfType(r)
 	for {
 		// the `ReadMessage` function blocks until we receive the next event
-		msg, err := r.ReadMessage(context.Background())
+		msg, err := r.ReadMessage(ctx)
+		if ctx.Err() != nil {
+			return
+		}
 		if err != nil {
 			logger.AppLog.Errorf("error reading off kafka bus err: %v", err)
+			promclient.IncrementKafkaFailures(r.Config().Topic, "read")
 			time.Sleep(10 * time.Millisecond)
 			continue
 		}
-		logger.AppLog.Debugf("stream [%s] message %s", r.Config().Topic, string(msg.Value))
+		handleMessage(ctx, r.Config().Topic, sourceNf, msg)
+		promclient.SetKafkaConsumerLag(r.Config().Topic, r.Lag())
+	}
+}
 
-		var metricEvent metricinfo.MetricEvent
-		// Unmarshal the msg
-		if err := json.Unmarshal(msg.Value, &metricEvent); err != nil {
-			logger.AppLog.Fatalf("unmarshal metric event error %+v", err)
-		}
+// handleMessage passes the event of the message on to the subscriber cache,
+// in a span starting when the message reached kafka and continuing the
+// trace of the producer, if any
+func handleMessage(ctx context.Context, topic string, sourceNf metricinfo.NfType, msg kafka.Message) {
+	options := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "kafka"),
+			attribute.String("messaging.destination.name", topic),
+			attribute.String("messaging.destination.partition.id", strconv.Itoa(msg.Partition)),
+			attribute.Int64("messaging.kafka.offset", msg.Offset)),
+	}
+	if !msg.Time.IsZero() {
+		options = append(options, trace.WithTimestamp(msg.Time))
+	}
+	ctx, span := tracing.Tracer().Start(tracing.Extract(ctx, msg.Headers), topic+" process", options...)
+	defer span.End()
 
-		switch metricEvent.EventType {
-		case metricinfo.CSubscriberEvt:
-			metricdata.HandleSubscriberEvent(&metricEvent.SubscriberData, sourceNf)
-		case metricinfo.CMsgTypeEvt:
-			metricdata.HandleServiceEvent(&metricEvent.MsgType, sourceNf)
-		case metricinfo.CNfStatusEvt:
-			metricdata.HandleNfStatusEvent(&metricEvent.NfStatusData)
-		default:
-			logger.AppLog.Fatalf("unknown event type: %+v", metricEvent.EventType)
-		}
+	if privacy.Enabled(privacy.Logs) {
+		// the raw message carries subscriber identities
+		logger.AppLog.Debugw("stream message", "topic", topic, "bytes", len(msg.Value))
+	} else {
+		// fields rather than a formatted message, for the lines to be
+		// sampled
+		logger.AppLog.Debugw("stream message", "topic", topic, "message", string(msg.Value))
+	}
+
+	var metricEvent metricinfo.MetricEvent
+	// Unmarshal the msg
+	if err := json.Unmarshal(msg.Value, &metricEvent); err != nil {
+		// skipped, the next messages may well be valid
+		logger.AppLog.Errorf("unmarshal metric event error %+v", err)
+		promclient.IncrementKafkaFailures(topic, "decode")
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+	eventType := metricEvent.EventType.String()
+	span.SetAttributes(attribute.String("metricfunc.event.type", eventType))
+	start := time.Now()
+	defer func() {
+		promclient.ObserveEventDuration(eventType, time.Since(start))
+	}()
+
+	switch metricEvent.EventType {
+	case metricinfo.CSubscriberEvt:
+		sub := &metricEvent.SubscriberData.Subscriber
+		subtrace.Record("reader", subtrace.Ids{Imsi: sub.Imsi, IpAddr: sub.IPAddress, Guti: sub.Guti},
+			string(sourceNf)+" subscriber event", json.RawMessage(msg.Value))
+		metricdata.HandleSubscriberEvent(ctx, &metricEvent.SubscriberData, sourceNf, msg.Time)
+	case metricinfo.CMsgTypeEvt:
+		metricdata.HandleServiceEvent(ctx, &metricEvent.MsgType, sourceNf)
+	case metricinfo.CNfStatusEvt:
+		metricdata.HandleNfStatusEvent(ctx, &metricEvent.NfStatusData)
+	default:
+		logger.AppLog.Errorf("unknown event type: %+v", metricEvent.EventType)
+		promclient.IncrementKafkaFailures(topic, "unknown_event")
+		span.SetStatus(codes.Error, "unknown event type")
+		return
 	}
+	promclient.IncrementKafkaMessages(topic, eventType)
 }
@@ -0,0 +1,172 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package reader
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/omec-project/metricfunc/config"
+	"github.com/omec-project/metricfunc/internal/promclient"
+)
+
+const smfTopic = "sdcore-data-source-smf"
+
+func smfStream(broker string) config.NFStream {
+	return config.NFStream{Topic: config.Topic{TopicName: smfTopic}, Urls: []config.Urls{{Uri: broker, Port: 9092}}}
+}
+
+// startReaders runs readers whose streams are read by a stub until stopped,
+// counting the readers started per stream key
+func startReaders(t *testing.T, streams []config.NFStream) (*Readers, *sync.Map) {
+	t.Helper()
+	rs := NewReaders(streams)
+	var started sync.Map
+	rs.run = func(ctx context.Context, stream config.NFStream) error {
+		n, _ := started.LoadOrStore(streamKey(stream), new(atomic.Int32))
+		n.(*atomic.Int32).Add(1)
+		<-ctx.Done()
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- rs.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	})
+	waitFor(t, func() bool { return rs.runningReaders() == len(streams) })
+	return rs, &started
+}
+
+// waitFor polls cond until it holds
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not reached")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (rs *Readers) runningReaders() int {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	return len(rs.running)
+}
+
+func (rs *Readers) topicReaders(topic string) int {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	return rs.topics[topic]
+}
+
+func hasLag(t *testing.T, topic string) bool {
+	t.Helper()
+	families, err := promclient.Gatherer().Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != "metricfunc_kafka_consumer_lag" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "topic" && label.GetValue() == topic {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func TestReplacedReaderKeepsLag(t *testing.T) {
+	rs, _ := startReaders(t, []config.NFStream{smfStream("kafka-1")})
+	promclient.SetKafkaConsumerLag(smfTopic, 7)
+
+	// the reader of the new brokers starts before the old one stops
+	rs.Update([]config.NFStream{smfStream("kafka-2")})
+	waitFor(t, func() bool { return rs.topicReaders(smfTopic) == 1 })
+	if !hasLag(t, smfTopic) {
+		t.Fatal("lag of the topic dropped by the replaced reader")
+	}
+
+	rs.Update(nil)
+	waitFor(t, func() bool { return rs.topicReaders(smfTopic) == 0 })
+	if hasLag(t, smfTopic) {
+		t.Fatal("lag of the topic kept without a reader")
+	}
+}
+
+func (rs *Readers) runningKeys() []string {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	keys := make([]string, 0, len(rs.running))
+	for key := range rs.running {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func TestReadersUpdate(t *testing.T) {
+	smf := smfStream("kafka-1")
+	amf := config.NFStream{Topic: config.Topic{TopicName: "sdcore-data-source-amf"}, Urls: smf.Urls}
+	rs, started := startReaders(t, []config.NFStream{smf, amf})
+	waitFor(t, func() bool {
+		_, ok := started.Load(streamKey(amf))
+		return ok
+	})
+
+	// the amf stream moves to other brokers, the smf one is left alone
+	moved := amf
+	moved.Urls = []config.Urls{{Uri: "kafka-2", Port: 9092}}
+	rs.Update([]config.NFStream{smf, moved})
+	want := []string{streamKey(moved), streamKey(smf)}
+	slices.Sort(want)
+	if keys := rs.runningKeys(); !slices.Equal(keys, want) {
+		t.Fatalf("readers %v, want %v", keys, want)
+	}
+	waitFor(t, func() bool {
+		_, ok := started.Load(streamKey(moved))
+		return ok
+	})
+	if n, _ := started.Load(streamKey(smf)); n.(*atomic.Int32).Load() != 1 {
+		t.Fatalf("unchanged stream restarted, %d readers started", n.(*atomic.Int32).Load())
+	}
+
+	// the order of the brokers does not make a new stream
+	cluster := smf
+	cluster.Urls = []config.Urls{{Uri: "kafka-3", Port: 9092}, {Uri: "kafka-1", Port: 9092}}
+	reordered := smf
+	reordered.Urls = []config.Urls{cluster.Urls[1], cluster.Urls[0]}
+	if streamKey(cluster) != streamKey(reordered) {
+		t.Fatal("stream key depends on the order of the brokers")
+	}
+
+	rs.Update(nil)
+	if keys := rs.runningKeys(); len(keys) != 0 {
+		t.Fatalf("readers %v left, want none", keys)
+	}
+	waitFor(t, func() bool { return rs.topicReaders(smfTopic) == 0 })
+}
+
+func TestReadersUpdateBeforeRun(t *testing.T) {
+	rs := NewReaders([]config.NFStream{smfStream("kafka-1")})
+	rs.Update([]config.NFStream{smfStream("kafka-2")})
+	if len(rs.runningKeys()) != 0 || len(rs.streams) != 1 || rs.streams[0].Urls[0].Uri != "kafka-2" {
+		t.Fatalf("readers %v with streams %+v, want the new stream kept for Run", rs.runningKeys(), rs.streams)
+	}
+}
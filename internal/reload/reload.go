@@ -0,0 +1,188 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package reload applies the changes of the configuration file while
+// metricfunc runs
+package reload
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/omec-project/metricfunc/config"
+	"github.com/omec-project/metricfunc/logger"
+)
+
+// pollInterval is how often the configuration file is checked for changes,
+// kubernetes updates mounted config maps by swapping a symlink which file
+// notifications on the file itself miss
+var pollInterval = 5 * time.Second
+
+// Applier prepares the changes between old and new and returns the function
+// applying them. Appliers fail before applying anything.
+type Applier func(old, new *config.Config) (apply func(), err error)
+
+type applier struct {
+	name  string
+	paths []string
+	apply Applier
+}
+
+// Reloader loads the configuration file again when it changes or on SIGHUP.
+// A new configuration is applied only when it is valid and all appliers of
+// its changes succeed.
+type Reloader struct {
+	path string
+	load func(path string) (*config.Config, error)
+
+	lock sync.Mutex
+	// current holds the values in effect, those of the file for the paths
+	// applied and those loaded at startup for the others
+	current  *config.Config
+	digest   [sha256.Size]byte
+	appliers []applier
+}
+
+// New watches the configuration file at path, cfg is the configuration
+// loaded from it at startup
+func New(path string, cfg *config.Config, load func(path string) (*config.Config, error)) *Reloader {
+	r := &Reloader{path: path, load: load, current: cfg}
+	if content, err := os.ReadFile(path); err == nil {
+		r.digest = sha256.Sum256(content)
+	}
+	return r
+}
+
+// Register adds an applier of the changes at or below paths
+func (r *Reloader) Register(name string, paths []string, apply Applier) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.appliers = append(r.appliers, applier{name: name, paths: paths, apply: apply})
+}
+
+// Current returns the configuration in effect
+func (r *Reloader) Current() *config.Config {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.current
+}
+
+// Reload loads the configuration file and applies its changes
+func (r *Reloader) Reload() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if content, err := os.ReadFile(r.path); err == nil {
+		r.digest = sha256.Sum256(content)
+	}
+	cfg, err := r.load(r.path)
+	if err != nil {
+		return fmt.Errorf("configuration rejected:\n%w", err)
+	}
+	changes, err := config.Diff(r.current, cfg)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		logger.AppLog.Infoln("configuration unchanged")
+		return nil
+	}
+
+	var applies []func()
+	var paths []string
+	var errs []error
+	handled := make([]bool, len(changes))
+	for _, a := range r.appliers {
+		if !a.covers(changes, handled) {
+			continue
+		}
+		apply, err := a.apply(r.current, cfg)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", a.name, err))
+			continue
+		}
+		applies = append(applies, apply)
+		paths = append(paths, a.paths...)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("configuration rejected:\n%w", errors.Join(errs...))
+	}
+	current, err := config.Merge(r.current, cfg, paths)
+	if err != nil {
+		return err
+	}
+
+	for _, apply := range applies {
+		apply()
+	}
+	r.current = current
+	for i, change := range changes {
+		if handled[i] {
+			logger.AppLog.Infof("configuration applied %v", change)
+		} else {
+			logger.AppLog.Warnf("configuration changed %v, takes effect after a restart", change)
+		}
+	}
+	return nil
+}
+
+// covers reports whether the applier handles one of the changes, marking
+// the ones it handles
+func (a *applier) covers(changes []config.Change, handled []bool) bool {
+	covered := false
+	for i, change := range changes {
+		for _, path := range a.paths {
+			if change.Under(path) {
+				handled[i] = true
+				covered = true
+			}
+		}
+	}
+	return covered
+}
+
+func (r *Reloader) changed() bool {
+	content, err := os.ReadFile(r.path)
+	if err != nil {
+		logger.AppLog.Warnf("read configuration file [%s] error: %v", r.path, err)
+		return false
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return sha256.Sum256(content) != r.digest
+}
+
+// Run reloads the configuration when the file changes or on SIGHUP until
+// ctx is done
+func (r *Reloader) Run(ctx context.Context) error {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-hangup:
+			logger.AppLog.Infof("SIGHUP received, reloading configuration file [%s]", r.path)
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			logger.AppLog.Infof("configuration file [%s] changed, reloading", r.path)
+		}
+		if err := r.Reload(); err != nil {
+			logger.AppLog.Errorf("%v", err)
+		}
+	}
+}
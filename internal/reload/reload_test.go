@@ -0,0 +1,148 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package reload
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/omec-project/metricfunc/config"
+)
+
+const baseConfig = `
+logger:
+  level: info
+configuration:
+  apiServer:
+    port: 9301
+  prometheusServer:
+    port: 9089
+`
+
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newReloader(t *testing.T) (*Reloader, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, baseConfig)
+	load := func(path string) (*config.Config, error) { return config.Load(path, config.Overrides{}) }
+	cfg, err := load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(path, cfg, load), path
+}
+
+func TestReloadApplies(t *testing.T) {
+	r, path := newReloader(t)
+	var level string
+	r.Register("logger", []string{"logger.level"}, func(_, new *config.Config) (func(), error) {
+		return func() { level = new.Logger.LogLevel }, nil
+	})
+
+	if r.changed() {
+		t.Fatal("unchanged file reported as changed")
+	}
+	writeConfig(t, path, strings.Replace(baseConfig, "level: info", "level: debug", 1))
+	if !r.changed() {
+		t.Fatal("changed file not detected")
+	}
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if level != "debug" || r.Current().Logger.LogLevel != "debug" {
+		t.Fatalf("level not applied: %q", level)
+	}
+	if r.changed() {
+		t.Fatal("reloaded file still reported as changed")
+	}
+}
+
+func TestReloadRejectsInvalid(t *testing.T) {
+	r, path := newReloader(t)
+	applied := false
+	r.Register("logger", []string{"logger.level"}, func(_, new *config.Config) (func(), error) {
+		return func() { applied = true }, nil
+	})
+
+	writeConfig(t, path, strings.Replace(baseConfig, "level: info", "level: loud", 1))
+	if err := r.Reload(); err == nil || !strings.Contains(err.Error(), "logger.level") {
+		t.Fatalf("expected invalid level to be rejected, got %v", err)
+	}
+	if applied || r.Current().Logger.LogLevel != "info" {
+		t.Fatal("invalid configuration applied")
+	}
+}
+
+func TestReloadAtomic(t *testing.T) {
+	r, path := newReloader(t)
+	applied := false
+	r.Register("logger", []string{"logger.level"}, func(_, new *config.Config) (func(), error) {
+		return func() { applied = true }, nil
+	})
+	r.Register("kafka readers", []string{"configuration.nfStreams"}, func(_, new *config.Config) (func(), error) {
+		return nil, errors.New("broken")
+	})
+
+	writeConfig(t, path, strings.Replace(baseConfig, "level: info", "level: debug", 1)+`
+  nfStreams:
+    - topic:
+        topicName: sdcore-data-source-amf
+      urls:
+        - uri: kafka
+          port: 9092
+`)
+	if err := r.Reload(); err == nil || !strings.Contains(err.Error(), "kafka readers: broken") {
+		t.Fatalf("expected the failing applier to reject the reload, got %v", err)
+	}
+	if applied || r.Current().Logger.LogLevel != "info" {
+		t.Fatal("configuration partially applied")
+	}
+}
+
+func TestReloadRestartRequired(t *testing.T) {
+	r, path := newReloader(t)
+	r.Register("logger", []string{"logger.level"}, func(_, new *config.Config) (func(), error) {
+		return func() {}, nil
+	})
+	startup := r.Current()
+	writeConfig(t, path, strings.Replace(strings.Replace(baseConfig, "port: 9301", "port: 9302", 1),
+		"level: info", "level: debug", 1))
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	// the port only changes on restart, the running one is kept
+	if current := r.Current(); current.Configuration.ApiServer.Port != 9301 || current.Logger.LogLevel != "debug" {
+		t.Fatalf("configuration in effect %+v %+v, want the level applied only",
+			current.Configuration.ApiServer, current.Logger)
+	}
+	if startup.Logger.LogLevel != "info" {
+		t.Fatal("startup configuration changed")
+	}
+
+	// reverting the port leaves the configuration in effect unchanged
+	writeConfig(t, path, strings.Replace(baseConfig, "level: info", "level: debug", 1))
+	changes, err := config.Diff(r.Current(), loadFile(t, path))
+	if err != nil || len(changes) != 0 {
+		t.Fatalf("changes %v (%v), want none", changes, err)
+	}
+}
+
+func loadFile(t *testing.T, path string) *config.Config {
+	t.Helper()
+	cfg, err := config.Load(path, config.Overrides{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
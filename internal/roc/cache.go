@@ -0,0 +1,181 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package roc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omec-project/metricfunc/internal/privacy"
+	"github.com/omec-project/metricfunc/logger"
+)
+
+// minMissRefreshInterval rate limits the refreshes triggered by lookups of
+// imsis which are not known to ROC
+const minMissRefreshInterval = 5 * time.Second
+
+// SimCardCache keeps the imsi to sim card location mapping of all
+// enterprises known to ROC
+type SimCardCache struct {
+	client      *Client
+	ttl         time.Duration
+	lock        sync.RWMutex
+	entries     map[string]SimCardLocation // imsi is key
+	updated     time.Time
+	refreshLock sync.Mutex
+}
+
+func NewSimCardCache(client *Client, ttl time.Duration) *SimCardCache {
+	return &SimCardCache{
+		client:  client,
+		ttl:     ttl,
+		entries: make(map[string]SimCardLocation),
+	}
+}
+
+func normaliseImsi(imsi string) string {
+	return strings.TrimPrefix(imsi, "imsi-")
+}
+
+// Refresh rebuilds the cache from ROC. Entries of enterprises which could
+// not be read are kept from the previous refresh.
+func (c *SimCardCache) Refresh(ctx context.Context) error {
+	c.refreshLock.Lock()
+	defer c.refreshLock.Unlock()
+	return c.refresh(ctx)
+}
+
+func (c *SimCardCache) refresh(ctx context.Context) error {
+	targets, err := c.client.GetTargets(ctx)
+	if err != nil {
+		return fmt.Errorf("get targets: %w", err)
+	}
+
+	entries := make(map[string]SimCardLocation)
+	failed := make(map[string]bool)
+	var errs []error
+	for _, target := range targets {
+		sites, err := c.client.GetSites(ctx, target.Name)
+		if err != nil {
+			failed[target.Name] = true
+			errs = append(errs, fmt.Errorf("get sites of [%s]: %w", target.Name, err))
+			continue
+		}
+		for _, site := range sites {
+			for _, simCard := range site.SimCard {
+				if simCard.Imsi == "" {
+					continue
+				}
+				entries[normaliseImsi(simCard.Imsi)] = SimCardLocation{
+					Enterprise: target.Name,
+					SiteId:     site.SiteId,
+					SimId:      simCard.SimId,
+				}
+			}
+		}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for imsi, loc := range c.entries {
+		if _, ok := entries[imsi]; !ok && failed[loc.Enterprise] {
+			entries[imsi] = loc
+		}
+	}
+	c.entries = entries
+	c.updated = time.Now()
+	logger.ControllerLog.Debugf("roc sim card cache refreshed with [%d] entries", len(entries))
+
+	return errors.Join(errs...)
+}
+
+func (c *SimCardCache) get(imsi string) (SimCardLocation, bool, time.Time) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	loc, ok := c.entries[imsi]
+	return loc, ok, c.updated
+}
+
+// Lookup returns the sim card location of the imsi, refreshing the cache
+// first when it is stale or does not know the imsi
+func (c *SimCardCache) Lookup(ctx context.Context, imsi string) (SimCardLocation, error) {
+	imsi = normaliseImsi(imsi)
+	loc, ok, updated := c.get(imsi)
+	if ok && time.Since(updated) < c.ttl {
+		return loc, nil
+	}
+	if !ok && time.Since(updated) < minMissRefreshInterval {
+		return SimCardLocation{}, fmt.Errorf("imsi [%s] not found in roc", privacy.Imsi(privacy.Logs, imsi))
+	}
+
+	c.refreshLock.Lock()
+	// another caller may have refreshed while we were waiting
+	if _, _, latest := c.get(imsi); !latest.After(updated) {
+		if err := c.refresh(ctx); err != nil {
+			logger.ControllerLog.Warnf("roc sim card cache refresh error: %v", err)
+		}
+	}
+	c.refreshLock.Unlock()
+
+	if loc, ok, _ := c.get(imsi); ok {
+		return loc, nil
+	}
+	return SimCardLocation{}, fmt.Errorf("imsi [%s] not found in roc", privacy.Imsi(privacy.Logs, imsi))
+}
+
+// Seed takes the entries and refresh time of another cache, such as the
+// one replaced on a configuration reload, until the next refresh
+func (c *SimCardCache) Seed(from *SimCardCache) {
+	from.lock.RLock()
+	entries, updated := maps.Clone(from.entries), from.updated
+	from.lock.RUnlock()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.entries = entries
+	c.updated = updated
+}
+
+// Invalidate drops the imsi so that the next lookup reads it from ROC again
+func (c *SimCardCache) Invalidate(imsi string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.entries, normaliseImsi(imsi))
+}
+
+// Updated returns the time of the last refresh, zero until the cache is
+// loaded
+func (c *SimCardCache) Updated() time.Time {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.updated
+}
+
+func (c *SimCardCache) Len() int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return len(c.entries)
+}
+
+// Run refreshes the cache every ttl until the context is cancelled
+func (c *SimCardCache) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.ttl)
+	defer ticker.Stop()
+	for {
+		if err := c.Refresh(ctx); err != nil {
+			logger.ControllerLog.Warnf("roc sim card cache refresh error: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package roc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/omec-project/metricfunc/logger"
+)
+
+const apiPrefix = "/aether-roc-api"
+
+// Doer sends http requests, as implemented by http.Client
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Client is a typed client for the aether-roc-api REST interface
+type Client struct {
+	baseUrl    string
+	httpClient Doer
+}
+
+func NewClient(baseUrl string, httpClient Doer) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		baseUrl:    strings.TrimSuffix(baseUrl, "/"),
+		httpClient: httpClient,
+	}
+}
+
+func (c *Client) BaseUrl() string {
+	return c.baseUrl
+}
+
+func (c *Client) modelUrl(target string, elem ...string) string {
+	u := c.baseUrl + apiPrefix + "/aether/" + ModelVersion + "/" + url.PathEscape(target)
+	for _, e := range elem {
+		u += "/" + url.PathEscape(e)
+	}
+	return u
+}
+
+func (c *Client) do(ctx context.Context, method, reqUrl string, body, out any) error {
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("marshal request body: %w", err)
+		}
+		reqBody = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, reqUrl, reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	}
+	req.Header.Set("Accept", "application/json")
+
+	logger.ControllerLog.Debugf("roc request [%s %s]", method, reqUrl)
+	rsp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := rsp.Body.Close(); err != nil {
+			logger.ControllerLog.Warnf("body close error: %v", err)
+		}
+	}()
+
+	if rsp.StatusCode < http.StatusOK || rsp.StatusCode >= http.StatusMultipleChoices {
+		msg, _ := io.ReadAll(io.LimitReader(rsp.Body, 512))
+		return &StatusError{Method: method, Url: reqUrl, StatusCode: rsp.StatusCode, Message: string(msg)}
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(rsp.Body).Decode(out); err != nil && err != io.EOF {
+		return fmt.Errorf("decode response of [%s %s]: %w", method, reqUrl, err)
+	}
+	return nil
+}
+
+// StatusError is returned when aether-roc-api answers with a non 2xx status
+type StatusError struct {
+	Method     string
+	Url        string
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("roc [%s %s] returned [%d %s] %s",
+		e.Method, e.Url, e.StatusCode, http.StatusText(e.StatusCode), strings.TrimSpace(e.Message))
+}
+
+func (c *Client) GetTargets(ctx context.Context) ([]Target, error) {
+	var targets []Target
+	err := c.do(ctx, http.MethodGet, c.baseUrl+apiPrefix+"/targets", nil, &targets)
+	return targets, err
+}
+
+func (c *Client) GetSites(ctx context.Context, target string) ([]Site, error) {
+	var sites []Site
+	err := c.do(ctx, http.MethodGet, c.modelUrl(target, "site"), nil, &sites)
+	return sites, err
+}
+
+func (c *Client) GetSite(ctx context.Context, target, siteId string) (*Site, error) {
+	var site Site
+	if err := c.do(ctx, http.MethodGet, c.modelUrl(target, "site", siteId), nil, &site); err != nil {
+		return nil, err
+	}
+	return &site, nil
+}
+
+func (c *Client) GetSimCards(ctx context.Context, target, siteId string) ([]SimCard, error) {
+	var simCards []SimCard
+	err := c.do(ctx, http.MethodGet, c.modelUrl(target, "site", siteId, "sim-card"), nil, &simCards)
+	return simCards, err
+}
+
+func (c *Client) GetSimCard(ctx context.Context, target, siteId, simId string) (*SimCard, error) {
+	var simCard SimCard
+	if err := c.do(ctx, http.MethodGet, c.modelUrl(target, "site", siteId, "sim-card", simId), nil, &simCard); err != nil {
+		return nil, err
+	}
+	return &simCard, nil
+}
+
+func (c *Client) GetDevices(ctx context.Context, target, siteId string) ([]Device, error) {
+	var devices []Device
+	err := c.do(ctx, http.MethodGet, c.modelUrl(target, "site", siteId, "device"), nil, &devices)
+	return devices, err
+}
+
+func (c *Client) GetDeviceGroups(ctx context.Context, target, siteId string) ([]DeviceGroup, error) {
+	var deviceGroups []DeviceGroup
+	err := c.do(ctx, http.MethodGet, c.modelUrl(target, "site", siteId, "device-group"), nil, &deviceGroups)
+	return deviceGroups, err
+}
+
+// Patch applies the given updates to the site tree of the target in a
+// single transaction
+func (c *Client) Patch(ctx context.Context, target string, sites []Site) error {
+	body := patchBody{
+		DefaultTarget: target,
+		Updates: map[string]any{
+			"site-2.1.0": sites,
+		},
+		Extensions: map[string]string{
+			"model-type-20":    "Aether",
+			"model-version-21": "2.1.0",
+		},
+	}
+	return c.do(ctx, http.MethodPatch, c.baseUrl+apiPrefix, body, nil)
+}
+
+// SetSimCardEnable enables or disables the sim card at the given location
+func (c *Client) SetSimCardEnable(ctx context.Context, loc SimCardLocation, enable bool) error {
+	site := Site{
+		SiteId: loc.SiteId,
+		SimCard: []SimCard{
+			{
+				SimId:  loc.SimId,
+				Enable: &enable,
+			},
+		},
+	}
+	return c.Patch(ctx, loc.Enterprise, []Site{site})
+}
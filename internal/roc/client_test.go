@@ -0,0 +1,136 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package roc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newRocStub(t *testing.T, patches chan<- patchBody) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var siteReads atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /aether-roc-api/targets", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]Target{{Name: "acme"}})
+	})
+	mux.HandleFunc("GET /aether-roc-api/aether/v2.1.x/acme/site", func(w http.ResponseWriter, r *http.Request) {
+		siteReads.Add(1)
+		_ = json.NewEncoder(w).Encode([]Site{
+			{
+				SiteId:  "acme-chicago",
+				SimCard: []SimCard{{SimId: "sim-1", Imsi: "208930000000001"}},
+			},
+		})
+	})
+	mux.HandleFunc("PATCH /aether-roc-api", func(w http.ResponseWriter, r *http.Request) {
+		var body patchBody
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		patches <- body
+		w.WriteHeader(http.StatusOK)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &siteReads
+}
+
+func TestSimCardCacheLookup(t *testing.T) {
+	server, siteReads := newRocStub(t, nil)
+	cache := NewSimCardCache(NewClient(server.URL, server.Client()), time.Minute)
+
+	loc, err := cache.Lookup(context.Background(), "imsi-208930000000001")
+	if err != nil {
+		t.Fatalf("lookup failed: %v", err)
+	}
+	want := SimCardLocation{Enterprise: "acme", SiteId: "acme-chicago", SimId: "sim-1"}
+	if loc != want {
+		t.Fatalf("unexpected location: got %+v want %+v", loc, want)
+	}
+
+	// a second lookup is served from the cache
+	if _, err := cache.Lookup(context.Background(), "208930000000001"); err != nil {
+		t.Fatalf("cached lookup failed: %v", err)
+	}
+	// an unknown imsi right after a refresh does not hit ROC again
+	if _, err := cache.Lookup(context.Background(), "208930000000002"); err == nil {
+		t.Fatal("expected lookup of unknown imsi to fail")
+	}
+	if n := siteReads.Load(); n != 1 {
+		t.Fatalf("unexpected number of site reads: got %d want 1", n)
+	}
+}
+
+func TestSimCardCacheSeed(t *testing.T) {
+	server, siteReads := newRocStub(t, nil)
+	previous := NewSimCardCache(NewClient(server.URL, server.Client()), time.Minute)
+	if err := previous.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := NewSimCardCache(NewClient(server.URL, server.Client()), time.Minute)
+	cache.Seed(previous)
+	if cache.Updated() != previous.Updated() || cache.Len() != 1 {
+		t.Fatalf("seeded cache updated %v with %d entries, want those of the previous one",
+			cache.Updated(), cache.Len())
+	}
+	if _, err := cache.Lookup(context.Background(), "208930000000001"); err != nil {
+		t.Fatalf("seeded lookup failed: %v", err)
+	}
+	if n := siteReads.Load(); n != 1 {
+		t.Fatalf("unexpected number of site reads: got %d want 1", n)
+	}
+}
+
+func TestSetSimCardEnable(t *testing.T) {
+	patches := make(chan patchBody, 1)
+	server, _ := newRocStub(t, patches)
+	client := NewClient(server.URL, server.Client())
+
+	loc := SimCardLocation{Enterprise: "acme", SiteId: "acme-chicago", SimId: "sim-1"}
+	if err := client.SetSimCardEnable(context.Background(), loc, false); err != nil {
+		t.Fatalf("patch failed: %v", err)
+	}
+
+	body := <-patches
+	if body.DefaultTarget != "acme" {
+		t.Fatalf("unexpected target: got %q", body.DefaultTarget)
+	}
+	b, err := json.Marshal(body.Updates["site-2.1.0"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sites []Site
+	if err := json.Unmarshal(b, &sites); err != nil {
+		t.Fatal(err)
+	}
+	if len(sites) != 1 || sites[0].SiteId != "acme-chicago" || len(sites[0].SimCard) != 1 {
+		t.Fatalf("unexpected updates: %s", b)
+	}
+	if simCard := sites[0].SimCard[0]; simCard.SimId != "sim-1" || simCard.Enable == nil || *simCard.Enable {
+		t.Fatalf("unexpected sim card update: %s", b)
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	_, err := NewClient(server.URL, server.Client()).GetTargets(context.Background())
+	statusErr, ok := err.(*StatusError)
+	if !ok {
+		t.Fatalf("expected StatusError, got %v", err)
+	}
+	if statusErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("unexpected status: got %d", statusErr.StatusCode)
+	}
+}
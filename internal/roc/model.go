@@ -0,0 +1,83 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package roc
+
+// ModelVersion is the aether model version served by aether-roc-api
+const ModelVersion = "v2.1.x"
+
+// Target is an enterprise as listed by the aether-roc-api targets endpoint
+type Target struct {
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+type SimCard struct {
+	SimId       string `json:"sim-id,omitempty"`
+	DisplayName string `json:"display-name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Imsi        string `json:"imsi,omitempty"`
+	Iccid       string `json:"iccid,omitempty"`
+	Enable      *bool  `json:"enable,omitempty"`
+}
+
+type Device struct {
+	DeviceId    string `json:"device-id,omitempty"`
+	DisplayName string `json:"display-name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Imei        string `json:"imei,omitempty"`
+	SimCard     string `json:"sim-card,omitempty"`
+}
+
+type DeviceGroupDevice struct {
+	DeviceId string `json:"device-id,omitempty"`
+	Enable   *bool  `json:"enable,omitempty"`
+}
+
+type DeviceGroupMbr struct {
+	Downlink int64 `json:"downlink,omitempty"`
+	Uplink   int64 `json:"uplink,omitempty"`
+}
+
+type DeviceGroup struct {
+	DeviceGroupId string              `json:"device-group-id,omitempty"`
+	DisplayName   string              `json:"display-name,omitempty"`
+	Description   string              `json:"description,omitempty"`
+	IpDomain      string              `json:"ip-domain,omitempty"`
+	Mbr           *DeviceGroupMbr     `json:"mbr,omitempty"`
+	TrafficClass  string              `json:"traffic-class,omitempty"`
+	Device        []DeviceGroupDevice `json:"device,omitempty"`
+}
+
+type ImsiDefinition struct {
+	Mcc        string `json:"mcc,omitempty"`
+	Mnc        string `json:"mnc,omitempty"`
+	Enterprise int64  `json:"enterprise,omitempty"`
+	Format     string `json:"format,omitempty"`
+}
+
+type Site struct {
+	SiteId         string          `json:"site-id,omitempty"`
+	DisplayName    string          `json:"display-name,omitempty"`
+	Description    string          `json:"description,omitempty"`
+	ImsiDefinition *ImsiDefinition `json:"imsi-definition,omitempty"`
+	SimCard        []SimCard       `json:"sim-card,omitempty"`
+	Device         []Device        `json:"device,omitempty"`
+	DeviceGroup    []DeviceGroup   `json:"device-group,omitempty"`
+}
+
+// SimCardLocation identifies where a sim card lives in the ROC model tree
+type SimCardLocation struct {
+	Enterprise string `json:"enterprise"`
+	SiteId     string `json:"site-id"`
+	SimId      string `json:"sim-id"`
+}
+
+// patchBody is the body accepted by the aether-roc-api PATCH endpoint
+type patchBody struct {
+	DefaultTarget string            `json:"default-target"`
+	Updates       map[string]any    `json:"Updates,omitempty"`
+	Deletes       map[string]any    `json:"Deletes,omitempty"`
+	Extensions    map[string]string `json:"Extensions,omitempty"`
+}
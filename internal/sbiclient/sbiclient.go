@@ -0,0 +1,56 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package sbiclient builds the HTTP/2 clients of the 5G service based
+// interfaces metricfunc calls, such as the NRF and the SBI of the nfs
+package sbiclient
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/omec-project/metricfunc/config"
+	"github.com/omec-project/metricfunc/internal/credentials"
+	"github.com/omec-project/metricfunc/internal/tlsconfig"
+	"golang.org/x/net/http2"
+)
+
+// New returns an HTTP/2 client of the endpoint, over TLS when its scheme
+// is https and cleartext with prior knowledge otherwise, sending the
+// configured credentials
+func New(endPoint *config.ServerAddr, timeout time.Duration) (*http.Client, error) {
+	tlsCfg, err := tlsconfig.Client(endPoint.Tls)
+	if err != nil {
+		return nil, err
+	}
+	transport := &http2.Transport{TLSClientConfig: tlsCfg}
+	if tlsconfig.Scheme(endPoint) != "https" {
+		transport.AllowHTTP = true
+		transport.DialTLSContext = func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		}
+	}
+
+	// the token endpoint is not reached over the h2c dialer of the nf
+	tokenClient, err := credentials.TokenClient(endPoint.Auth)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := credentials.New(endPoint.Auth, tokenClient)
+	if err != nil {
+		return nil, fmt.Errorf("auth: %w", err)
+	}
+	return &http.Client{Transport: credentials.Transport(transport, provider), Timeout: timeout}, nil
+}
+
+// BaseUrl returns the url of the endpoint without its path
+func BaseUrl(endPoint *config.ServerAddr) string {
+	return tlsconfig.Scheme(endPoint) + "://" + net.JoinHostPort(endPoint.Addr, strconv.Itoa(endPoint.Port))
+}
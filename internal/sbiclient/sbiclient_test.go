@@ -0,0 +1,63 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package sbiclient
+
+import (
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/omec-project/metricfunc/config"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func TestOAuth2OverCleartextNf(t *testing.T) {
+	tokenServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"nrf-token","token_type":"Bearer","expires_in":300}`))
+	}))
+	defer tokenServer.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tokenServer.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	nf := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.ProtoMajor != 2 || req.Header.Get("Authorization") != "Bearer nrf-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}), &http2.Server{}))
+	defer nf.Close()
+	host, port, _ := net.SplitHostPort(nf.Listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+
+	t.Setenv("METRICFUNC_TEST_CLIENT_SECRET", "s3cret")
+	endPoint := &config.ServerAddr{Addr: host, Port: p, Auth: &config.Auth{
+		Type:         "oauth2",
+		TokenUrl:     tokenServer.URL,
+		ClientId:     "metricfunc",
+		ClientSecret: &config.Secret{Env: "METRICFUNC_TEST_CLIENT_SECRET"},
+		Tls:          &config.TLS{CaFile: caFile},
+	}}
+	client, err := New(endPoint, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp, err := client.Get(BaseUrl(endPoint) + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		t.Errorf("status %d, want the token of the https endpoint sent over h2c", rsp.StatusCode)
+	}
+}
@@ -0,0 +1,313 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package subtrace traces selected subscribers: the reader, the subscriber
+// cache and the controller log the details of their events and keep them,
+// for the subscribers on the trace list only
+package subtrace
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/omec-project/metricfunc/internal/privacy"
+	"github.com/omec-project/metricfunc/logger"
+)
+
+type Kind string
+
+const (
+	KindImsi Kind = "imsi"
+	KindIp   Kind = "ip"
+	KindGuti Kind = "guti"
+)
+
+const (
+	// DefaultDuration is how long a subscriber is traced unless told
+	DefaultDuration = time.Hour
+	// MaxDuration bounds the tracing of a subscriber
+	MaxDuration = 24 * time.Hour
+	// maxEvents are kept per subscriber, the oldest dropped first
+	maxEvents = 1000
+	// maxBundles are kept, the one updated last the longest ago dropped
+	// first
+	maxBundles = 100
+)
+
+// Target is an entry of the trace list
+type Target struct {
+	Kind    Kind      `json:"kind"`
+	Value   string    `json:"value"`
+	Expires time.Time `json:"expires"`
+	AddedBy string    `json:"added-by,omitempty"`
+}
+
+// Ids identify the subscriber of an event, any of them may be empty
+type Ids struct {
+	Imsi   string
+	IpAddr string
+	Guti   string
+	// PrevIpAddr is the ip address the subscriber held before the event
+	PrevIpAddr string
+}
+
+// Event is a traced event of a subscriber
+type Event struct {
+	Time    time.Time `json:"time"`
+	Source  string    `json:"source"`
+	Message string    `json:"message"`
+	Imsi    string    `json:"imsi,omitempty"`
+	IpAddr  string    `json:"ip-addr,omitempty"`
+	Guti    string    `json:"guti,omitempty"`
+	// PrevIpAddr is the ip address the subscriber held before the event
+	PrevIpAddr string `json:"prev-ip-addr,omitempty"`
+	// Details are the raw kafka event or the subscriber state
+	Details any `json:"details,omitempty"`
+}
+
+// Bundle holds the traced events of a subscriber
+type Bundle struct {
+	Imsi    string    `json:"imsi"`
+	Updated time.Time `json:"updated"`
+	Events  []Event   `json:"events"`
+}
+
+var ErrNotTraced = errors.New("subscriber not traced")
+
+type targetKey struct {
+	kind  Kind
+	value string
+}
+
+var (
+	lock    sync.RWMutex
+	targets = map[targetKey]Target{}
+	// bundles are keyed by the imsi without the imsi- prefix
+	bundles = map[string]*Bundle{}
+	// tracing is set while the trace list is not empty, sparing the
+	// lookups of every event otherwise
+	tracing atomic.Bool
+)
+
+func normalize(kind Kind, value string) string {
+	switch kind {
+	case KindImsi:
+		return strings.TrimPrefix(value, "imsi-")
+	case KindIp:
+		if ip := net.ParseIP(value); ip != nil {
+			return ip.String()
+		}
+	}
+	return value
+}
+
+// Add traces the subscriber of the target until it expires, replacing the
+// target of the same subscriber
+func Add(t Target) (Target, error) {
+	if !slices.Contains([]Kind{KindImsi, KindIp, KindGuti}, t.Kind) {
+		return t, fmt.Errorf("kind [%s] is not one of imsi, ip or guti", t.Kind)
+	}
+	if t.Kind == KindIp && net.ParseIP(t.Value) == nil {
+		return t, fmt.Errorf("[%s] is not an ip address", t.Value)
+	}
+	t.Value = normalize(t.Kind, t.Value)
+	if t.Value == "" {
+		return t, errors.New("value required")
+	}
+	now := time.Now()
+	if t.Expires.IsZero() {
+		t.Expires = now.Add(DefaultDuration)
+	}
+	if !t.Expires.After(now) || t.Expires.Sub(now) > MaxDuration {
+		return t, fmt.Errorf("expiry must be within %v", MaxDuration)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	targets[targetKey{t.Kind, t.Value}] = t
+	tracing.Store(true)
+	logger.TraceLog.Infof("tracing %s [%s] until %v, added by [%s]",
+		t.Kind, maskTarget(privacy.Logs, t).Value, t.Expires.Format(time.RFC3339), t.AddedBy)
+	return t, nil
+}
+
+// Remove stops tracing the subscriber of the target, the events traced so
+// far are kept
+func Remove(kind Kind, value string) error {
+	lock.Lock()
+	defer lock.Unlock()
+	key := targetKey{kind, normalize(kind, value)}
+	if _, ok := targets[key]; !ok {
+		return ErrNotTraced
+	}
+	delete(targets, key)
+	tracing.Store(len(targets) > 0)
+	return nil
+}
+
+// List returns the targets not expired yet
+func List() []Target {
+	lock.Lock()
+	defer lock.Unlock()
+	now := time.Now()
+	list := make([]Target, 0, len(targets))
+	for key, t := range targets {
+		if !t.Expires.After(now) {
+			delete(targets, key)
+			continue
+		}
+		list = append(list, t)
+	}
+	tracing.Store(len(targets) > 0)
+	slices.SortFunc(list, func(a, b Target) int {
+		return cmp.Or(cmp.Compare(a.Kind, b.Kind), cmp.Compare(a.Value, b.Value))
+	})
+	return list
+}
+
+// Traced reports whether one of the ids is on the trace list
+func Traced(ids Ids) bool {
+	if !tracing.Load() {
+		return false
+	}
+	lock.RLock()
+	defer lock.RUnlock()
+	now := time.Now()
+	for _, key := range []targetKey{
+		{KindImsi, normalize(KindImsi, ids.Imsi)},
+		{KindIp, normalize(KindIp, ids.IpAddr)},
+		{KindIp, normalize(KindIp, ids.PrevIpAddr)},
+		{KindGuti, ids.Guti},
+	} {
+		if t, ok := targets[key]; ok && key.value != "" && t.Expires.After(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Record logs the event and adds it to the bundle of its imsi when the
+// subscriber is traced. Events without an imsi are logged only.
+func Record(source string, ids Ids, message string, details any) {
+	if !Traced(ids) {
+		return
+	}
+	event := Event{
+		Time: time.Now(), Source: source, Message: message,
+		Imsi: ids.Imsi, IpAddr: ids.IpAddr, Guti: ids.Guti, PrevIpAddr: ids.PrevIpAddr, Details: details,
+	}
+	fields := []any{
+		"source", source,
+		"imsi", privacy.Imsi(privacy.Logs, ids.Imsi),
+		"ip-addr", privacy.IpAddr(privacy.Logs, ids.IpAddr),
+		"guti", privacy.Guti(privacy.Logs, ids.Guti),
+	}
+	if ids.PrevIpAddr != "" {
+		fields = append(fields, "prev-ip-addr", privacy.IpAddr(privacy.Logs, ids.PrevIpAddr))
+	}
+	if details != nil && !privacy.Enabled(privacy.Logs) {
+		// the details carry subscriber identities
+		fields = append(fields, "details", details)
+	}
+	logger.TraceLog.Infow(message, fields...)
+
+	imsi := normalize(KindImsi, ids.Imsi)
+	if imsi == "" {
+		return
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	b, ok := bundles[imsi]
+	if !ok {
+		if len(bundles) >= maxBundles {
+			evictBundle()
+		}
+		b = &Bundle{Imsi: imsi}
+		bundles[imsi] = b
+	}
+	if len(b.Events) >= maxEvents {
+		b.Events = slices.Delete(b.Events, 0, len(b.Events)-maxEvents+1)
+	}
+	b.Events = append(b.Events, event)
+	b.Updated = event.Time
+}
+
+func evictBundle() {
+	var oldest *Bundle
+	for _, b := range bundles {
+		if oldest == nil || b.Updated.Before(oldest.Updated) {
+			oldest = b
+		}
+	}
+	delete(bundles, oldest.Imsi)
+}
+
+// GetBundle returns the events traced of the subscriber, with or without
+// the imsi- prefix
+func GetBundle(imsi string) (Bundle, error) {
+	lock.RLock()
+	defer lock.RUnlock()
+	b, ok := bundles[normalize(KindImsi, imsi)]
+	if !ok {
+		return Bundle{}, ErrNotTraced
+	}
+	return Bundle{Imsi: b.Imsi, Updated: b.Updated, Events: slices.Clone(b.Events)}, nil
+}
+
+// DeleteBundle drops the events traced of the subscriber
+func DeleteBundle(imsi string) error {
+	lock.Lock()
+	defer lock.Unlock()
+	key := normalize(KindImsi, imsi)
+	if _, ok := bundles[key]; !ok {
+		return ErrNotTraced
+	}
+	delete(bundles, key)
+	return nil
+}
+
+func maskTarget(ch privacy.Channel, t Target) Target {
+	switch t.Kind {
+	case KindImsi:
+		t.Value = privacy.Imsi(ch, t.Value)
+	case KindIp:
+		t.Value = privacy.IpAddr(ch, t.Value)
+	case KindGuti:
+		t.Value = privacy.Guti(ch, t.Value)
+	}
+	return t
+}
+
+// MaskTargets pseudonymises the targets for the channel
+func MaskTargets(ch privacy.Channel, list []Target) []Target {
+	for i := range list {
+		list[i] = maskTarget(ch, list[i])
+	}
+	return list
+}
+
+// MaskBundle pseudonymises the bundle for the channel, dropping the event
+// details which carry subscriber identities
+func MaskBundle(ch privacy.Channel, b Bundle) Bundle {
+	if !privacy.Enabled(ch) {
+		return b
+	}
+	b.Imsi = privacy.Imsi(ch, b.Imsi)
+	for i, e := range b.Events {
+		e.Imsi = privacy.Imsi(ch, e.Imsi)
+		e.IpAddr = privacy.IpAddr(ch, e.IpAddr)
+		e.Guti = privacy.Guti(ch, e.Guti)
+		e.PrevIpAddr = privacy.IpAddr(ch, e.PrevIpAddr)
+		e.Details = nil
+		b.Events[i] = e
+	}
+	return b
+}
@@ -0,0 +1,128 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package subtrace
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/omec-project/metricfunc/config"
+	"github.com/omec-project/metricfunc/internal/privacy"
+)
+
+func reset(t *testing.T) {
+	t.Cleanup(func() {
+		lock.Lock()
+		defer lock.Unlock()
+		clear(targets)
+		clear(bundles)
+		tracing.Store(false)
+	})
+}
+
+func TestTraceByIpAddr(t *testing.T) {
+	reset(t)
+	if _, err := Add(Target{Kind: KindIp, Value: "10.250.0.7"}); err != nil {
+		t.Fatal(err)
+	}
+
+	Record("reader", Ids{Imsi: "imsi-208930000000001", IpAddr: "10.250.0.7"}, "SMF subscriber event", nil)
+	Record("reader", Ids{Imsi: "imsi-208930000000002", IpAddr: "10.250.0.8"}, "SMF subscriber event", nil)
+	// logged only, without an imsi
+	Record("controller", Ids{IpAddr: "10.250.0.7"}, "rogue ip report pending", nil)
+
+	bundle, err := GetBundle("208930000000001")
+	if err != nil || len(bundle.Events) != 1 || bundle.Events[0].Source != "reader" {
+		t.Fatalf("unexpected bundle %+v, %v", bundle, err)
+	}
+	if _, err := GetBundle("imsi-208930000000002"); err != ErrNotTraced {
+		t.Fatalf("untraced subscriber kept: %v", err)
+	}
+
+	if err := Remove(KindIp, "10.250.0.7"); err != nil {
+		t.Fatal(err)
+	}
+	if Traced(Ids{IpAddr: "10.250.0.7"}) {
+		t.Fatal("removed target still traced")
+	}
+	// the bundle outlives the target
+	if _, err := GetBundle("imsi-208930000000001"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTraceExpiry(t *testing.T) {
+	reset(t)
+	target, err := Add(Target{Kind: KindImsi, Value: "imsi-208930000000001", Expires: time.Now().Add(time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.Value != "208930000000001" || !Traced(Ids{Imsi: "208930000000001"}) {
+		t.Fatalf("unexpected target %+v", target)
+	}
+
+	lock.Lock()
+	targets[targetKey{KindImsi, target.Value}] = Target{Kind: KindImsi, Value: target.Value, Expires: time.Now()}
+	lock.Unlock()
+	if Traced(Ids{Imsi: "imsi-208930000000001"}) {
+		t.Fatal("expired target traced")
+	}
+	if list := List(); len(list) != 0 || tracing.Load() {
+		t.Fatalf("expired target listed %+v", list)
+	}
+}
+
+func TestTraceEventsBounded(t *testing.T) {
+	reset(t)
+	if _, err := Add(Target{Kind: KindGuti, Value: "5g-guti-1"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := range maxEvents + 10 {
+		Record("metricdata", Ids{Imsi: "208930000000001", Guti: "5g-guti-1"}, fmt.Sprint(i), nil)
+	}
+	bundle, _ := GetBundle("208930000000001")
+	if len(bundle.Events) != maxEvents || bundle.Events[0].Message != "10" {
+		t.Fatalf("unexpected events %d, first %+v", len(bundle.Events), bundle.Events[0])
+	}
+}
+
+func TestAddRejects(t *testing.T) {
+	reset(t)
+	for _, target := range []Target{
+		{Kind: "msisdn", Value: "1"},
+		{Kind: KindIp, Value: "not-an-ip"},
+		{Kind: KindImsi, Value: ""},
+		{Kind: KindImsi, Value: "1", Expires: time.Now().Add(-time.Minute)},
+		{Kind: KindImsi, Value: "1", Expires: time.Now().Add(MaxDuration + time.Hour)},
+	} {
+		if _, err := Add(target); err == nil {
+			t.Errorf("%+v accepted", target)
+		}
+	}
+}
+
+func TestMaskBundlePrevIpAddr(t *testing.T) {
+	reset(t)
+	if err := privacy.Init(&config.Privacy{Api: config.ApiPrivacy{Observer: "truncate"}}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = privacy.Init(nil) })
+	if _, err := Add(Target{Kind: KindIp, Value: "10.250.0.7"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// traced by the ip address the subscriber leaves
+	Record("metricdata", Ids{Imsi: "208930000000001", IpAddr: "10.251.0.9", PrevIpAddr: "10.250.0.7"},
+		"subscriber updated, ip address changed", nil)
+	bundle, err := GetBundle("208930000000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	masked := MaskBundle(privacy.ApiObserver, bundle)
+	if e := masked.Events[0]; e.PrevIpAddr != "10.250.0.0/24" || e.IpAddr != "10.251.0.0/24" {
+		t.Errorf("masked event %+v, want both ip addresses truncated", e)
+	}
+}
@@ -0,0 +1,170 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/omec-project/metricfunc/config"
+	"github.com/omec-project/metricfunc/logger"
+)
+
+const (
+	ClientAuthRequire       = "require"
+	ClientAuthVerifyIfGiven = "verifyIfGiven"
+)
+
+// reloadInterval limits how often the certificate files are checked for
+// changes
+var reloadInterval = 5 * time.Second
+
+// serverFiles serves the certificate, key and client CA bundle of a server
+// and reloads them when the files change, so that rotated certificates
+// apply to new connections without a restart
+type serverFiles struct {
+	certFile   string
+	keyFile    string
+	caFile     string
+	clientAuth tls.ClientAuthType
+
+	lock    sync.Mutex
+	checked time.Time
+	modTime map[string]time.Time
+	current *tls.Config
+}
+
+// Server returns the TLS configuration of a server with the certificate of
+// cfg, which also verifies client certificates against the CA bundle when
+// set. It returns nil when cfg is nil so that the server runs without TLS.
+func Server(cfg *config.TLS) (*tls.Config, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, errors.New("server tls requires certFile and keyFile")
+	}
+
+	files := &serverFiles{certFile: cfg.CertFile, keyFile: cfg.KeyFile, caFile: cfg.CaFile}
+	if cfg.CaFile != "" {
+		switch cfg.ClientAuth {
+		case "", ClientAuthRequire:
+			files.clientAuth = tls.RequireAndVerifyClientCert
+		case ClientAuthVerifyIfGiven:
+			files.clientAuth = tls.VerifyClientCertIfGiven
+		default:
+			return nil, fmt.Errorf("unknown clientAuth [%s]", cfg.ClientAuth)
+		}
+	}
+	if _, err := files.changedLocked(); err != nil {
+		return nil, err
+	}
+	if err := files.loadLocked(); err != nil {
+		return nil, err
+	}
+	files.checked = time.Now()
+
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		GetConfigForClient: files.config,
+	}, nil
+}
+
+func (f *serverFiles) config(*tls.ClientHelloInfo) (*tls.Config, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if time.Since(f.checked) < reloadInterval {
+		return f.current, nil
+	}
+	f.checked = time.Now()
+
+	changed, err := f.changedLocked()
+	if err == nil && changed {
+		err = f.loadLocked()
+		if err == nil {
+			logger.AppLog.Infof("reloaded server certificate [%s]", f.certFile)
+		}
+	}
+	if err != nil {
+		// keep serving the last good certificate and retry on the next
+		// check, the files may have been caught halfway through an update
+		f.modTime = nil
+		logger.AppLog.Warnf("reload server certificate [%s] failed: %v", f.certFile, err)
+	}
+	return f.current, nil
+}
+
+func (f *serverFiles) files() []string {
+	files := []string{f.certFile, f.keyFile}
+	if f.caFile != "" {
+		files = append(files, f.caFile)
+	}
+	return files
+}
+
+// changedLocked records the modification times of the files and reports
+// whether any of them changed since the last call
+func (f *serverFiles) changedLocked() (bool, error) {
+	modTime := make(map[string]time.Time, 3)
+	changed := false
+	for _, file := range f.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return false, err
+		}
+		modTime[file] = info.ModTime()
+		if !info.ModTime().Equal(f.modTime[file]) {
+			changed = true
+		}
+	}
+	f.modTime = modTime
+	return changed, nil
+}
+
+func (f *serverFiles) loadLocked() error {
+	cert, err := tls.LoadX509KeyPair(f.certFile, f.keyFile)
+	if err != nil {
+		return fmt.Errorf("load server certificate: %w", err)
+	}
+	tlsCfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		// the config replaces the one prepared by the http server, so it
+		// has to offer h2 itself
+		NextProtos: []string{"h2", "http/1.1"},
+		ClientAuth: f.clientAuth,
+	}
+	if f.caFile != "" {
+		pool, err := loadCertPool(f.caFile)
+		if err != nil {
+			return err
+		}
+		tlsCfg.ClientCAs = pool
+	}
+	f.current = tlsCfg
+	return nil
+}
+
+// Serve serves HTTPS on the listener with the certificate of cfg, or
+// cleartext HTTP when cfg is nil. HTTP/2 is offered over TLS and as h2c
+// depending on the protocols of the server.
+func Serve(server *http.Server, ln net.Listener, cfg *config.TLS) error {
+	tlsCfg, err := Server(cfg)
+	if err != nil {
+		_ = ln.Close()
+		return err
+	}
+	if tlsCfg == nil {
+		return server.Serve(ln)
+	}
+	server.TLSConfig = tlsCfg
+	return server.ServeTLS(ln, "", "")
+}
@@ -0,0 +1,161 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/omec-project/metricfunc/config"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+var serial int64
+
+// newCert issues a certificate for cn, self-signed when parent is nil
+func newCert(t *testing.T, cn string, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key}
+}
+
+func (c *testCert) write(t *testing.T, certFile, keyFile string) {
+	t.Helper()
+	keyDer, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})
+	if err := os.WriteFile(certFile, certPem, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if keyFile != "" {
+		keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+		if err := os.WriteFile(keyFile, keyPem, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key}
+}
+
+func TestServerMutualTlsAndReload(t *testing.T) {
+	reloadInterval = 0
+	t.Cleanup(func() { reloadInterval = 5 * time.Second })
+
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+	ca := newCert(t, "metricfunc-ca", nil)
+	ca.write(t, caFile, "")
+	first := newCert(t, "metricfunc-1", ca)
+	first.write(t, certFile, keyFile)
+
+	tlsCfg, err := Server(&config.TLS{CertFile: certFile, KeyFile: keyFile, CaFile: caFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = tlsCfg
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(clientCert *testCert) (*http.Response, error) {
+		clientTls := &tls.Config{RootCAs: roots}
+		if clientCert != nil {
+			clientTls.Certificates = []tls.Certificate{clientCert.tlsCertificate()}
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTls, ForceAttemptHTTP2: true}}
+		defer client.CloseIdleConnections()
+		return client.Get(server.URL)
+	}
+
+	if rsp, err := get(nil); err == nil {
+		_ = rsp.Body.Close()
+		t.Fatal("expected connection without client certificate to fail")
+	}
+	rsp, err := get(newCert(t, "roc-gui", ca))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = rsp.Body.Close()
+	if rsp.ProtoMajor != 2 || rsp.TLS.PeerCertificates[0].Subject.CommonName != "metricfunc-1" {
+		t.Fatalf("unexpected response %s from %s", rsp.Proto, rsp.TLS.PeerCertificates[0].Subject.CommonName)
+	}
+
+	// rotate the server certificate
+	newCert(t, "metricfunc-2", ca).write(t, certFile, keyFile)
+	later := time.Now().Add(time.Minute)
+	for _, file := range []string{certFile, keyFile} {
+		if err := os.Chtimes(file, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rsp, err = get(newCert(t, "roc-gui", ca))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = rsp.Body.Close()
+	if cn := rsp.TLS.PeerCertificates[0].Subject.CommonName; cn != "metricfunc-2" {
+		t.Fatalf("rotated certificate not served, got %s", cn)
+	}
+}
+
+func TestServerRequiresCertAndKey(t *testing.T) {
+	if _, err := Server(&config.TLS{CaFile: "ca.pem"}); err == nil {
+		t.Fatal("expected server tls without certificate to be rejected")
+	}
+}
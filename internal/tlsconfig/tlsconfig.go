@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package tlsconfig builds crypto/tls configurations from config.TLS
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/omec-project/metricfunc/config"
+)
+
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("read CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in CA bundle [%s]", caFile)
+	}
+	return pool, nil
+}
+
+// Client returns the TLS configuration for connections to a server. It
+// returns nil when cfg is nil so that the transport defaults apply.
+func Client(cfg *config.TLS) (*tls.Config, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	tlsCfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify, // #nosec G402 -- explicit opt-in for lab setups
+	}
+	if cfg.CaFile != "" {
+		pool, err := loadCertPool(cfg.CaFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		if cfg.CertFile == "" || cfg.KeyFile == "" {
+			return nil, errors.New("certFile and keyFile must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return tlsCfg, nil
+}
+
+// Scheme returns the url scheme of the endpoint
+func Scheme(endPoint *config.ServerAddr) string {
+	if endPoint.Scheme != "" {
+		return endPoint.Scheme
+	}
+	if endPoint.Tls != nil {
+		return "https"
+	}
+	return "http"
+}
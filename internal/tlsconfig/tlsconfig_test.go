@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tlsconfig
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/omec-project/metricfunc/config"
+)
+
+func TestClientVerifiesWithCaBundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPem, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tlsCfg, err := Client(&config.TLS{CaFile: caFile, ServerName: "example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsCfg}}
+	rsp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request with CA bundle failed: %v", err)
+	}
+	_ = rsp.Body.Close()
+
+	// the system roots do not know the test CA
+	tlsCfg, err = Client(&config.TLS{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = &http.Client{Transport: &http.Transport{TLSClientConfig: tlsCfg}}
+	if rsp, err := client.Get(server.URL); err == nil {
+		_ = rsp.Body.Close()
+		t.Fatal("expected verification against system roots to fail")
+	}
+}
+
+func TestClientRequiresCertAndKey(t *testing.T) {
+	if _, err := Client(&config.TLS{CertFile: "client.pem"}); err == nil {
+		t.Fatal("expected error for certificate without key")
+	}
+}
+
+func TestScheme(t *testing.T) {
+	for _, tc := range []struct {
+		endPoint config.ServerAddr
+		want     string
+	}{
+		{config.ServerAddr{}, "http"},
+		{config.ServerAddr{Tls: &config.TLS{}}, "https"},
+		{config.ServerAddr{Scheme: "http", Tls: &config.TLS{}}, "http"},
+	} {
+		if got := Scheme(&tc.endPoint); got != tc.want {
+			t.Errorf("Scheme(%+v): got %q want %q", tc.endPoint, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package tracing exports OpenTelemetry spans along the path of the events,
+// from Kafka through the subscriber cache to the controller and its
+// upstream calls
+package tracing
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omec-project/metricfunc/config"
+	"github.com/omec-project/metricfunc/logger"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	serviceName = "metricfunc"
+	// instrumentation names the tracer of the spans started here
+	instrumentation = "github.com/omec-project/metricfunc"
+)
+
+func init() {
+	// trace context is passed on even while spans are not exported
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+}
+
+// Tracer starts the spans of metricfunc, they are dropped until Init
+// enables the export
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
+
+// Init sets up the export of the spans. The returned function flushes the
+// spans left and stops the export.
+func Init(cfg *config.Tracing) (shutdown func(context.Context) error, err error) {
+	if cfg == nil || !cfg.Enable {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var exporter sdktrace.SpanExporter
+	switch cfg.Exporter {
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		// the OTEL_EXPORTER_OTLP_* environment variables apply to what is
+		// not configured
+		var options []otlptracehttp.Option
+		if cfg.Endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(context.Background(), options...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tracing exporter: %w", err)
+	}
+
+	ratio := cfg.SampleRatio
+	if ratio == 0 {
+		ratio = 1
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		// traces started upstream, such as by the SMF, keep their decision
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+	logger.AppLog.Infof("tracing enabled, exporter [%s] endpoint [%s] sample ratio [%v]",
+		cmp.Or(cfg.Exporter, "otlp"), cfg.Endpoint, ratio)
+	return provider.Shutdown, nil
+}
+
+// headers carries the trace context in the headers of a kafka message
+type headers []kafka.Header
+
+func (h headers) Get(key string) string {
+	for _, header := range h {
+		if header.Key == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+func (h headers) Set(string, string) {}
+
+func (h headers) Keys() []string {
+	keys := make([]string, len(h))
+	for i, header := range h {
+		keys[i] = header.Key
+	}
+	return keys
+}
+
+// Extract returns ctx with the trace context of the kafka message headers,
+// ctx itself when the producer sent none
+func Extract(ctx context.Context, msgHeaders []kafka.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, headers(msgHeaders))
+}
+
+// transport traces the requests by method and host, the paths and queries
+// of the upstream apis hold subscriber identities
+type transport struct {
+	next http.RoundTripper
+}
+
+// Transport traces the requests sent through rt and passes their trace
+// context on to the upstream
+func Transport(rt http.RoundTripper) http.RoundTripper {
+	return &transport{next: rt}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := Tracer().Start(req.Context(), "HTTP "+req.Method, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("server.address", req.URL.Hostname())))
+	req = req.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	rsp, err := t.next.RoundTrip(req)
+	if err == nil {
+		span.SetAttributes(attribute.Int("http.response.status_code", rsp.StatusCode))
+		if rsp.StatusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rsp.StatusCode))
+		}
+	}
+	End(span, err)
+	return rsp, err
+}
+
+// Middleware traces the requests of the api server by route, continuing
+// the trace of the caller. The request paths are left out for the
+// subscriber identities they hold.
+func Middleware(c *gin.Context) {
+	ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+	route := c.FullPath()
+	ctx, span := Tracer().Start(ctx, c.Request.Method+" "+route, trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", c.Request.Method),
+			attribute.String("http.route", route)))
+	defer span.End()
+	c.Request = c.Request.WithContext(ctx)
+	c.Next()
+
+	status := c.Writer.Status()
+	span.SetAttributes(attribute.Int("http.response.status_code", status))
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+}
+
+// End records err, if any, on the span and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
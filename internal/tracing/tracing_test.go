@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func record(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func TestExtractKafkaHeaders(t *testing.T) {
+	ctx := Extract(context.Background(), []kafka.Header{{Key: "traceparent", Value: []byte(traceparent)}})
+	span := trace.SpanContextFromContext(ctx)
+	if !span.IsRemote() || span.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("unexpected span context %+v", span)
+	}
+	if trace.SpanContextFromContext(Extract(context.Background(), nil)).IsValid() {
+		t.Fatal("span context without headers")
+	}
+}
+
+func TestTransport(t *testing.T) {
+	recorder := record(t)
+	var received string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+
+	ctx, parent := Tracer().Start(context.Background(), "task")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPut, upstream.URL+"/sim-card/208930000000001", nil)
+	rsp, err := (&http.Client{Transport: Transport(http.DefaultTransport)}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 || spans[0].Name() != "HTTP PUT" {
+		t.Fatalf("unexpected spans %v", spans)
+	}
+	client := spans[0]
+	if client.Parent().SpanID() != parent.SpanContext().SpanID() || received == "" ||
+		received[36:52] != client.SpanContext().SpanID().String() {
+		t.Fatalf("trace context not passed on, received %q", received)
+	}
+	for _, attr := range client.Attributes() {
+		if attr.Key == "url.full" || attr.Key == "url.path" {
+			t.Fatalf("request path recorded: %v", attr)
+		}
+	}
+	if client.Status().Code.String() != "Error" {
+		t.Fatalf("unexpected status %v", client.Status())
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := record(t)
+	router := gin.New()
+	router.Use(Middleware)
+	router.GET("/subscriber/:imsi", func(c *gin.Context) {
+		if !trace.SpanContextFromContext(c.Request.Context()).IsValid() {
+			t.Error("handler without span")
+		}
+		c.Status(http.StatusNotFound)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/subscriber/208930000000001", nil)
+	req.Header.Set("traceparent", traceparent)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 || spans[0].Name() != "GET /subscriber/:imsi" {
+		t.Fatalf("unexpected spans %v", spans)
+	}
+	if spans[0].Parent().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatal("trace of the caller not continued")
+	}
+}
@@ -0,0 +1,120 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package webui
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/omec-project/metricfunc/logger"
+)
+
+const configApiPrefix = "/config/v1"
+
+// DeviceGroup holds the fields of the device group model of the SD-Core
+// webui config API which metricfunc reads and writes back. Fields of the
+// model missing here are not sent back with an update.
+type DeviceGroup struct {
+	DeviceGroupName  string          `json:"group-name"`
+	Imsis            []string        `json:"imsis"`
+	SiteInfo         string          `json:"site-info,omitempty"`
+	IpDomainName     string          `json:"ip-domain-name,omitempty"`
+	IpDomainExpanded json.RawMessage `json:"ip-domain-expanded,omitempty"`
+}
+
+// Doer sends http requests, as implemented by http.Client
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Client is a client for the SD-Core webui config API
+type Client struct {
+	baseUrl    string
+	httpClient Doer
+}
+
+func NewClient(baseUrl string, httpClient Doer) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		baseUrl:    strings.TrimSuffix(baseUrl, "/"),
+		httpClient: httpClient,
+	}
+}
+
+func (c *Client) BaseUrl() string {
+	return c.baseUrl
+}
+
+func (c *Client) do(ctx context.Context, method, reqUrl string, body, out any) error {
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("marshal request body: %w", err)
+		}
+		reqBody = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, reqUrl, reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	logger.ControllerLog.Debugf("webui request [%s %s]", method, reqUrl)
+	rsp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := rsp.Body.Close(); err != nil {
+			logger.ControllerLog.Warnf("body close error: %v", err)
+		}
+	}()
+
+	if rsp.StatusCode < http.StatusOK || rsp.StatusCode >= http.StatusMultipleChoices {
+		msg, _ := io.ReadAll(io.LimitReader(rsp.Body, 512))
+		return fmt.Errorf("webui [%s %s] returned [%d %s] %s", method, reqUrl,
+			rsp.StatusCode, http.StatusText(rsp.StatusCode), strings.TrimSpace(string(msg)))
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(rsp.Body).Decode(out); err != nil && err != io.EOF {
+		return fmt.Errorf("decode response of [%s %s]: %w", method, reqUrl, err)
+	}
+	return nil
+}
+
+func (c *Client) GetDeviceGroupNames(ctx context.Context) ([]string, error) {
+	var names []string
+	err := c.do(ctx, http.MethodGet, c.baseUrl+configApiPrefix+"/device-group", nil, &names)
+	return names, err
+}
+
+func (c *Client) GetDeviceGroup(ctx context.Context, name string) (*DeviceGroup, error) {
+	var deviceGroup DeviceGroup
+	reqUrl := c.baseUrl + configApiPrefix + "/device-group/" + url.PathEscape(name)
+	if err := c.do(ctx, http.MethodGet, reqUrl, nil, &deviceGroup); err != nil {
+		return nil, err
+	}
+	return &deviceGroup, nil
+}
+
+func (c *Client) UpdateDeviceGroup(ctx context.Context, deviceGroup *DeviceGroup) error {
+	reqUrl := c.baseUrl + configApiPrefix + "/device-group/" + url.PathEscape(deviceGroup.DeviceGroupName)
+	return c.do(ctx, http.MethodPut, reqUrl, deviceGroup, nil)
+}
@@ -5,8 +5,16 @@
 package logger
 
 import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sync/atomic"
+
+	"github.com/omec-project/metricfunc/config"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 var (
@@ -17,45 +25,200 @@ var (
 	PromLog       *zap.SugaredLogger
 	AppLog        *zap.SugaredLogger
 	ControllerLog *zap.SugaredLogger
-	atomicLevel   zap.AtomicLevel
+	// TraceLog logs the events of the traced subscribers
+	TraceLog *zap.SugaredLogger
+
+	// levels holds the level of every category, changed at runtime
+	levels = map[string]zap.AtomicLevel{}
+	// current is where all categories write to
+	current atomic.Pointer[output]
 )
 
 func init() {
-	atomicLevel = zap.NewAtomicLevelAt(zap.InfoLevel)
-	config := zap.Config{
-		Level:            atomicLevel,
-		Development:      false,
-		Encoding:         "console",
-		EncoderConfig:    zap.NewProductionEncoderConfig(),
-		OutputPaths:      []string{"stdout"},
-		ErrorOutputPaths: []string{"stderr"},
-	}
-
-	config.EncoderConfig.TimeKey = "timestamp"
-	config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
-	config.EncoderConfig.LevelKey = "level"
-	config.EncoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
-	config.EncoderConfig.CallerKey = "caller"
-	config.EncoderConfig.EncodeCaller = zapcore.ShortCallerEncoder
-	config.EncoderConfig.MessageKey = "message"
-	config.EncoderConfig.StacktraceKey = ""
-
-	var err error
-	log, err = config.Build()
+	out, err := newOutput(&config.Logger{})
 	if err != nil {
 		panic(err)
 	}
+	current.Store(out)
+	log = zap.New(zapcore.NewNopCore(), zap.AddCaller(), zap.ErrorOutput(zapcore.Lock(os.Stderr)))
+
+	ApiSrvLog = newLogger("ApiServer", "MetricFunc", "ApiServer")
+	GinLog = newLogger("Gin", "MetricFunc", "Gin")
+	CacheLog = newLogger("Cache", "MetricFunc", "Cache")
+	PromLog = newLogger("Prometheus", "MetricFunc", "Prometheus")
+	AppLog = newLogger("App", "MetricFunc", "App")
+	ControllerLog = newLogger("Controller", "Controller", "App")
+	TraceLog = newLogger("Trace", "MetricFunc", "Trace")
+}
+
+// newLogger returns the logger of a category whose level is set on its own
+func newLogger(name, component, category string) *zap.SugaredLogger {
+	level := zap.NewAtomicLevelAt(zap.InfoLevel)
+	levels[name] = level
+	core := &categoryCore{name: name, level: level}
+	return log.WithOptions(zap.WrapCore(func(zapcore.Core) zapcore.Core { return core })).
+		Sugar().With("component", component, "category", category)
+}
 
-	ApiSrvLog = log.Sugar().With("component", "MetricFunc", "category", "ApiServer")
-	GinLog = log.Sugar().With("component", "MetricFunc", "category", "Gin")
-	CacheLog = log.Sugar().With("component", "MetricFunc", "category", "Cache")
-	PromLog = log.Sugar().With("component", "MetricFunc", "category", "Prometheus")
-	AppLog = log.Sugar().With("component", "MetricFunc", "category", "App")
-	ControllerLog = log.Sugar().With("component", "Controller", "category", "App")
+// Categories returns the names of the categories whose level is set on its
+// own
+func Categories() []string {
+	return slices.Sorted(maps.Keys(levels))
 }
 
-// SetLogLevel: set the log level (panic|fatal|error|warn|info|debug)
+// SetLogLevel: set the log level (panic|fatal|error|warn|info|debug) of
+// all categories
 func SetLogLevel(level zapcore.Level) {
 	AppLog.Infoln("set log level:", level)
-	atomicLevel.SetLevel(level)
+	for _, l := range levels {
+		l.SetLevel(level)
+	}
+}
+
+// SetCategoryLevel sets the log level of a single category
+func SetCategoryLevel(category string, level zapcore.Level) error {
+	l, ok := levels[category]
+	if !ok {
+		return fmt.Errorf("unknown log category [%s], one of %v", category, Categories())
+	}
+	AppLog.Infof("set log level of category [%s]: %v", category, level)
+	l.SetLevel(level)
+	return nil
+}
+
+// Levels returns the log level of every category
+func Levels() map[string]string {
+	result := make(map[string]string, len(levels))
+	for name, l := range levels {
+		result[name] = l.Level().String()
+	}
+	return result
+}
+
+// Configure prepares the output and the levels of cfg, the returned
+// function switches the loggers to them. Levels changed at runtime are
+// reset to the configured ones.
+func Configure(cfg *config.Logger) (apply func(), err error) {
+	level, err := zapcore.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+	categories := make(map[string]zapcore.Level)
+	for name, value := range cfg.Categories {
+		if _, ok := levels[name]; !ok {
+			return nil, fmt.Errorf("unknown log category [%s], one of %v", name, Categories())
+		}
+		if categories[name], err = zapcore.ParseLevel(value); err != nil {
+			return nil, fmt.Errorf("log category [%s]: %w", name, err)
+		}
+	}
+	out, err := newOutput(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		if old := current.Swap(out); old.file != nil && old.file != out.file {
+			// a line written while swapping may open the file again, the
+			// same file unless the path changed too
+			old.file.Close()
+		}
+		SetLogLevel(level)
+		for name, l := range categories {
+			levels[name].SetLevel(l)
+		}
+	}, nil
+}
+
+// output encodes the log lines and writes them to stdout or a file
+type output struct {
+	core    zapcore.Core
+	file    *lumberjack.Logger
+	sampler *sampler // nil when debug lines are all written
+	// fileConfig is the configuration of file, to keep it on reload
+	fileConfig config.LogFile
+}
+
+func newOutput(cfg *config.Logger) (*output, error) {
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.TimeKey = "timestamp"
+	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	encoderConfig.LevelKey = "level"
+	encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+	encoderConfig.CallerKey = "caller"
+	encoderConfig.EncodeCaller = zapcore.ShortCallerEncoder
+	encoderConfig.MessageKey = "message"
+	encoderConfig.StacktraceKey = ""
+
+	var encoder zapcore.Encoder
+	switch cfg.Encoding {
+	case "", "console":
+		encoder = zapcore.NewConsoleEncoder(encoderConfig)
+	case "json":
+		encoder = zapcore.NewJSONEncoder(encoderConfig)
+	default:
+		return nil, fmt.Errorf("unknown log encoding [%s]", cfg.Encoding)
+	}
+
+	out := &output{}
+	var writer zapcore.WriteSyncer = zapcore.Lock(os.Stdout)
+	if cfg.File != nil {
+		out.fileConfig = *cfg.File
+		if old := current.Load(); old != nil && old.file != nil && old.fileConfig == *cfg.File {
+			out.file = old.file
+		} else {
+			out.file = &lumberjack.Logger{
+				Filename:   cfg.File.Path,
+				MaxSize:    cfg.File.MaxSize,
+				MaxBackups: cfg.File.MaxBackups,
+				MaxAge:     cfg.File.MaxAge,
+				Compress:   cfg.File.Compress,
+			}
+			// opens the file, failing on an unwritable path now rather than
+			// on the first line
+			if _, err := out.file.Write(nil); err != nil {
+				return nil, fmt.Errorf("log file [%s]: %w", cfg.File.Path, err)
+			}
+		}
+		writer = zapcore.AddSync(out.file)
+	}
+	out.core = zapcore.NewCore(encoder, writer, zap.DebugLevel)
+	if cfg.Sampling != nil {
+		out.sampler = newSampler(cfg.Sampling.Initial, cfg.Sampling.Thereafter)
+	}
+	return out, nil
+}
+
+// categoryCore writes the lines of a category at or above its level to the
+// current output
+type categoryCore struct {
+	name   string
+	level  zap.AtomicLevel
+	fields []zapcore.Field
+}
+
+func (c *categoryCore) Enabled(level zapcore.Level) bool {
+	return c.level.Enabled(level)
+}
+
+func (c *categoryCore) With(fields []zapcore.Field) zapcore.Core {
+	return &categoryCore{name: c.name, level: c.level, fields: slices.Concat(c.fields, fields)}
+}
+
+func (c *categoryCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.Enabled(entry.Level) {
+		return checked
+	}
+	if s := current.Load().sampler; s != nil && entry.Level == zap.DebugLevel && !s.allow(c.name, entry.Message) {
+		return checked
+	}
+	return checked.AddCore(entry, c)
+}
+
+func (c *categoryCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	return current.Load().core.Write(entry, slices.Concat(c.fields, fields))
+}
+
+func (c *categoryCore) Sync() error {
+	return current.Load().core.Sync()
 }
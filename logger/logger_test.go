@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package logger
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/omec-project/metricfunc/config"
+)
+
+func configure(t *testing.T, cfg *config.Logger) {
+	t.Helper()
+	apply, err := Configure(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apply()
+}
+
+// readLines returns the json lines of the log file
+func readLines(t *testing.T, path string) []map[string]any {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var lines []map[string]any
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var line map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("line %q is not json: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestCategoryLevelsAndSampling(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metricfunc.log")
+	configure(t, &config.Logger{
+		LogLevel:   "info",
+		Categories: map[string]string{"Controller": "debug"},
+		Encoding:   "json",
+		File:       &config.LogFile{Path: path},
+		Sampling:   &config.LogSampling{Initial: 2, Thereafter: 5},
+	})
+	t.Cleanup(func() { configure(t, &config.Logger{LogLevel: "info"}) })
+
+	AppLog.Debugw("app debug")
+	for i := range 12 {
+		ControllerLog.Debugw("controller debug", "i", i)
+	}
+	ControllerLog.Infow("controller info")
+
+	var messages []string
+	for _, line := range readLines(t, path) {
+		messages = append(messages, line["message"].(string))
+	}
+	// the first 2 debug lines then the 7th and 12th, the App category
+	// stays at info
+	want := []string{"set log level: info", "controller debug", "controller debug",
+		"controller debug", "controller debug", "controller info"}
+	if len(messages) != len(want) {
+		t.Fatalf("got %v want %v", messages, want)
+	}
+	for i := range want {
+		if messages[i] != want[i] {
+			t.Fatalf("got %v want %v", messages, want)
+		}
+	}
+
+	if err := SetCategoryLevel("Kafka", 0); err == nil {
+		t.Fatal("unknown category accepted")
+	}
+	if levels := Levels(); levels["Controller"] != "debug" || levels["Gin"] != "info" {
+		t.Fatalf("unexpected levels %v", levels)
+	}
+}
+
+func TestConfigureRejects(t *testing.T) {
+	for _, cfg := range []*config.Logger{
+		{LogLevel: "verbose"},
+		{LogLevel: "info", Categories: map[string]string{"Kafka": "debug"}},
+		{LogLevel: "info", Encoding: "xml"},
+		{LogLevel: "info", File: &config.LogFile{Path: filepath.Join(t.TempDir(), "missing", "\x00")}},
+	} {
+		if _, err := Configure(cfg); err == nil {
+			t.Errorf("%+v accepted", cfg)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package logger
+
+import (
+	"sync"
+	"time"
+)
+
+// sampleTick is the period over which the lines of the same message are
+// counted
+const sampleTick = time.Second
+
+// sampler lets the first initial debug lines of the same category and
+// message through every sampleTick, then one of every thereafter. The f
+// suffixed functions format their arguments into the message, high-volume
+// lines log them as fields with Debugw instead to be sampled.
+type sampler struct {
+	initial    int
+	thereafter int
+
+	lock   sync.Mutex
+	start  time.Time
+	counts map[[2]string]int
+}
+
+func newSampler(initial, thereafter int) *sampler {
+	return &sampler{initial: initial, thereafter: thereafter, counts: map[[2]string]int{}}
+}
+
+func (s *sampler) allow(category, message string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if now := time.Now(); now.Sub(s.start) >= sampleTick {
+		s.start = now
+		clear(s.counts)
+	}
+	key := [2]string{category, message}
+	s.counts[key]++
+	n := s.counts[key]
+	return n <= s.initial || s.thereafter > 0 && (n-s.initial)%s.thereafter == 0
+}
@@ -5,101 +5,219 @@
 package main
 
 import (
+	"cmp"
+	"context"
 	"flag"
 	"fmt"
-	"net"
 	"net/http"
-	_ "net/http/pprof"
 	"os"
-	"strconv"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/omec-project/metricfunc/api/apiserver"
 	"github.com/omec-project/metricfunc/config"
 	"github.com/omec-project/metricfunc/controller"
+	"github.com/omec-project/metricfunc/internal/lifecycle"
+	"github.com/omec-project/metricfunc/internal/metricdata"
+	"github.com/omec-project/metricfunc/internal/nfprobe"
+	"github.com/omec-project/metricfunc/internal/nrf"
+	"github.com/omec-project/metricfunc/internal/privacy"
+	"github.com/omec-project/metricfunc/internal/profiling"
 	"github.com/omec-project/metricfunc/internal/promclient"
 	"github.com/omec-project/metricfunc/internal/reader"
+	"github.com/omec-project/metricfunc/internal/reload"
+	"github.com/omec-project/metricfunc/internal/tracing"
 	"github.com/omec-project/metricfunc/logger"
-	"go.uber.org/zap/zapcore"
-	"go.yaml.in/yaml/v4"
 )
 
-var PodIp string
-
-func init() {
-	podIpStr := os.Getenv("POD_IP")
-	PodIp = net.ParseIP(podIpStr).To4().String()
+// version is set at build time by the Makefile
+var version = "dev"
+
+// sets are the -set flags, applied over the configuration file and the
+// environment
+var sets []string
+
+// loadConfig reads and validates the configuration file with its overrides,
+// reporting all problems at once
+func loadConfig(path string) (*config.Config, error) {
+	return config.Load(path, config.Overrides{
+		PodIp: os.Getenv("POD_IP"),
+		Env:   os.Environ(),
+		Sets:  sets,
+	})
 }
 
 func main() {
 	// Read provided config
 	cfgFilePtr := flag.String("cfg", "/opt/config.yaml", "metricfunc config file")
+	validate := flag.Bool("validate", false, "validate the configuration file and exit")
+	flag.Func("set", "override a configuration value, path=value such as configuration.apiServer.port=9301",
+		func(kv string) error {
+			sets = append(sets, kv)
+			return nil
+		})
 	flag.Parse()
-	logger.AppLog.Infof("Metricfunction has started with configuration file [%v]", *cfgFilePtr)
 
-	cfg := config.Config{}
-	if content, err := os.ReadFile(*cfgFilePtr); err != nil {
-		logger.AppLog.Errorln("readfile failed", err)
-		return
-	} else {
-		if yamlErr := yaml.Unmarshal(content, &cfg); yamlErr != nil {
-			logger.AppLog.Errorln("yaml parsing failed", yamlErr)
-			return
+	if *validate {
+		if _, err := loadConfig(*cfgFilePtr); err != nil {
+			fmt.Fprintf(os.Stderr, "configuration file [%s] is invalid:\n%v\n", *cfgFilePtr, err)
+			os.Exit(1)
 		}
+		fmt.Printf("configuration file [%s] is valid\n", *cfgFilePtr)
+		return
 	}
 
-	cfg.Configuration.ApiServer.Addr = PodIp
-	cfg.Configuration.PrometheusServer.Addr = PodIp
+	logger.AppLog.Infof("Metricfunction has started with configuration file [%v]", *cfgFilePtr)
+	cfg, err := loadConfig(*cfgFilePtr)
+	if err != nil {
+		logger.AppLog.Errorf("invalid configuration:\n%v", err)
+		os.Exit(1)
+	}
 
-	// set log level
-	if level, err := zapcore.ParseLevel(cfg.Logger.LogLevel); err == nil {
-		logger.AppLog.Infof("setting log level [%v]", cfg.Logger.LogLevel)
-		logger.SetLogLevel(level)
+	// set log levels, encoding and output
+	applyLogger, err := logger.Configure(cfg.Logger)
+	if err != nil {
+		logger.AppLog.Errorf("logger configuration error: %v", err)
+		os.Exit(1)
 	}
+	applyLogger()
 
 	logger.AppLog.Infof("configuration: %+v", cfg.Configuration)
 
-	// Start Kafka Event Reader
-	reader.StartKafkaReader(cfg.Configuration)
-
-	// Start API Server
-	go apiserver.StartApiServer(&cfg.Configuration.ApiServer)
+	if err := privacy.Init(cfg.Configuration.Privacy); err != nil {
+		logger.AppLog.Errorf("privacy configuration error: %v", err)
+		os.Exit(1)
+	}
 
-	// Start Prometheus client
-	go promclient.StartPrometheusClient(&cfg.Configuration.PrometheusServer)
+	// every component is built before any is started, a component failing
+	// to build leaves nothing running
+	reloader := reload.New(*cfgFilePtr, cfg, loadConfig)
+	reloader.Register("logger", []string{"logger"}, func(_, new *config.Config) (func(), error) {
+		return logger.Configure(new.Logger)
+	})
 
 	if cfg.Configuration.ControllerFlag {
 		// controller
-		rogueIpChan := make(chan controller.RogueIPs, 100)
-		err := controller.InitControllerConfig(&cfg)
+		err := controller.InitControllerConfig(cfg)
 		if err != nil {
-			logger.AppLog.Warnln("failed to initialize controller configuration")
+			logger.AppLog.Errorf("failed to initialize controller configuration: %v", err)
+			os.Exit(1)
 		}
+		reloader.Register("controller", controller.ReloadPaths, controller.Reload)
+	}
 
-		userAppClient := controller.UserAppService{
-			UserAppServiceUrl: "http://" + cfg.Configuration.UserAppApiServer.Addr + ":" +
-				strconv.Itoa(cfg.Configuration.UserAppApiServer.Port) + cfg.Configuration.UserAppApiServer.Path,
-			PollInterval: cfg.Configuration.UserAppApiServer.PollInterval,
+	// silent nfs are unknown after the timeout, if set
+	metricdata.SetNfStatusTimeout(time.Duration(cfg.Configuration.NfStatusTimeout) * time.Second)
+	reloader.Register("nf status check", []string{"configuration.nfStatusTimeout"},
+		func(_, new *config.Config) (func(), error) {
+			return func() {
+				metricdata.SetNfStatusTimeout(time.Duration(new.Configuration.NfStatusTimeout) * time.Second)
+			}, nil
+		})
+
+	var prober *nfprobe.Prober
+	if cfg.Configuration.NfProbes != nil {
+		if prober, err = nfprobe.NewProber(cfg.Configuration.NfProbes); err != nil {
+			logger.AppLog.Errorf("nf probes error: %v", err)
+			os.Exit(1)
+		}
+	}
+	var inventory *nrf.Inventory
+	if cfg.Configuration.NrfEndPoint != nil {
+		inventory, err = nrf.NewInventory(cfg.Configuration.NrfEndPoint, cfg.Configuration.NrfNfTypes)
+		if err != nil {
+			logger.AppLog.Errorf("nrf inventory error: %v", err)
+			os.Exit(1)
 		}
+	}
 
-		controller.RogueChannel = rogueIpChan
+	// Kafka Event Reader
+	readers := reader.NewReaders(cfg.Configuration.NfStreams)
+	reloader.Register("kafka readers", []string{"configuration.nfStreams"},
+		func(_, new *config.Config) (func(), error) {
+			return func() { readers.Update(new.Configuration.NfStreams) }, nil
+		})
+
+	// API Server
+	apiserver.SetConfigSource(reloader.Current)
+	apiServer, err := apiserver.NewApiServer(&cfg.Configuration.ApiServer, cfg.Configuration.ApiServerAuth,
+		cfg.Configuration.MetricsOnApiServer)
+	if err != nil {
+		logger.AppLog.Errorf("api server error: %v", err)
+		os.Exit(1)
+	}
 
-		go userAppClient.GetRogueIPs(rogueIpChan)
-		go controller.RogueIPHandler(rogueIpChan)
+	// Prometheus client
+	promclient.SetBuildInfo(version)
+	promServer, err := promclient.NewPrometheusServer(&cfg.Configuration.PrometheusServer)
+	if err != nil {
+		logger.AppLog.Errorf("prometheus server error: %v", err)
+		os.Exit(1)
+	}
+	var pusher *promclient.Pusher
+	if cfg.Configuration.MetricsPush != nil {
+		if pusher, err = promclient.NewPusher(cfg.Configuration.MetricsPush); err != nil {
+			logger.AppLog.Errorf("metrics push error: %v", err)
+			os.Exit(1)
+		}
 	}
 
 	// Go Pprofiling
-	debugProfPort := cfg.Configuration.DebugProfile.Port
-	if debugProfPort != 0 {
-		logger.AppLog.Infof("pprofile exposed on port [%v]", debugProfPort)
-		httpAddr := fmt.Sprintf(":%d", debugProfPort)
-		go func() {
-			err := http.ListenAndServe(httpAddr, nil)
-			if err != nil {
-				logger.AppLog.Warnf("failed to listen TCP connection on address %v", httpAddr)
-			}
-		}()
-	}
-
-	// Start MongoDB
-	select {}
+	var pprofServer *http.Server
+	if cfg.Configuration.DebugProfile.Port != 0 {
+		pprofAuth := cmp.Or(cfg.Configuration.DebugProfileAuth, cfg.Configuration.ApiServerAuth)
+		if pprofServer, err = profiling.NewServer(&cfg.Configuration.DebugProfile, pprofAuth); err != nil {
+			logger.AppLog.Errorf("pprof server error: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	shutdownTracing, err := tracing.Init(cfg.Configuration.Tracing)
+	if err != nil {
+		logger.AppLog.Errorf("tracing configuration error: %v", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	services := lifecycle.New()
+	// stopped last, flushing the spans of the other components
+	services.Start(lifecycle.Component{Name: "tracing", Stop: shutdownTracing})
+	if cfg.Configuration.ControllerFlag {
+		controller.RogueIPHandler()
+		// stopped last, after the servers and readers feeding it
+		services.Start(lifecycle.Component{
+			Name: "controller",
+			Run:  controller.GetRogueIPs,
+			Stop: controller.Shutdown,
+		})
+	}
+	services.Start(lifecycle.Component{Name: "nf status check", Run: metricdata.RunNfStatusCheck})
+	if prober != nil {
+		services.Start(lifecycle.Component{Name: "nf probes", Run: prober.Run})
+	}
+	if inventory != nil {
+		services.Start(lifecycle.Component{Name: "nrf inventory", Run: inventory.Run})
+	}
+	services.Start(lifecycle.Component{Name: "kafka readers", Run: readers.Run})
+	services.Start(lifecycle.HttpServer("api server", apiServer, cfg.Configuration.ApiServer.Tls))
+	services.Start(lifecycle.HttpServer("prometheus server", promServer, cfg.Configuration.PrometheusServer.Tls))
+	if pusher != nil {
+		services.Start(lifecycle.Component{Name: "metrics push", Run: pusher.Run, Stop: pusher.Stop})
+	}
+	if pprofServer != nil {
+		logger.AppLog.Infof("pprofile exposed on port [%v]", cfg.Configuration.DebugProfile.Port)
+		services.Start(lifecycle.HttpServer("pprof", pprofServer, cfg.Configuration.DebugProfile.Tls))
+	}
+
+	// applies the changes of the configuration file, once all appliers are
+	// registered
+	services.Start(lifecycle.Component{Name: "config reload", Run: reloader.Run})
+
+	shutdownTimeout := time.Duration(cfg.Configuration.ShutdownTimeout) * time.Second
+	if err := services.Run(ctx, shutdownTimeout); err != nil {
+		logger.AppLog.Errorf("metricfunc stopped with error: %v", err)
+		os.Exit(1)
+	}
 }